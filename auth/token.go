@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Token purposes. A token issued for one purpose is never accepted for another.
+const (
+	PurposeAccess      = "access"
+	PurposeVerifyEmail = "verify-email"
+)
+
+const (
+	// AccessTokenTTL is how long a signed access token stays valid.
+	AccessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL is how long a persisted refresh token stays valid.
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token has expired")
+)
+
+// Claims is the payload carried by a signed token.
+type Claims struct {
+	Subject   int    `json:"sub"`
+	Purpose   string `json:"pur"`
+	Email     string `json:"email,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+var (
+	keyOnce sync.Once
+	key     []byte
+)
+
+// signingKey returns the HMAC key used to sign tokens. It is read from
+// AUTH_TOKEN_SECRET; when unset a random key is generated, which means tokens
+// do not survive a restart.
+func signingKey() []byte {
+	keyOnce.Do(func() {
+		if secret := os.Getenv("AUTH_TOKEN_SECRET"); secret != "" {
+			key = []byte(secret)
+			return
+		}
+		log.Print("AUTH_TOKEN_SECRET is not set, using a random signing key")
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			log.Fatalf("Could not generate token signing key: %v", err)
+		}
+	})
+	return key
+}
+
+// tokenHeader is the fixed JWT header, tokens are always HS256.
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// IssueToken signs a new HS256 token for the subject and purpose and returns it
+// together with its expiry time.
+func IssueToken(subject int, purpose string, ttl time.Duration) (string, time.Time, error) {
+	return IssueEmailToken(subject, "", purpose, ttl)
+}
+
+// IssueEmailToken is like IssueToken but binds the token to an email address,
+// so it stops being useful once the user's address changes.
+func IssueEmailToken(subject int, email, purpose string, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	payload, err := json.Marshal(Claims{
+		Subject:   subject,
+		Purpose:   purpose,
+		Email:     email,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + sign(unsigned), expiresAt, nil
+}
+
+// ParseToken verifies the signature, purpose and expiry of a token and returns its claims.
+func ParseToken(token, purpose string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return nil, ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(sign(parts[0]+"."+parts[1])), []byte(parts[2])) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.Purpose != purpose || claims.Subject <= 0 {
+		return nil, ErrInvalidToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrExpiredToken
+	}
+	return &claims, nil
+}
+
+func sign(unsigned string) string {
+	mac := hmac.New(sha256.New, signingKey())
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// GenerateOpaqueToken returns a random URL-safe token suitable for refresh tokens.
+func GenerateOpaqueToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken returns the hex SHA-256 digest of an opaque token. Only the digest is
+// ever stored in the database.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIssueAndParseToken(t *testing.T) {
+	token, expiresAt, err := IssueToken(42, PurposeAccess, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, expiresAt.After(time.Now()))
+
+	claims, err := ParseToken(token, PurposeAccess)
+	require.NoError(t, err)
+	assert.Equal(t, 42, claims.Subject)
+	assert.Equal(t, PurposeAccess, claims.Purpose)
+}
+
+func TestIssueEmailToken(t *testing.T) {
+	token, _, err := IssueEmailToken(42, "tiger@example.com", PurposeVerifyEmail, time.Hour)
+	require.NoError(t, err)
+
+	claims, err := ParseToken(token, PurposeVerifyEmail)
+	require.NoError(t, err)
+	assert.Equal(t, "tiger@example.com", claims.Email)
+
+	// An email token is not an access token.
+	_, err = ParseToken(token, PurposeAccess)
+	assert.Equal(t, ErrInvalidToken, err)
+}
+
+func TestParseToken_Rejections(t *testing.T) {
+	token, _, err := IssueToken(42, PurposeAccess, time.Minute)
+	require.NoError(t, err)
+
+	// Wrong purpose
+	_, err = ParseToken(token, "other")
+	assert.Equal(t, ErrInvalidToken, err)
+
+	// Tampered payload
+	parts := strings.Split(token, ".")
+	other, _, _ := IssueToken(7, PurposeAccess, time.Minute)
+	tampered := parts[0] + "." + strings.Split(other, ".")[1] + "." + parts[2]
+	_, err = ParseToken(tampered, PurposeAccess)
+	assert.Equal(t, ErrInvalidToken, err)
+
+	// Garbage
+	_, err = ParseToken("not-a-token", PurposeAccess)
+	assert.Equal(t, ErrInvalidToken, err)
+
+	// Expired
+	expired, _, err := IssueToken(42, PurposeAccess, -time.Second)
+	require.NoError(t, err)
+	_, err = ParseToken(expired, PurposeAccess)
+	assert.Equal(t, ErrExpiredToken, err)
+}
+
+func TestHashToken(t *testing.T) {
+	token, err := GenerateOpaqueToken()
+	require.NoError(t, err)
+	assert.NotEmpty(t, token)
+	assert.Equal(t, HashToken(token), HashToken(token))
+	assert.Len(t, HashToken(token), 64)
+}
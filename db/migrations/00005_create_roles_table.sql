@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE roles (
+  name VARCHAR(32) PRIMARY KEY
+);
+
+INSERT INTO roles (name) VALUES ('reporter'), ('ranger'), ('admin');
+
+ALTER TABLE users ADD COLUMN role VARCHAR(32) NOT NULL DEFAULT 'reporter';
+ALTER TABLE users ADD CONSTRAINT fk_role FOREIGN KEY (role) REFERENCES roles(name);
+
+-- +goose Down
+ALTER TABLE users DROP CONSTRAINT fk_role;
+ALTER TABLE users DROP COLUMN role;
+DROP TABLE roles;
@@ -0,0 +1,8 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN verified_at TIMESTAMP WITH TIME ZONE;
+
+-- Accounts created before verification existed keep working.
+UPDATE users SET verified_at = created_at;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN verified_at;
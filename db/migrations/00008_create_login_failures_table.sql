@@ -0,0 +1,10 @@
+-- +goose Up
+-- Failed login attempts, keyed by "user:<username>" or "ip:<address>".
+CREATE TABLE login_failures (
+  key VARCHAR(320) PRIMARY KEY,
+  failures INT NOT NULL DEFAULT 0,
+  last_failed_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- +goose Down
+DROP TABLE login_failures;
@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE notifications (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL,
+  kind VARCHAR(32) NOT NULL,
+  tiger_id INT,
+  subject VARCHAR(255) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_notifications_user_id ON notifications (user_id);
+
+-- Sightings outlive the account of their reporter. Erasing a user keeps the
+-- sightings but removes the link to the person.
+ALTER TABLE sightings ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE sightings DROP CONSTRAINT fk_user;
+ALTER TABLE sightings ADD CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+
+-- +goose Down
+ALTER TABLE sightings DROP CONSTRAINT fk_user;
+ALTER TABLE sightings ADD CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id);
+ALTER TABLE sightings ALTER COLUMN user_id SET NOT NULL;
+DROP TABLE notifications;
@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE tigers ADD COLUMN status VARCHAR(32) NOT NULL DEFAULT 'active'
+  CHECK (status IN ('active', 'missing', 'deceased', 'relocated'));
+ALTER TABLE tigers ADD COLUMN status_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE tigers ADD COLUMN status_effective_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_tigers_status ON tigers (status);
+
+-- +goose Down
+DROP INDEX idx_tigers_status;
+ALTER TABLE tigers DROP COLUMN status_effective_at;
+ALTER TABLE tigers DROP COLUMN status_reason;
+ALTER TABLE tigers DROP COLUMN status;
@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE tiger_aliases (
+  id SERIAL PRIMARY KEY,
+  tiger_id INT NOT NULL,
+  name VARCHAR(255) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  CONSTRAINT fk_tiger FOREIGN KEY (tiger_id) REFERENCES tigers(id)
+);
+
+CREATE INDEX idx_tiger_aliases_tiger_id ON tiger_aliases (tiger_id);
+
+-- A merged tiger keeps its row so lookups of its ID can be redirected to the survivor.
+ALTER TABLE tigers ADD COLUMN merged_into_id INT;
+ALTER TABLE tigers ADD CONSTRAINT fk_merged_into FOREIGN KEY (merged_into_id) REFERENCES tigers(id);
+
+-- +goose Down
+ALTER TABLE tigers DROP CONSTRAINT fk_merged_into;
+ALTER TABLE tigers DROP COLUMN merged_into_id;
+DROP TABLE tiger_aliases;
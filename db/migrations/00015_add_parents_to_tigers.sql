@@ -0,0 +1,16 @@
+-- +goose Up
+ALTER TABLE tigers ADD COLUMN mother_id INT;
+ALTER TABLE tigers ADD COLUMN father_id INT;
+ALTER TABLE tigers ADD CONSTRAINT fk_mother FOREIGN KEY (mother_id) REFERENCES tigers(id);
+ALTER TABLE tigers ADD CONSTRAINT fk_father FOREIGN KEY (father_id) REFERENCES tigers(id);
+
+CREATE INDEX idx_tigers_mother_id ON tigers (mother_id);
+CREATE INDEX idx_tigers_father_id ON tigers (father_id);
+
+-- +goose Down
+DROP INDEX idx_tigers_father_id;
+DROP INDEX idx_tigers_mother_id;
+ALTER TABLE tigers DROP CONSTRAINT fk_father;
+ALTER TABLE tigers DROP CONSTRAINT fk_mother;
+ALTER TABLE tigers DROP COLUMN father_id;
+ALTER TABLE tigers DROP COLUMN mother_id;
@@ -0,0 +1,24 @@
+-- +goose Up
+ALTER TABLE tigers ADD COLUMN sex VARCHAR(16) NOT NULL DEFAULT 'unknown'
+  CHECK (sex IN ('female', 'male', 'unknown'));
+ALTER TABLE tigers ADD COLUMN subspecies VARCHAR(32) NOT NULL DEFAULT ''
+  CHECK (subspecies IN ('', 'bengal', 'amur', 'indochinese', 'malayan', 'south_china', 'sumatran'));
+ALTER TABLE tigers ADD COLUMN distinguishing_marks TEXT NOT NULL DEFAULT '';
+ALTER TABLE tigers ADD COLUMN stripe_notes TEXT NOT NULL DEFAULT '';
+ALTER TABLE tigers ADD COLUMN identification_codes TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE tigers ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX idx_tigers_sex ON tigers (sex);
+CREATE INDEX idx_tigers_identification_codes ON tigers USING GIN (identification_codes);
+CREATE INDEX idx_tigers_tags ON tigers USING GIN (tags);
+
+-- +goose Down
+DROP INDEX idx_tigers_tags;
+DROP INDEX idx_tigers_identification_codes;
+DROP INDEX idx_tigers_sex;
+ALTER TABLE tigers DROP COLUMN tags;
+ALTER TABLE tigers DROP COLUMN identification_codes;
+ALTER TABLE tigers DROP COLUMN stripe_notes;
+ALTER TABLE tigers DROP COLUMN distinguishing_marks;
+ALTER TABLE tigers DROP COLUMN subspecies;
+ALTER TABLE tigers DROP COLUMN sex;
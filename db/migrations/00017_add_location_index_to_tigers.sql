@@ -0,0 +1,6 @@
+-- +goose Up
+-- Lets nearby searches narrow down tigers to a bounding box before computing distances.
+CREATE INDEX idx_tigers_last_seen_location ON tigers (last_seen_lat, last_seen_lon);
+
+-- +goose Down
+DROP INDEX idx_tigers_last_seen_location;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- Sightings accepted despite failing a plausibility check record why they need a review.
+ALTER TABLE sightings ADD COLUMN review_reason TEXT NOT NULL DEFAULT '';
+CREATE INDEX idx_sightings_needs_review ON sightings (tiger_id) WHERE review_reason <> '';
+
+-- +goose Down
+DROP INDEX idx_sightings_needs_review;
+ALTER TABLE sightings DROP COLUMN review_reason;
@@ -0,0 +1,32 @@
+-- +goose Up
+-- The reserve a tiger lives in, which sighting rules can be configured for.
+ALTER TABLE tigers ADD COLUMN reserve VARCHAR(100) NOT NULL DEFAULT '';
+CREATE INDEX idx_tigers_reserve ON tigers (reserve);
+
+-- Sighting rules set how far in distance and time a sighting must be from the
+-- sightings before and after it. A rule for a tiger takes precedence over one
+-- for its reserve, which takes precedence over the global rule.
+CREATE TABLE sighting_rules (
+  id SERIAL PRIMARY KEY,
+  scope VARCHAR(16) NOT NULL CHECK (scope IN ('global', 'reserve', 'tiger')),
+  reserve VARCHAR(100),
+  tiger_id INT,
+  min_distance_km DOUBLE PRECISION NOT NULL CHECK (min_distance_km >= 0),
+  min_gap_minutes INT NOT NULL CHECK (min_gap_minutes >= 0),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  CONSTRAINT fk_tiger FOREIGN KEY (tiger_id) REFERENCES tigers(id) ON DELETE CASCADE,
+  CHECK ((scope = 'reserve') = (reserve IS NOT NULL)),
+  CHECK ((scope = 'tiger') = (tiger_id IS NOT NULL))
+);
+
+CREATE UNIQUE INDEX idx_sighting_rules_global ON sighting_rules (scope) WHERE scope = 'global';
+CREATE UNIQUE INDEX idx_sighting_rules_reserve ON sighting_rules (reserve) WHERE scope = 'reserve';
+CREATE UNIQUE INDEX idx_sighting_rules_tiger ON sighting_rules (tiger_id) WHERE scope = 'tiger';
+
+-- The rule that used to be hard-coded: sightings at least 5 km apart.
+INSERT INTO sighting_rules (scope, min_distance_km, min_gap_minutes) VALUES ('global', 5, 0);
+
+-- +goose Down
+DROP TABLE sighting_rules;
+DROP INDEX idx_tigers_reserve;
+ALTER TABLE tigers DROP COLUMN reserve;
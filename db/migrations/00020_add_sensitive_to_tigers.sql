@@ -0,0 +1,6 @@
+-- +goose Up
+-- Photos of sensitive tigers are only shown to users allowed to view them.
+ALTER TABLE tigers ADD COLUMN sensitive BOOLEAN NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE tigers DROP COLUMN sensitive;
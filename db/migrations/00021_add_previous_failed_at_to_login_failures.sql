@@ -0,0 +1,7 @@
+-- +goose Up
+-- Login attempts are counted before the password is checked. The time of the
+-- attempt before the latest one decides whether the latest one was allowed.
+ALTER TABLE login_failures ADD COLUMN previous_failed_at TIMESTAMP WITH TIME ZONE;
+
+-- +goose Down
+ALTER TABLE login_failures DROP COLUMN previous_failed_at;
@@ -0,0 +1,33 @@
+-- +goose Up
+-- Identification codes move to a table of their own, so the database makes sure
+-- a code belongs to at most one tiger even when two requests claim it at the
+-- same time.
+CREATE TABLE tiger_identification_codes (
+  id SERIAL PRIMARY KEY,
+  tiger_id INT NOT NULL,
+  code VARCHAR(64) NOT NULL UNIQUE,
+  CONSTRAINT fk_tiger FOREIGN KEY (tiger_id) REFERENCES tigers(id)
+);
+
+CREATE INDEX idx_tiger_identification_codes_tiger_id ON tiger_identification_codes (tiger_id);
+
+-- A code that was recorded for several tigers stays with the oldest of them.
+-- Every tiger keeps its codes in the order they were listed.
+INSERT INTO tiger_identification_codes (tiger_id, code)
+SELECT tiger_id, code FROM (
+  SELECT DISTINCT ON (c.code) t.id AS tiger_id, c.code, c.position
+  FROM tigers t, unnest(t.identification_codes) WITH ORDINALITY AS c(code, position)
+  ORDER BY c.code, t.id
+) AS claimed
+ORDER BY tiger_id, position;
+
+DROP INDEX idx_tigers_identification_codes;
+ALTER TABLE tigers DROP COLUMN identification_codes;
+
+-- +goose Down
+ALTER TABLE tigers ADD COLUMN identification_codes TEXT[] NOT NULL DEFAULT '{}';
+UPDATE tigers SET identification_codes = ARRAY(
+  SELECT code FROM tiger_identification_codes WHERE tiger_identification_codes.tiger_id = tigers.id ORDER BY id
+);
+CREATE INDEX idx_tigers_identification_codes ON tigers USING GIN (identification_codes);
+DROP TABLE tiger_identification_codes;
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ravirajdarisi/tigerhall-kittens/auth"
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+)
+
+// apiKeyPrefix marks API keys so they are easy to recognise, e.g. by secret scanners.
+const apiKeyPrefix = "thk_"
+
+var errInvalidAPIKey = errors.New("invalid API key")
+
+// apiKeyFromRequest returns the raw API key sent in the Authorization or X-API-Key header.
+func apiKeyFromRequest(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "ApiKey ") {
+		return strings.TrimPrefix(header, "ApiKey ")
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// authenticateAPIKey resolves an active API key and its owner.
+func authenticateAPIKey(db *sql.DB, raw string) (*models.User, *models.APIKey, error) {
+	if !strings.HasPrefix(raw, apiKeyPrefix) {
+		return nil, nil, errInvalidAPIKey
+	}
+
+	key, err := models.GetAPIKeyByHash(db, auth.HashToken(raw))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !key.Active() {
+		return nil, nil, errInvalidAPIKey
+	}
+
+	user, err := models.GetUserByID(db, key.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !user.Active() {
+		return nil, nil, errAccountDeactivated
+	}
+
+	if err := key.Touch(db); err != nil {
+		log.Printf("Failed to record use of API key %d: %v", key.ID, err)
+	}
+	return user, key, nil
+}
+
+// CreateAPIKeyHandler creates a new API key for the authenticated user. The key
+// itself is only ever returned in this response.
+func CreateAPIKeyHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			writeErrorResponse(w, http.StatusUnauthorized, "UNAUTHORIZED", "A valid access token is required.")
+			return
+		}
+
+		var req struct {
+			Name          string              `json:"name"`
+			Scopes        []models.Permission `json:"scopes"`
+			ExpiresInDays int                 `json:"expires_in_days"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if req.Name == "" || len(req.Scopes) == 0 || req.ExpiresInDays < 0 {
+			http.Error(w, "Name and at least one scope are required, expiry must not be negative", http.StatusBadRequest)
+			return
+		}
+		// A key can never do more than its owner.
+		for _, scope := range req.Scopes {
+			if !user.Can(scope) {
+				http.Error(w, "Scope not permitted: "+string(scope), http.StatusBadRequest)
+				return
+			}
+		}
+
+		var expiresAt *time.Time
+		if req.ExpiresInDays > 0 {
+			t := time.Now().AddDate(0, 0, req.ExpiresInDays)
+			expiresAt = &t
+		}
+
+		secret, err := auth.GenerateOpaqueToken()
+		if err != nil {
+			http.Error(w, "Error generating API key", http.StatusInternalServerError)
+			return
+		}
+		raw := apiKeyPrefix + secret
+
+		key := models.NewAPIKey(user.ID, req.Name, raw[:len(apiKeyPrefix)+8], auth.HashToken(raw), req.Scopes, expiresAt)
+		if err := key.Save(db); err != nil {
+			http.Error(w, "Error saving API key", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(struct {
+			APIKey string         `json:"api_key"`
+			Key    *models.APIKey `json:"key"`
+		}{raw, key})
+	}
+}
+
+// ListAPIKeysHandler lists the API keys of the authenticated user.
+func ListAPIKeysHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			writeErrorResponse(w, http.StatusUnauthorized, "UNAUTHORIZED", "A valid access token is required.")
+			return
+		}
+
+		keys, err := models.GetAPIKeysByUserID(db, user.ID)
+		if err != nil {
+			http.Error(w, "Error retrieving API keys", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(keys)
+	}
+}
+
+// RevokeAPIKeyHandler revokes one of the authenticated user's API keys.
+func RevokeAPIKeyHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			writeErrorResponse(w, http.StatusUnauthorized, "UNAUTHORIZED", "A valid access token is required.")
+			return
+		}
+
+		var req struct {
+			ID int `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID <= 0 {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		revoked, err := models.RevokeAPIKey(db, req.ID, user.ID)
+		if err != nil {
+			http.Error(w, "Error revoking API key", http.StatusInternalServerError)
+			return
+		}
+		if !revoked {
+			http.Error(w, "API key not found", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(struct{ Status string }{"API key revoked"})
+	}
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ravirajdarisi/tigerhall-kittens/auth"
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var apiKeyColumns = []string{"id", "user_id", "name", "prefix", "key_hash", "scopes", "last_used_at", "expires_at", "revoked_at", "created_at"}
+
+func TestCreateAPIKeyHandler(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	user := &models.User{ID: 1, Username: "relay-owner", Role: models.RoleReporter}
+
+	mock.ExpectQuery("INSERT INTO api_keys").
+		WithArgs(1, "camera relay", sqlmock.AnyArg(), sqlmock.AnyArg(), "{\"sightings:create\"}", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+
+	body, _ := json.Marshal(map[string]interface{}{"name": "camera relay", "scopes": []string{"sightings:create"}, "expires_in_days": 365})
+	req := httptest.NewRequest("POST", "/users/apikeys/create", bytes.NewBuffer(body))
+	req = req.WithContext(ContextWithUser(req.Context(), user))
+	rr := httptest.NewRecorder()
+	CreateAPIKeyHandler(db).ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusCreated, rr.Code)
+	var created struct {
+		APIKey string        `json:"api_key"`
+		Key    models.APIKey `json:"key"`
+	}
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&created))
+	assert.True(t, strings.HasPrefix(created.APIKey, apiKeyPrefix))
+	assert.True(t, strings.HasPrefix(created.APIKey, created.Key.Prefix))
+	assert.NotNil(t, created.Key.ExpiresAt)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateAPIKeyHandler_ScopeBeyondRole(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	user := &models.User{ID: 1, Username: "volunteer", Role: models.RoleReporter}
+
+	body, _ := json.Marshal(map[string]interface{}{"name": "sneaky", "scopes": []string{"tigers:manage"}})
+	req := httptest.NewRequest("POST", "/users/apikeys/create", bytes.NewBuffer(body))
+	req = req.WithContext(ContextWithUser(req.Context(), user))
+	rr := httptest.NewRecorder()
+	CreateAPIKeyHandler(db).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListAPIKeysHandler(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM api_keys WHERE user_id =").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+			AddRow(3, 1, "camera relay", "thk_abcdefgh", "hash", "{sightings:create}", nil, nil, nil, time.Now()))
+
+	req := httptest.NewRequest("GET", "/users/apikeys/list", nil)
+	req = req.WithContext(ContextWithUser(req.Context(), &models.User{ID: 1}))
+	rr := httptest.NewRecorder()
+	ListAPIKeysHandler(db).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "hash")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRevokeAPIKeyHandler(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE api_keys SET revoked_at").
+		WithArgs(3, 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	body, _ := json.Marshal(map[string]int{"id": 3})
+	req := httptest.NewRequest("POST", "/users/apikeys/revoke", bytes.NewBuffer(body))
+	req = req.WithContext(ContextWithUser(req.Context(), &models.User{ID: 1}))
+	rr := httptest.NewRecorder()
+	RevokeAPIKeyHandler(db).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRequirePermission_APIKey(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	raw := apiKeyPrefix + "relay-secret"
+	owner := models.User{ID: 2, Username: "ranger", Role: models.RoleRanger}
+	expectKey := func() {
+		mock.ExpectQuery("SELECT (.+) FROM api_keys WHERE key_hash =").
+			WithArgs(auth.HashToken(raw)).
+			WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+				AddRow(3, 2, "camera relay", "thk_relay-se", auth.HashToken(raw), "{sightings:create}", nil, nil, nil, time.Now()))
+		mock.ExpectQuery("SELECT (.+) FROM users WHERE id =").
+			WithArgs(2).
+			WillReturnRows(mockUserRows(owner))
+		mock.ExpectExec("UPDATE api_keys SET last_used_at").
+			WithArgs(3, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+
+	// In scope
+	expectKey()
+	req := httptest.NewRequest("POST", "/sightings/create", nil)
+	req.Header.Set("X-API-Key", raw)
+	rr := httptest.NewRecorder()
+	RequirePermission(db, models.PermissionCreateSighting, ok).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	// The owner may manage tigers, but the key is not scoped for it
+	expectKey()
+	req = httptest.NewRequest("POST", "/tigers/create", nil)
+	req.Header.Set("Authorization", "ApiKey "+raw)
+	rr = httptest.NewRecorder()
+	RequirePermission(db, models.PermissionManageTigers, ok).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// Account management only accepts user sessions
+	req = httptest.NewRequest("POST", "/users/apikeys/create", nil)
+	req.Header.Set("X-API-Key", raw)
+	rr = httptest.NewRecorder()
+	RequireAuth(db, ok).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
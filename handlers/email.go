@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"log"
+	"os"
+	"strings"
+)
+
+// EmailMessage is a transactional email queued for the notification processor.
+type EmailMessage struct {
+	UserID  int // Recipient account, recorded in the notification history
+	To      string
+	Subject string
+	Body    string
+}
+
+// queueEmail hands the message to the email queue without blocking the request.
+func queueEmail(emailQueue chan EmailMessage, message EmailMessage) {
+	go func() {
+		log.Printf("Queuing email %q", message.Subject)
+		emailQueue <- message
+	}()
+}
+
+// appBaseURL returns the public URL used to build links in emails.
+func appBaseURL() string {
+	baseURL := os.Getenv("APP_BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080" // Default to the local development server
+	}
+	return strings.TrimRight(baseURL, "/")
+}
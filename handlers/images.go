@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+	"github.com/ravirajdarisi/tigerhall-kittens/storage"
+	"github.com/ravirajdarisi/tigerhall-kittens/utils"
+)
+
+// imageKeyPattern matches the keys returned by storeImage.
+var imageKeyPattern = regexp.MustCompile(`^[0-9a-f]{2}/[0-9a-f]{2}/[0-9a-f]{64}\.(jpg|png)$`)
+
+// ImageSizes are the resized variants of sighting images, by name, with the
+// size of the square they fit into. Uploads themselves are stored at 250x250.
+var ImageSizes = map[string]uint{
+	"thumbnail": 64,
+	"small":     128,
+}
+
+// imageKey returns the key an image with the given content is stored under:
+// its SHA-256 hash, sharded into two levels of directories by the first bytes
+// of the hash so no directory grows too large.
+func imageKey(data []byte, ext string) string {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	return hash[0:2] + "/" + hash[2:4] + "/" + hash + ext
+}
+
+// storeImage stores the encoded image in the blob store and returns its key.
+// Identical images share one blob: an image that is already stored is not
+// written again, and stored reports whether this call wrote it.
+func storeImage(store storage.Store, data []byte, ext string) (key string, stored bool, err error) {
+	key = imageKey(data, ext)
+	if _, err := store.Stat(key); err == nil {
+		return key, false, nil
+	} else if err != storage.ErrNotFound {
+		return "", false, fmt.Errorf("failed to check stored image: %v", err)
+	}
+	if err := store.Put(key, data, mime.TypeByExtension(ext)); err != nil {
+		return "", false, fmt.Errorf("failed to store image: %v", err)
+	}
+	return key, true, nil
+}
+
+// openImage opens the image a sighting's image path refers to. Sightings
+// recorded before images were stored by key hold a file path on the local disk.
+func openImage(store storage.Store, imagePath string) (io.ReadCloser, error) {
+	if imageKeyPattern.MatchString(imagePath) {
+		return store.Get(imagePath)
+	}
+	return os.Open(imagePath)
+}
+
+// decodeImage decodes a .jpg or .png image.
+func decodeImage(data []byte, ext string) (image.Image, error) {
+	var img image.Image
+	var err error
+	switch ext {
+	case ".jpg", ".jpeg":
+		img, err = jpeg.Decode(bytes.NewReader(data))
+	case ".png":
+		img, err = png.Decode(bytes.NewReader(data))
+	default:
+		return nil, fmt.Errorf("unsupported file type")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %v", err)
+	}
+	return img, nil
+}
+
+// encodeImage encodes the image in the format of the extension.
+func encodeImage(img image.Image, ext string) ([]byte, error) {
+	var encoded bytes.Buffer
+	var err error
+	switch ext {
+	case ".jpg", ".jpeg":
+		err = jpeg.Encode(&encoded, img, nil)
+	case ".png":
+		err = png.Encode(&encoded, img)
+	default:
+		return nil, fmt.Errorf("unsupported file type")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode image: %v", err)
+	}
+	return encoded.Bytes(), nil
+}
+
+// readBlob reads the blob stored under key with the time it was stored.
+func readBlob(store storage.Store, key string) ([]byte, time.Time, error) {
+	info, err := store.Stat(key)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	body, err := store.Get(key)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	return data, info.ModTime, err
+}
+
+// readImage reads the image a sighting's image path refers to, see openImage.
+// A missing image is reported as storage.ErrNotFound.
+func readImage(store storage.Store, imagePath string) ([]byte, time.Time, error) {
+	if imageKeyPattern.MatchString(imagePath) {
+		return readBlob(store, imagePath)
+	}
+	fi, err := os.Stat(imagePath)
+	if os.IsNotExist(err) {
+		return nil, time.Time{}, storage.ErrNotFound
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	data, err := os.ReadFile(imagePath)
+	return data, fi.ModTime(), err
+}
+
+// readImageVariant reads the image resized to one of the ImageSizes. Variants
+// of images stored by key are stored next to them on first use; those of older
+// images are resized on every request.
+func readImageVariant(store storage.Store, imagePath, size string) ([]byte, time.Time, error) {
+	ext := strings.ToLower(path.Ext(imagePath))
+	keyed := imageKeyPattern.MatchString(imagePath)
+	variantKey := strings.TrimSuffix(imagePath, ext) + "-" + size + ext
+	if keyed {
+		data, modTime, err := readBlob(store, variantKey)
+		if err != storage.ErrNotFound {
+			return data, modTime, err
+		}
+	}
+
+	original, modTime, err := readImage(store, imagePath)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	img, err := decodeImage(original, ext)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	data, err := encodeImage(utils.ResizeImage(img, ImageSizes[size], ImageSizes[size]), ext)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if keyed {
+		// The variant can be generated again, so failing to store it is not fatal.
+		if err := store.Put(variantKey, data, mime.TypeByExtension(ext)); err != nil {
+			log.Printf("Failed to store %s variant of image %s: %v", size, imagePath, err)
+		}
+	}
+	return data, modTime, nil
+}
+
+// setImageURLs points the sightings that have an image to where it is served.
+func setImageURLs(sightings []models.Sighting) {
+	for i := range sightings {
+		if sightings[i].ImagePath != "" {
+			sightings[i].ImageURL = "/images/" + strconv.Itoa(sightings[i].ID)
+		}
+	}
+}
+
+// GetImageHandler serves the image of a sighting, as in /images/42, or with a
+// size one of its ImageSizes, as in /images/42/thumbnail. Conditional and
+// range requests are supported. Images of sensitive tigers are only served to
+// users allowed to view sensitive images, and are not cached by shared caches.
+// Other images are redirected to a presigned URL when the store supports them.
+func GetImageHandler(db *sql.DB, images storage.Store, size string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r, "/images/")
+		if err != nil {
+			writeErrorResponse(w, http.StatusNotFound, "IMAGE_NOT_FOUND", "Image not found.")
+			return
+		}
+		sightingImage, err := models.GetSightingImage(db, id)
+		if err != nil {
+			log.Printf("Failed to look up image of sighting %d: %v", id, err)
+			http.Error(w, "Error retrieving image", http.StatusInternalServerError)
+			return
+		}
+		if sightingImage == nil {
+			writeErrorResponse(w, http.StatusNotFound, "IMAGE_NOT_FOUND", "Image not found.")
+			return
+		}
+
+		serve := func(w http.ResponseWriter, r *http.Request) {
+			serveImage(w, r, images, sightingImage, size)
+		}
+		if sightingImage.Sensitive {
+			// The response depends on who asks, also for a private cache.
+			w.Header().Add("Vary", "Authorization, X-API-Key")
+			RequirePermission(db, models.PermissionViewSensitiveImages, serve)(w, r)
+			return
+		}
+		serve(w, r)
+	}
+}
+
+// signedImageURLTTL is how long the presigned URLs that images are redirected to stay valid.
+const signedImageURLTTL = 15 * time.Minute
+
+func serveImage(w http.ResponseWriter, r *http.Request, images storage.Store, sightingImage *models.SightingImage, size string) {
+	// Stores that hand out URLs of their own serve images of tigers that are
+	// not sensitive directly. Variants and legacy paths are served by the API.
+	if !sightingImage.Sensitive && size == "" && imageKeyPattern.MatchString(sightingImage.ImagePath) {
+		signedURL, err := images.SignedURL(sightingImage.ImagePath, signedImageURLTTL)
+		if err == nil {
+			// The redirect must not be cached for longer than the URL is valid.
+			w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(signedImageURLTTL.Seconds())/3))
+			http.Redirect(w, r, signedURL, http.StatusFound)
+			return
+		}
+		if err != storage.ErrSignedURLUnsupported {
+			log.Printf("Failed to sign URL of image of sighting %d: %v", sightingImage.SightingID, err)
+		}
+	}
+
+	var data []byte
+	var modTime time.Time
+	var err error
+	if size == "" {
+		data, modTime, err = readImage(images, sightingImage.ImagePath)
+	} else {
+		data, modTime, err = readImageVariant(images, sightingImage.ImagePath, size)
+	}
+	if err == storage.ErrNotFound {
+		writeErrorResponse(w, http.StatusNotFound, "IMAGE_NOT_FOUND", "Image not found.")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to read image of sighting %d: %v", sightingImage.SightingID, err)
+		http.Error(w, "Error retrieving image", http.StatusInternalServerError)
+		return
+	}
+
+	contentType := mime.TypeByExtension(strings.ToLower(path.Ext(sightingImage.ImagePath)))
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	sum := sha256.Sum256(data)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	if sightingImage.Sensitive {
+		w.Header().Set("Cache-Control", "private, max-age=3600")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+	}
+	// ServeContent answers If-None-Match, If-Modified-Since and Range requests.
+	http.ServeContent(w, r, "", modTime, bytes.NewReader(data))
+}
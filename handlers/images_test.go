@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ravirajdarisi/tigerhall-kittens/auth"
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+	"github.com/ravirajdarisi/tigerhall-kittens/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepareImageUpload(t *testing.T) {
+	dir := t.TempDir()
+	images := storage.NewLocalStore(dir)
+
+	upload := func(c color.Color) []byte {
+		img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+		for x := 0; x < 10; x++ {
+			img.Set(x, x, c)
+		}
+		var buf bytes.Buffer
+		require.NoError(t, png.Encode(&buf, img))
+		return buf.Bytes()
+	}
+
+	store := func(c color.Color, ext string) (string, bool, error) {
+		encoded, ext, err := prepareImageUpload(upload(c), ext)
+		if err != nil {
+			return "", false, err
+		}
+		return storeImage(images, encoded, ext)
+	}
+
+	// Images are stored under their hash, in directories named after its first bytes.
+	key, stored, err := store(color.White, ".PNG")
+	require.NoError(t, err)
+	assert.True(t, stored)
+	assert.Regexp(t, imageKeyPattern, key)
+	assert.Equal(t, key[0:2], filepath.Base(filepath.Dir(filepath.Dir(filepath.FromSlash(key)))))
+	assert.FileExists(t, filepath.Join(dir, filepath.FromSlash(key)))
+
+	info, err := images.Stat(key)
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", info.ContentType)
+
+	// The same upload is stored once, another one gets its own file.
+	again, stored, err := store(color.White, ".png")
+	require.NoError(t, err)
+	assert.Equal(t, key, again)
+	assert.False(t, stored)
+
+	other, _, err := store(color.Black, ".png")
+	require.NoError(t, err)
+	assert.NotEqual(t, key, other)
+
+	var files []string
+	require.NoError(t, filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	}))
+	assert.Len(t, files, 2)
+
+	_, _, err = store(color.White, ".gif")
+	assert.Error(t, err)
+}
+
+func TestOpenImage(t *testing.T) {
+	images := storage.NewLocalStore(t.TempDir())
+	key := imageKey([]byte("png data"), ".png")
+	require.NoError(t, images.Put(key, []byte("png data"), "image/png"))
+
+	// Paths recorded before images were stored by key are files on the local disk.
+	legacy := filepath.Join(t.TempDir(), "resized_image.png")
+	require.NoError(t, os.WriteFile(legacy, []byte("legacy data"), 0644))
+
+	for imagePath, want := range map[string]string{key: "png data", legacy: "legacy data"} {
+		rc, err := openImage(images, imagePath)
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+		assert.Equal(t, want, string(data))
+	}
+}
+
+// storedTestImage stores a 250x250 PNG and returns its key.
+func storedTestImage(t *testing.T, images storage.Store) string {
+	img := image.NewRGBA(image.Rect(0, 0, 250, 250))
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	key, _, err := storeImage(images, buf.Bytes(), ".png")
+	require.NoError(t, err)
+	return key
+}
+
+func expectSightingImage(mock sqlmock.Sqlmock, id int, imagePath string, sensitive bool) {
+	mock.ExpectQuery("SELECT s.id, s.image_path, t.sensitive FROM sightings").
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "image_path", "sensitive"}).AddRow(id, imagePath, sensitive))
+}
+
+func TestGetImageHandler(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	images := storage.NewLocalStore(t.TempDir())
+	key := storedTestImage(t, images)
+
+	expectSightingImage(mock, 11, key, false)
+	req := httptest.NewRequest(http.MethodGet, "/images/11", nil)
+	rr := httptest.NewRecorder()
+	GetImageHandler(db, images, "").ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "image/png", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "public, max-age=86400", rr.Header().Get("Cache-Control"))
+	assert.NotEmpty(t, rr.Header().Get("Last-Modified"))
+	etag := rr.Header().Get("ETag")
+	assert.Equal(t, `"`+key[6:70]+`"`, etag)
+	img, err := png.Decode(rr.Body)
+	require.NoError(t, err)
+	assert.Equal(t, 250, img.Bounds().Dx())
+
+	// A client holding the current version gets no body.
+	expectSightingImage(mock, 11, key, false)
+	req = httptest.NewRequest(http.MethodGet, "/images/11", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	GetImageHandler(db, images, "").ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+	assert.Empty(t, rr.Body.Bytes())
+
+	// Ranges of the image can be requested.
+	expectSightingImage(mock, 11, key, false)
+	req = httptest.NewRequest(http.MethodGet, "/images/11", nil)
+	req.Header.Set("Range", "bytes=0-7")
+	rr = httptest.NewRecorder()
+	GetImageHandler(db, images, "").ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusPartialContent, rr.Code)
+	assert.Equal(t, "\x89PNG\r\n\x1a\n", rr.Body.String())
+	assert.Contains(t, rr.Header().Get("Content-Range"), "bytes 0-7/")
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// signingStore is a local store that hands out URLs to its blobs, like the S3 store.
+type signingStore struct {
+	*storage.LocalStore
+}
+
+func (s signingStore) SignedURL(key string, expires time.Duration) (string, error) {
+	return "https://tigers.s3.example.com/" + key + "?X-Amz-Expires=" + strconv.Itoa(int(expires.Seconds())), nil
+}
+
+func TestGetImageHandler_SignedURL(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	images := signingStore{storage.NewLocalStore(t.TempDir())}
+	key := storedTestImage(t, images)
+
+	expectSightingImage(mock, 11, key, false)
+	rr := httptest.NewRecorder()
+	GetImageHandler(db, images, "").ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/images/11", nil))
+	assert.Equal(t, http.StatusFound, rr.Code)
+	assert.Equal(t, "https://tigers.s3.example.com/"+key+"?X-Amz-Expires=900", rr.Header().Get("Location"))
+	assert.Equal(t, "public, max-age=300", rr.Header().Get("Cache-Control"))
+
+	// Variants and images of sensitive tigers are still served by the API.
+	expectSightingImage(mock, 11, key, false)
+	rr = httptest.NewRecorder()
+	GetImageHandler(db, images, "thumbnail").ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/images/11/thumbnail", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	ranger := models.User{ID: 2, Username: "ranger", Role: models.RoleRanger}
+	token, _, err := auth.IssueToken(ranger.ID, auth.PurposeAccess, time.Minute)
+	require.NoError(t, err)
+	expectSightingImage(mock, 11, key, true)
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id =").
+		WithArgs(ranger.ID).
+		WillReturnRows(mockUserRows(ranger))
+	req := httptest.NewRequest(http.MethodGet, "/images/11", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr = httptest.NewRecorder()
+	GetImageHandler(db, images, "").ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get("Location"))
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetImageHandler_Variant(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	dir := t.TempDir()
+	images := storage.NewLocalStore(dir)
+	key := storedTestImage(t, images)
+
+	for i := 0; i < 2; i++ {
+		expectSightingImage(mock, 11, key, false)
+		req := httptest.NewRequest(http.MethodGet, "/images/11/thumbnail", nil)
+		rr := httptest.NewRecorder()
+		GetImageHandler(db, images, "thumbnail").ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		img, err := png.Decode(rr.Body)
+		require.NoError(t, err)
+		assert.Equal(t, 64, img.Bounds().Dx())
+	}
+
+	// The variant is stored next to the image once.
+	assert.FileExists(t, filepath.Join(dir, filepath.FromSlash(key[:len(key)-len(".png")]+"-thumbnail.png")))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetImageHandler_Sensitive(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	images := storage.NewLocalStore(t.TempDir())
+	key := storedTestImage(t, images)
+
+	tests := []struct {
+		name           string
+		user           *models.User
+		expectedStatus int
+	}{
+		{"Anonymous users are unauthorized", nil, http.StatusUnauthorized},
+		{"Reporters are forbidden", &models.User{ID: 1, Username: "volunteer", Role: models.RoleReporter}, http.StatusForbidden},
+		{"Rangers are allowed", &models.User{ID: 2, Username: "ranger", Role: models.RoleRanger}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectSightingImage(mock, 11, key, true)
+			req := httptest.NewRequest(http.MethodGet, "/images/11", nil)
+			if tt.user != nil {
+				token, _, err := auth.IssueToken(tt.user.ID, auth.PurposeAccess, time.Minute)
+				require.NoError(t, err)
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE id =").
+					WithArgs(tt.user.ID).
+					WillReturnRows(mockUserRows(*tt.user))
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			rr := httptest.NewRecorder()
+			GetImageHandler(db, images, "").ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, "Authorization, X-API-Key", rr.Header().Get("Vary"))
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, "private, max-age=3600", rr.Header().Get("Cache-Control"))
+			}
+		})
+	}
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetImageHandler_NotFound(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	images := storage.NewLocalStore(t.TempDir())
+
+	// No such sighting, and a sighting whose image is gone.
+	mock.ExpectQuery("SELECT s.id, s.image_path, t.sensitive FROM sightings").
+		WithArgs(12).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "image_path", "sensitive"}))
+	expectSightingImage(mock, 13, imageKey([]byte("gone"), ".png"), false)
+
+	for _, path := range []string{"/images/12", "/images/13", "/images/abc"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rr := httptest.NewRecorder()
+		GetImageHandler(db, images, "").ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code, path)
+		assert.Contains(t, rr.Body.String(), "IMAGE_NOT_FOUND", path)
+	}
+	require.NoError(t, mock.ExpectationsWereMet())
+}
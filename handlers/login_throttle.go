@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// loginThrottle describes how failed logins for one kind of key are slowed down.
+// After delayAfter consecutive failures every further attempt has to wait an
+// exponentially growing delay, and after lockAfter failures the key is locked
+// for lockDuration.
+type loginThrottle struct {
+	delayAfter   int
+	lockAfter    int
+	maxDelay     time.Duration
+	lockDuration time.Duration
+}
+
+var (
+	// userLoginThrottle protects a single account against password guessing.
+	userLoginThrottle = loginThrottle{delayAfter: 3, lockAfter: 10, maxDelay: time.Minute, lockDuration: 15 * time.Minute}
+	// ipLoginThrottle is looser, as many users may share one address.
+	ipLoginThrottle = loginThrottle{delayAfter: 10, lockAfter: 50, maxDelay: time.Minute, lockDuration: 15 * time.Minute}
+)
+
+// loginFailureResetAfter is how long a key must stay quiet before its failures are forgotten.
+const loginFailureResetAfter = time.Hour
+
+// retryAfter returns how long the key has to wait before the next attempt is allowed.
+func (t loginThrottle) retryAfter(f models.LoginFailure, now time.Time) time.Duration {
+	var wait time.Duration
+	switch {
+	case f.Failures >= t.lockAfter:
+		wait = t.lockDuration
+	case f.Failures >= t.delayAfter:
+		wait = time.Second << uint(f.Failures-t.delayAfter)
+		if wait > t.maxDelay {
+			wait = t.maxDelay
+		}
+	default:
+		return 0
+	}
+
+	if remaining := f.LastFailedAt.Add(wait).Sub(now); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// loginRetryAfter returns the longest wait imposed by any of the recorded failures.
+func loginRetryAfter(failures []models.LoginFailure, userKey string, now time.Time) time.Duration {
+	var longest time.Duration
+	for _, f := range failures {
+		throttle := ipLoginThrottle
+		if f.Key == userKey {
+			throttle = userLoginThrottle
+		}
+		if wait := throttle.retryAfter(f, now); wait > longest {
+			longest = wait
+		}
+	}
+	return longest
+}
+
+// claimLoginAttempt counts the attempt against the username and the client
+// address before the credentials are checked, and returns how long the client
+// has to wait if the failures before it throttle the attempt. Counting first
+// means concurrent guesses cannot all pass the throttle before any of them is
+// recorded. Throttled attempts stay counted.
+func claimLoginAttempt(db *sql.DB, userKey, ipKey string) (time.Duration, error) {
+	var before []models.LoginFailure
+	for _, key := range []string{userKey, ipKey} {
+		f, err := models.RecordLoginAttempt(db, key, loginFailureResetAfter)
+		if err != nil {
+			return 0, err
+		}
+		before = append(before, f)
+	}
+	return loginRetryAfter(before, userKey, time.Now()), nil
+}
+
+// releaseLoginAttempt takes back the attempts counted by claimLoginAttempt once
+// the credentials proved right.
+func releaseLoginAttempt(db *sql.DB, keys ...string) {
+	for _, key := range keys {
+		if err := models.ReleaseLoginAttempt(db, key); err != nil {
+			log.Printf("Failed to release login attempt for %s: %v", key, err)
+		}
+	}
+}
+
+// writeLoginThrottled answers an attempt refused by claimLoginAttempt.
+func writeLoginThrottled(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	writeErrorResponse(w, http.StatusTooManyRequests, "TOO_MANY_LOGIN_ATTEMPTS", "Too many failed login attempts. Please try again later.")
+}
+
+// loginFailureKeys returns the username and client address keys for a login attempt.
+func loginFailureKeys(r *http.Request, username string) (string, string) {
+	return models.UserLoginFailureKey(strings.ToLower(username)), models.IPLoginFailureKey(clientIP(r))
+}
+
+// clientIP returns the address of the client connected to the server.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// compareDummyPassword spends the same time as checking a real password, so
+// unknown usernames cannot be told apart from wrong passwords by timing.
+func compareDummyPassword(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("tigerhall-kittens"), bcrypt.DefaultCost)
+	})
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginThrottle_RetryAfter(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		failures int
+		ago      time.Duration
+		expected time.Duration
+	}{
+		{"Below the delay threshold", 2, 0, 0},
+		{"First delay", 3, 0, time.Second},
+		{"Delay doubles", 5, 0, 4 * time.Second},
+		{"Delay is capped", 9, 0, time.Minute},
+		{"Delay already elapsed", 5, 10 * time.Second, 0},
+		{"Locked", 10, 0, 15 * time.Minute},
+		{"Lock partially elapsed", 12, 5 * time.Minute, 10 * time.Minute},
+		{"Lock expired", 12, 20 * time.Minute, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := models.LoginFailure{Key: "user:testuser", Failures: tt.failures, LastFailedAt: now.Add(-tt.ago)}
+			assert.Equal(t, tt.expected, userLoginThrottle.retryAfter(f, now))
+		})
+	}
+}
+
+func TestLoginRetryAfter(t *testing.T) {
+	now := time.Now()
+
+	// Five failures delay a username but not a shared address.
+	failures := []models.LoginFailure{
+		{Key: "user:testuser", Failures: 5, LastFailedAt: now},
+		{Key: "ip:10.0.0.1", Failures: 5, LastFailedAt: now},
+	}
+	assert.Equal(t, 4*time.Second, loginRetryAfter(failures, "user:testuser", now))
+	assert.Equal(t, time.Duration(0), loginRetryAfter(failures[1:], "user:testuser", now))
+}
+
+// expectLoginAttempt expects a login attempt to be counted for the key, which
+// had the given failures before it, the last one at lastFailedAt (nil for none).
+func expectLoginAttempt(mock sqlmock.Sqlmock, key interface{}, failures int, lastFailedAt interface{}) {
+	mock.ExpectQuery("INSERT INTO login_failures (.+) RETURNING failures, previous_failed_at").
+		WithArgs(key, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"failures", "previous_failed_at"}).AddRow(failures+1, lastFailedAt))
+}
+
+// expectLoginRelease expects the attempt counted for the key to be taken back.
+func expectLoginRelease(mock sqlmock.Sqlmock, key interface{}) {
+	mock.ExpectExec("UPDATE login_failures SET failures = GREATEST").
+		WithArgs(key).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestClaimLoginAttempt(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	// Concurrent guesses each get the next count, so the fourth one in a row is
+	// delayed even though none of the earlier ones has finished yet.
+	now := time.Now()
+	expectLoginAttempt(mock, "user:testuser", 2, now)
+	expectLoginAttempt(mock, "ip:10.0.0.1", 2, now)
+	expectLoginAttempt(mock, "user:testuser", 3, now)
+	expectLoginAttempt(mock, "ip:10.0.0.1", 3, now)
+
+	wait, err := claimLoginAttempt(db, "user:testuser", "ip:10.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), wait)
+
+	wait, err = claimLoginAttempt(db, "user:testuser", "ip:10.0.0.1")
+	assert.NoError(t, err)
+	assert.InDelta(t, float64(time.Second), float64(wait), float64(100*time.Millisecond))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
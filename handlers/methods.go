@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Methods dispatches a request to the handler registered for its HTTP method and
+// answers 405 Method Not Allowed for any other method.
+type Methods map[string]http.HandlerFunc
+
+func (m Methods) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if handler, ok := m[r.Method]; ok {
+		handler(w, r)
+		return
+	}
+
+	allowed := make([]string, 0, len(m))
+	for method := range m {
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed.")
+}
+
+// Resource routes requests for a single record, as in /tigers/42, and its
+// subresources, as in /tigers/42/family. Routes is keyed by the path after the
+// ID, with "" for the record itself. Unknown paths get 404 Not Found.
+type Resource struct {
+	Prefix string
+	Routes map[string]http.Handler
+}
+
+func (res Resource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := strings.SplitN(strings.TrimPrefix(r.URL.Path, res.Prefix), "/", 2)
+	subresource := ""
+	if len(segments) == 2 {
+		subresource = segments[1]
+	}
+
+	handler, ok := res.Routes[subresource]
+	if _, err := pathID(r, res.Prefix); err != nil || !ok {
+		writeErrorResponse(w, http.StatusNotFound, "NOT_FOUND", "Not found.")
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
+
+var errInvalidPathID = errors.New("invalid id in path")
+
+// pathID parses the numeric ID that follows prefix in the request path, as in
+// /users/42 or /tigers/42/family.
+func pathID(r *http.Request, prefix string) (int, error) {
+	segment := strings.SplitN(strings.TrimPrefix(r.URL.Path, prefix), "/", 2)[0]
+	id, err := strconv.Atoi(segment)
+	if err != nil || id <= 0 {
+		return 0, errInvalidPathID
+	}
+	return id, nil
+}
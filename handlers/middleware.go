@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ravirajdarisi/tigerhall-kittens/auth"
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+)
+
+type contextKey string
+
+const (
+	userContextKey       contextKey = "user"
+	apiKeyContextKey     contextKey = "apiKey"
+	enrollmentContextKey contextKey = "enrollment"
+)
+
+// RequireAuth rejects requests that do not carry a valid access token. The
+// authenticated user is stored in the request context for the wrapped handler.
+// API keys are not accepted, so machine clients cannot manage accounts.
+func RequireAuth(db *sql.DB, next http.HandlerFunc) http.HandlerFunc {
+	return requireAuth(db, false, next)
+}
+
+// RequirePermission authenticates the request like RequireAuth and additionally
+// rejects users whose role has not been granted the permission. API keys are
+// accepted here as long as the permission is within their scopes.
+func RequirePermission(db *sql.DB, permission models.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return requireAuth(db, true, func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+		if !user.Can(permission) {
+			log.Printf("User %d with role %s denied %s on %s", user.ID, user.Role, permission, r.URL.Path)
+			writeErrorResponse(w, http.StatusForbidden, "FORBIDDEN", "You do not have permission to perform this action.")
+			return
+		}
+		if key, ok := APIKeyFromContext(r.Context()); ok && !key.Allows(permission) {
+			log.Printf("API key %d of user %d denied %s on %s", key.ID, user.ID, permission, r.URL.Path)
+			writeErrorResponse(w, http.StatusForbidden, "FORBIDDEN", "The API key is not scoped for this action.")
+			return
+		}
+
+		next(w, r)
+	})
+}
+
+func requireAuth(db *sql.DB, allowAPIKeys bool, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if raw := apiKeyFromRequest(r); allowAPIKeys && raw != "" {
+			user, key, err := authenticateAPIKey(db, raw)
+			if err != nil {
+				log.Printf("Rejected API key request to %s: %v", r.URL.Path, err)
+				writeErrorResponse(w, http.StatusUnauthorized, "UNAUTHORIZED", "A valid API key is required.")
+				return
+			}
+
+			ctx := context.WithValue(ContextWithUser(r.Context(), user), apiKeyContextKey, key)
+			next(w, r.WithContext(ctx))
+			return
+		}
+
+		user, err := AuthenticatedUser(db, r)
+		if err != nil {
+			log.Printf("Rejected unauthenticated request to %s: %v", r.URL.Path, err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="tigerhall"`)
+			writeErrorResponse(w, http.StatusUnauthorized, "UNAUTHORIZED", "A valid access token is required.")
+			return
+		}
+
+		next(w, r.WithContext(ContextWithUser(r.Context(), user)))
+	}
+}
+
+// RequireAuthOrEnrollment authenticates the request like RequireAuth, but also
+// accepts the enrolment token LoginHandler hands to rangers and admins who still
+// have to set up two-factor authentication.
+func RequireAuthOrEnrollment(db *sql.DB, next http.HandlerFunc) http.HandlerFunc {
+	authenticated := requireAuth(db, false, next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		claims, err := auth.ParseToken(strings.TrimPrefix(header, "Bearer "), auth.PurposeMFAEnroll)
+		if !strings.HasPrefix(header, "Bearer ") || err != nil {
+			authenticated(w, r)
+			return
+		}
+
+		user, err := models.GetUserByID(db, claims.Subject)
+		if err != nil || !user.Active() || !user.NeedsTOTPEnrollment() {
+			writeErrorResponse(w, http.StatusUnauthorized, "UNAUTHORIZED", "A valid access token is required.")
+			return
+		}
+		ctx := context.WithValue(ContextWithUser(r.Context(), user), enrollmentContextKey, true)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// enrolling reports whether the request was authenticated with an enrolment
+// token by RequireAuthOrEnrollment.
+func enrolling(ctx context.Context) bool {
+	enrollment, _ := ctx.Value(enrollmentContextKey).(bool)
+	return enrollment
+}
+
+// RequireVerifiedEmail rejects users who have not confirmed their email address.
+// It must be wrapped by RequireAuth or RequirePermission.
+func RequireVerifiedEmail(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			writeErrorResponse(w, http.StatusUnauthorized, "UNAUTHORIZED", "A valid access token is required.")
+			return
+		}
+		if !user.Verified() {
+			writeErrorResponse(w, http.StatusForbidden, "EMAIL_NOT_VERIFIED", "Please verify your email address first.")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// ContextWithUser returns a copy of ctx carrying the authenticated user.
+func ContextWithUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, userContextKey, user)
+}
+
+// UserFromContext returns the authenticated user stored by RequireAuth.
+func UserFromContext(ctx context.Context) (*models.User, bool) {
+	user, ok := ctx.Value(userContextKey).(*models.User)
+	return user, ok && user != nil
+}
+
+// APIKeyFromContext returns the API key the request was authenticated with, if any.
+func APIKeyFromContext(ctx context.Context) (*models.APIKey, bool) {
+	key, ok := ctx.Value(apiKeyContextKey).(*models.APIKey)
+	return key, ok && key != nil
+}
+
+// writeErrorResponse writes an ErrorResponse as JSON with the given status code.
+func writeErrorResponse(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Code: code, Message: message})
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ravirajdarisi/tigerhall-kittens/auth"
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireAuth(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	var seenUserID int
+	handler := RequireAuth(db, func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		require.True(t, ok)
+		seenUserID = user.ID
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// Without a token the wrapped handler is never reached.
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/sightings/create", nil))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	var errResp ErrorResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&errResp))
+	assert.Equal(t, "UNAUTHORIZED", errResp.Code)
+
+	// With a valid token the user is placed in the request context.
+	token, _, err := auth.IssueToken(4, auth.PurposeAccess, time.Minute)
+	require.NoError(t, err)
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id =").
+		WithArgs(4).
+		WillReturnRows(mockUserRows(models.User{ID: 4, Username: "ranger", Email: "ranger@example.com", Role: models.RoleRanger}))
+
+	req := httptest.NewRequest("POST", "/sightings/create", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, 4, seenUserID)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRequirePermission(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	handler := RequirePermission(db, models.PermissionManageTigers, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name           string
+		user           models.User
+		expectedStatus int
+	}{
+		{"Reporter is forbidden", models.User{ID: 1, Username: "volunteer", Role: models.RoleReporter}, http.StatusForbidden},
+		{"Ranger is allowed", models.User{ID: 2, Username: "ranger", Role: models.RoleRanger}, http.StatusNoContent},
+		{"Admin is allowed", models.User{ID: 3, Username: "admin", Role: models.RoleAdmin}, http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, _, err := auth.IssueToken(tt.user.ID, auth.PurposeAccess, time.Minute)
+			require.NoError(t, err)
+			mock.ExpectQuery("SELECT (.+) FROM users WHERE id =").
+				WithArgs(tt.user.ID).
+				WillReturnRows(mockUserRows(tt.user))
+
+			req := httptest.NewRequest("POST", "/tigers/create", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRequireVerifiedEmail(t *testing.T) {
+	handler := RequireVerifiedEmail(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	verifiedAt := time.Now()
+	tests := []struct {
+		name           string
+		user           *models.User
+		expectedStatus int
+	}{
+		{"Unverified user is forbidden", &models.User{ID: 1}, http.StatusForbidden},
+		{"Verified user is allowed", &models.User{ID: 2, VerifiedAt: &verifiedAt}, http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/sightings/create", nil)
+			req = req.WithContext(ContextWithUser(req.Context(), tt.user))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+)
+
+const defaultPageSize = 10
+
+// PageResponse is one page of a list paginated with cursors. The cursors are
+// left out at either end of the list.
+type PageResponse struct {
+	Data       interface{} `json:"data"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	PrevCursor string      `json:"prev_cursor,omitempty"`
+}
+
+// pageRequest holds the pagination parameters of a list request. Requests with
+// a cursor or limit parameter are paginated with cursors and answered with a
+// PageResponse. Other requests keep using page and pageSize and get a plain
+// array, as existing clients expect.
+type pageRequest struct {
+	Limit  int
+	Offset int
+	Cursor *models.Cursor
+	Keyset bool
+}
+
+func parsePageRequest(query url.Values) (pageRequest, *ErrorResponse) {
+	if query.Get("cursor") == "" && query.Get("limit") == "" {
+		page, err := strconv.Atoi(query.Get("page"))
+		if err != nil || page < 1 {
+			page = 1 // Default to the first page if not specified or invalid
+		}
+		pageSize, err := strconv.Atoi(query.Get("pageSize"))
+		if err != nil || pageSize <= 0 {
+			pageSize = defaultPageSize
+		}
+		if pageSize > models.MaxPageSize {
+			pageSize = models.MaxPageSize
+		}
+		return pageRequest{Limit: pageSize, Offset: (page - 1) * pageSize}, nil
+	}
+
+	req := pageRequest{Limit: defaultPageSize, Keyset: true}
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > models.MaxPageSize {
+			return req, &ErrorResponse{Code: "INVALID_LIMIT", Message: fmt.Sprintf("Limit must be between 1 and %d.", models.MaxPageSize)}
+		}
+		req.Limit = limit
+	}
+	if raw := query.Get("cursor"); raw != "" {
+		cursor, err := models.DecodeCursor(raw)
+		if err != nil {
+			return req, invalidCursorResponse
+		}
+		req.Cursor = cursor
+	}
+	return req, nil
+}
+
+var invalidCursorResponse = &ErrorResponse{Code: "INVALID_CURSOR", Message: "The cursor is invalid or belongs to another sort order. Start again without a cursor."}
+
+// adjacent returns the cursors of the pages before and after the page read for
+// the request, given cursors pointing before its first and past its last row.
+// more reports whether rows remained in the direction the page was read in.
+// A page reached through a cursor always has rows behind it.
+func (p pageRequest) adjacent(before, after models.Cursor, more bool) (prev, next *models.Cursor) {
+	ahead, behind := more, p.Cursor != nil
+	if p.Cursor != nil && p.Cursor.Backward {
+		ahead, behind = behind, ahead
+	}
+	if ahead {
+		next = &after
+	}
+	if behind {
+		prev = &before
+	}
+	return prev, next
+}
+
+// writePage answers with one page of a list, and links to the pages next to it
+// in the Link header.
+func writePage(w http.ResponseWriter, r *http.Request, data interface{}, limit int, prev, next *models.Cursor) {
+	resp := PageResponse{Data: data}
+	var links []string
+	if next != nil {
+		resp.NextCursor = next.Encode()
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageURL(r, resp.NextCursor, limit)))
+	}
+	if prev != nil {
+		resp.PrevCursor = prev.Encode()
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, pageURL(r, resp.PrevCursor, limit)))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// pageURL returns the URL of the request with the cursor and limit replaced.
+func pageURL(r *http.Request, cursor string, limit int) string {
+	query := r.URL.Query()
+	query.Del("page")
+	query.Del("pageSize")
+	query.Set("cursor", cursor)
+	query.Set("limit", strconv.Itoa(limit))
+	return r.URL.Path + "?" + query.Encode()
+}
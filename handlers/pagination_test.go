@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePageRequest(t *testing.T) {
+	page, errResp := parsePageRequest(url.Values{"page": {"3"}, "pageSize": {"500"}})
+	assert.Nil(t, errResp)
+	assert.Equal(t, pageRequest{Limit: models.MaxPageSize, Offset: 2 * models.MaxPageSize}, page)
+
+	page, errResp = parsePageRequest(url.Values{"limit": {"25"}})
+	assert.Nil(t, errResp)
+	assert.Equal(t, pageRequest{Limit: 25, Keyset: true}, page)
+
+	cursor := models.Cursor{Sort: "-lastSeen", Key: "2024-03-01T10:00:00Z", ID: 7}
+	page, errResp = parsePageRequest(url.Values{"cursor": {cursor.Encode()}})
+	assert.Nil(t, errResp)
+	assert.Equal(t, defaultPageSize, page.Limit)
+	assert.Equal(t, &cursor, page.Cursor)
+
+	_, errResp = parsePageRequest(url.Values{"limit": {"101"}})
+	assert.Equal(t, "INVALID_LIMIT", errResp.Code)
+
+	_, errResp = parsePageRequest(url.Values{"cursor": {"garbage"}})
+	assert.Equal(t, "INVALID_CURSOR", errResp.Code)
+}
+
+func TestPageRequest_Adjacent(t *testing.T) {
+	before, after := models.Cursor{ID: 1, Backward: true}, models.Cursor{ID: 2}
+
+	tests := []struct {
+		name               string
+		cursor             *models.Cursor
+		more               bool
+		wantPrev, wantNext bool
+	}{
+		{"First page of several", nil, true, false, true},
+		{"Only page", nil, false, false, false},
+		{"Middle page", &models.Cursor{ID: 5}, true, true, true},
+		{"Last page", &models.Cursor{ID: 5}, false, true, false},
+		{"Back to a middle page", &models.Cursor{ID: 5, Backward: true}, true, true, true},
+		{"Back to the first page", &models.Cursor{ID: 5, Backward: true}, false, false, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			prev, next := pageRequest{Cursor: tc.cursor}.adjacent(before, after, tc.more)
+			assert.Equal(t, tc.wantPrev, prev != nil)
+			assert.Equal(t, tc.wantNext, next != nil)
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ravirajdarisi/tigerhall-kittens/auth"
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+)
+
+// passwordResetTTL is how long an emailed password reset link stays valid.
+const passwordResetTTL = time.Hour
+
+// ForgotPasswordHandler emails a single-use password reset link to the user
+// with the given email address. The response is the same whether or not the
+// address is registered, so it cannot be used to discover accounts.
+func ForgotPasswordHandler(db *sql.DB, emailQueue chan EmailMessage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Email string `json:"email"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		user, err := models.GetUserByEmail(db, req.Email)
+		if err != nil && err != sql.ErrNoRows {
+			http.Error(w, "Error fetching user", http.StatusInternalServerError)
+			return
+		}
+
+		if user != nil {
+			token, err := auth.GenerateOpaqueToken()
+			if err != nil {
+				http.Error(w, "Error creating reset token", http.StatusInternalServerError)
+				return
+			}
+
+			// Only the most recently requested link stays valid.
+			if err := models.InvalidatePasswordResetTokensByUserID(db, user.ID); err != nil {
+				http.Error(w, "Error creating reset token", http.StatusInternalServerError)
+				return
+			}
+			if err := models.NewPasswordResetToken(user.ID, auth.HashToken(token), passwordResetTTL).Save(db); err != nil {
+				http.Error(w, "Error creating reset token", http.StatusInternalServerError)
+				return
+			}
+
+			link := appBaseURL() + "/users/password/reset?token=" + url.QueryEscape(token)
+			queueEmail(emailQueue, EmailMessage{
+				UserID:  user.ID,
+				To:      user.Email,
+				Subject: "Reset your Tigerhall Kittens password",
+				Body:    fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %v.\n\n%s\n", user.Username, passwordResetTTL, link),
+			})
+		} else {
+			log.Printf("Password reset requested for unknown email address")
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(struct{ Status string }{"If the address is registered, a reset link has been sent"})
+	}
+}
+
+// ResetPasswordHandler sets a new password using a token from ForgotPasswordHandler.
+// The token is read from the body or from the query string of the emailed link.
+// Opening the link answers GET with instructions and leaves the token unused.
+func ResetPasswordHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			if r.URL.Query().Get("token") == "" {
+				http.Error(w, "Token is required", http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(struct{ Status string }{`To choose a new password, POST {"password": "<new password>"} to this URL`})
+			return
+		}
+
+		var req struct {
+			Token    string `json:"token"`
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Token == "" {
+			req.Token = r.URL.Query().Get("token")
+		}
+
+		if req.Token == "" || req.Password == "" {
+			http.Error(w, "Token and password are required", http.StatusBadRequest)
+			return
+		}
+
+		resetToken, err := models.GetPasswordResetTokenByHash(db, auth.HashToken(req.Token))
+		if err == sql.ErrNoRows {
+			http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error fetching reset token", http.StatusInternalServerError)
+			return
+		}
+
+		if !resetToken.Usable() {
+			http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+			return
+		}
+
+		err = models.ResetPassword(db, resetToken.TokenHash, req.Password)
+		if err == models.ErrInvalidResetToken {
+			http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error updating password", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(struct{ Status string }{"Password has been reset"})
+	}
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ravirajdarisi/tigerhall-kittens/auth"
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var passwordResetTokenColumns = []string{"id", "user_id", "token_hash", "expires_at", "used_at", "created_at"}
+
+func TestForgotPasswordHandler(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	emailQueue := make(chan EmailMessage, 1)
+	handler := ForgotPasswordHandler(db, emailQueue)
+
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE email =").
+		WithArgs("test@example.com").
+		WillReturnRows(mockUserRows(models.User{ID: 1, Username: "testuser", Email: "test@example.com", Role: models.RoleReporter}))
+	mock.ExpectExec("UPDATE password_reset_tokens SET used_at").
+		WithArgs(1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("INSERT INTO password_reset_tokens").
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	body, _ := json.Marshal(map[string]string{"email": "test@example.com"})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/users/password/forgot", bytes.NewBuffer(body)))
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+
+	select {
+	case message := <-emailQueue:
+		assert.Equal(t, "test@example.com", message.To)
+		assert.True(t, strings.Contains(message.Body, "/users/password/reset?token="))
+	case <-time.After(time.Second):
+		t.Fatal("expected a reset email to be queued")
+	}
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestForgotPasswordHandler_UnknownEmail(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	emailQueue := make(chan EmailMessage, 1)
+	handler := ForgotPasswordHandler(db, emailQueue)
+
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE email =").
+		WithArgs("nobody@example.com").
+		WillReturnError(sql.ErrNoRows)
+
+	body, _ := json.Marshal(map[string]string{"email": "nobody@example.com"})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/users/password/forgot", bytes.NewBuffer(body)))
+
+	// Unknown addresses get the same response as registered ones.
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	assert.Len(t, emailQueue, 0)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResetPasswordHandler(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM password_reset_tokens WHERE token_hash =").
+		WithArgs(auth.HashToken("reset-token")).
+		WillReturnRows(sqlmock.NewRows(passwordResetTokenColumns).
+			AddRow(2, 1, auth.HashToken("reset-token"), time.Now().Add(time.Hour), nil, time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE password_reset_tokens SET used_at = \\$2 WHERE token_hash = \\$1 (.+) RETURNING user_id").
+		WithArgs(auth.HashToken("reset-token"), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(1))
+	mock.ExpectExec("UPDATE users SET password_hash").WithArgs(1, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE password_reset_tokens SET used_at").WithArgs(1, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE refresh_tokens SET revoked_at").WithArgs(1, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	body, _ := json.Marshal(map[string]string{"token": "reset-token", "password": "new-password"})
+	rr := httptest.NewRecorder()
+	ResetPasswordHandler(db).ServeHTTP(rr, httptest.NewRequest("POST", "/users/password/reset", bytes.NewBuffer(body)))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResetPasswordHandler_EmailedLink(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	// Opening the link explains what to do without using the token.
+	rr := httptest.NewRecorder()
+	ResetPasswordHandler(db).ServeHTTP(rr, httptest.NewRequest("GET", "/users/password/reset?token=reset-token", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "POST")
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	// Posting the new password to the link reads the token from the query string.
+	mock.ExpectQuery("SELECT (.+) FROM password_reset_tokens WHERE token_hash =").
+		WithArgs(auth.HashToken("reset-token")).
+		WillReturnRows(sqlmock.NewRows(passwordResetTokenColumns).
+			AddRow(2, 1, auth.HashToken("reset-token"), time.Now().Add(time.Hour), time.Now(), time.Now()))
+
+	body, _ := json.Marshal(map[string]string{"password": "new-password"})
+	rr = httptest.NewRecorder()
+	ResetPasswordHandler(db).ServeHTTP(rr, httptest.NewRequest("POST", "/users/password/reset?token=reset-token", bytes.NewBuffer(body)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Invalid or expired reset token")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResetPasswordHandler_UsedToken(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM password_reset_tokens WHERE token_hash =").
+		WithArgs(auth.HashToken("reset-token")).
+		WillReturnRows(sqlmock.NewRows(passwordResetTokenColumns).
+			AddRow(2, 1, auth.HashToken("reset-token"), time.Now().Add(time.Hour), time.Now(), time.Now()))
+
+	body, _ := json.Marshal(map[string]string{"token": "reset-token", "password": "new-password"})
+	rr := httptest.NewRecorder()
+	ResetPasswordHandler(db).ServeHTTP(rr, httptest.NewRequest("POST", "/users/password/reset", bytes.NewBuffer(body)))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
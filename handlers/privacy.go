@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+	"github.com/ravirajdarisi/tigerhall-kittens/storage"
+)
+
+// ExportDataHandler returns everything stored about the authenticated user as
+// a zip archive: the profile, API keys, reported sightings with their images
+// and the notification history.
+func ExportDataHandler(db *sql.DB, images storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			writeErrorResponse(w, http.StatusUnauthorized, "UNAUTHORIZED", "A valid access token is required.")
+			return
+		}
+
+		archive, err := buildDataExport(db, images, user)
+		if err != nil {
+			log.Printf("Failed to export data of user %d: %v", user.ID, err)
+			http.Error(w, "Error exporting user data", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="tigerhall-export-%d-%s.zip"`, user.ID, time.Now().Format("20060102")))
+		w.Write(archive)
+	}
+}
+
+// buildDataExport collects the user's data into an in-memory zip archive, so a
+// failure halfway does not leave the client with a truncated download.
+func buildDataExport(db *sql.DB, images storage.Store, user *models.User) ([]byte, error) {
+	sightings, err := models.GetSightingsByUserID(db, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	notifications, err := models.GetNotificationsByUserID(db, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	apiKeys, err := models.GetAPIKeysByUserID(db, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	documents := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", user},
+		{"sightings.json", sightings},
+		{"notifications.json", notifications},
+		{"api_keys.json", apiKeys},
+	}
+	for _, doc := range documents {
+		f, err := zw.Create(doc.name)
+		if err != nil {
+			return nil, err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(doc.data); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, sighting := range sightings {
+		if sighting.ImagePath == "" {
+			continue
+		}
+		if err := addImageToZip(zw, fmt.Sprintf("images/%d%s", sighting.ID, filepath.Ext(sighting.ImagePath)), images, sighting.ImagePath); err != nil {
+			// A missing image should not prevent the rest of the export.
+			log.Printf("Skipping image of sighting %d in export: %v", sighting.ID, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func addImageToZip(zw *zip.Writer, name string, images storage.Store, imagePath string) error {
+	src, err := openImage(images, imagePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// EraseAccountHandler permanently deletes the authenticated user's account.
+// The current password is required. Reported sightings are kept anonymously.
+func EraseAccountHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			writeErrorResponse(w, http.StatusUnauthorized, "UNAUTHORIZED", "A valid access token is required.")
+			return
+		}
+
+		var req struct {
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if !user.Authenticate(db, req.Password) {
+			writeErrorResponse(w, http.StatusForbidden, "INVALID_PASSWORD", "The current password is incorrect.")
+			return
+		}
+
+		if err := user.Erase(db); err != nil {
+			log.Printf("Failed to erase user %d: %v", user.ID, err)
+			http.Error(w, "Error erasing account", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(struct{ Status string }{"Account erased"})
+	}
+}
+
+// EraseUserHandler lets an admin erase another user's account, for erasure
+// requests that arrive outside the application.
+func EraseUserHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID int `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID <= 0 {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		user, err := models.GetUserByID(db, req.ID)
+		if err == sql.ErrNoRows {
+			writeErrorResponse(w, http.StatusNotFound, "NOT_FOUND", "User not found.")
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error fetching user", http.StatusInternalServerError)
+			return
+		}
+
+		if err := user.Erase(db); err != nil {
+			log.Printf("Failed to erase user %d: %v", user.ID, err)
+			http.Error(w, "Error erasing account", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(struct{ Status string }{"Account erased"})
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+	"github.com/ravirajdarisi/tigerhall-kittens/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportDataHandler(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	imagePath := filepath.Join(t.TempDir(), "tiger.png")
+	require.NoError(t, os.WriteFile(imagePath, []byte("png data"), 0644))
+
+	mock.ExpectQuery("SELECT (.+) FROM sightings WHERE user_id =").
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "tiger_id", "lat", "lon", "timestamp", "image_path", "review_reason"}).
+			AddRow(11, 4, 1, 10.5, 20.5, time.Now(), imagePath, ""))
+	mock.ExpectQuery("SELECT (.+) FROM notifications WHERE user_id =").
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "kind", "tiger_id", "subject", "created_at"}).
+			AddRow(1, 4, models.NotificationSighting, 1, "Tiger 1 was sighted again", time.Now()))
+	mock.ExpectQuery("SELECT (.+) FROM api_keys WHERE user_id =").
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns))
+
+	req := httptest.NewRequest(http.MethodGet, "/users/me/export", nil)
+	req = req.WithContext(ContextWithUser(req.Context(), &models.User{ID: 4, Username: "stripes", Email: "stripes@example.com"}))
+	rr := httptest.NewRecorder()
+	ExportDataHandler(db, storage.NewLocalStore(t.TempDir())).ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/zip", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Header().Get("Content-Disposition"), "attachment")
+
+	archive, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	require.NoError(t, err)
+	files := map[string][]byte{}
+	for _, f := range archive.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		files[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+
+	assert.Contains(t, files, "sightings.json")
+	assert.Contains(t, files, "notifications.json")
+	assert.Contains(t, files, "api_keys.json")
+	assert.Equal(t, []byte("png data"), files["images/11.png"])
+
+	var profile map[string]interface{}
+	require.NoError(t, json.Unmarshal(files["profile.json"], &profile))
+	assert.Equal(t, "stripes@example.com", profile["email"])
+	assert.NotContains(t, profile, "PasswordHash")
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEraseAccountHandler(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	user, err := models.NewUser("stripes", "password", "stripes@example.com")
+	require.NoError(t, err)
+	user.ID = 4
+
+	mock.ExpectBegin()
+	for _, table := range []string{"refresh_tokens", "password_reset_tokens", "recovery_codes", "api_keys", "notifications"} {
+		mock.ExpectExec("DELETE FROM " + table).WithArgs(4).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectExec("DELETE FROM login_failures").WithArgs("user:stripes").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM users").WithArgs(4).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest(http.MethodPost, "/users/me/erase", bytes.NewBufferString(`{"password": "password"}`))
+	req = req.WithContext(ContextWithUser(req.Context(), user))
+	rr := httptest.NewRecorder()
+	EraseAccountHandler(db).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEraseAccountHandler_WrongPassword(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	user, err := models.NewUser("stripes", "password", "stripes@example.com")
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/users/me/erase", bytes.NewBufferString(`{"password": "guess"}`))
+	req = req.WithContext(ContextWithUser(req.Context(), user))
+	rr := httptest.NewRecorder()
+	EraseAccountHandler(db).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+)
+
+// maxDisplayNameLength matches the size of the users.display_name column.
+const maxDisplayNameLength = 255
+
+// UpdateProfileRequest holds the fields of PATCH /users/me. Fields left out of
+// the request are not changed.
+type UpdateProfileRequest struct {
+	Email           *string `json:"email"`
+	DisplayName     *string `json:"display_name"`
+	NewPassword     *string `json:"new_password"`
+	CurrentPassword string  `json:"current_password"`
+}
+
+// GetProfileHandler returns the profile of the authenticated user.
+func GetProfileHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			writeErrorResponse(w, http.StatusUnauthorized, "UNAUTHORIZED", "A valid access token is required.")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(user)
+	}
+}
+
+// UpdateProfileHandler changes the email address, display name or password of
+// the authenticated user. Changing the email address or password requires the
+// current password, and a new email address has to be verified again.
+func UpdateProfileHandler(db *sql.DB, emailQueue chan EmailMessage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			writeErrorResponse(w, http.StatusUnauthorized, "UNAUTHORIZED", "A valid access token is required.")
+			return
+		}
+
+		var req UpdateProfileRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		email, displayName := user.Email, user.DisplayName
+		if req.Email != nil {
+			if address, err := mail.ParseAddress(*req.Email); err != nil || address.Address != *req.Email {
+				http.Error(w, "Email address is invalid", http.StatusBadRequest)
+				return
+			}
+			email = *req.Email
+		}
+		if req.DisplayName != nil {
+			displayName = strings.TrimSpace(*req.DisplayName)
+			if len(displayName) > maxDisplayNameLength {
+				http.Error(w, "Display name is too long", http.StatusBadRequest)
+				return
+			}
+		}
+		if req.NewPassword != nil && *req.NewPassword == "" {
+			http.Error(w, "New password must not be empty", http.StatusBadRequest)
+			return
+		}
+
+		emailChanged := email != user.Email
+		if (emailChanged || req.NewPassword != nil) && !user.Authenticate(db, req.CurrentPassword) {
+			writeErrorResponse(w, http.StatusForbidden, "INVALID_PASSWORD", "The current password is incorrect.")
+			return
+		}
+
+		if emailChanged || displayName != user.DisplayName {
+			err := user.UpdateProfile(db, email, displayName)
+			if err == models.ErrDuplicateEmail {
+				http.Error(w, "Email already exists", http.StatusConflict)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Error updating profile", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if emailChanged {
+			if err := sendVerificationEmail(emailQueue, user); err != nil {
+				log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+			}
+		}
+
+		// Changing the password revokes every refresh token of the user, that of
+		// this session included, so the client has to log in again once its
+		// access token expires.
+		if req.NewPassword != nil {
+			if err := user.UpdatePassword(db, *req.NewPassword); err != nil {
+				http.Error(w, "Error updating password", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(user)
+	}
+}
+
+// GetUserHandler lets an admin look up any user by the ID in the path, as in /users/42.
+func GetUserHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r, "/users/")
+		if err != nil {
+			writeErrorResponse(w, http.StatusNotFound, "NOT_FOUND", "User not found.")
+			return
+		}
+
+		user, err := models.GetUserByID(db, id)
+		if err == sql.ErrNoRows {
+			writeErrorResponse(w, http.StatusNotFound, "NOT_FOUND", "User not found.")
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error fetching user", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(user)
+	}
+}
+
+// ListUsersHandler lets an admin page through all users.
+func ListUsersHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+
+		pageSize, err := strconv.Atoi(r.URL.Query().Get("pageSize"))
+		if err != nil || pageSize <= 0 {
+			pageSize = 10
+		}
+
+		users, err := models.GetAllUsers(db, pageSize, (page-1)*pageSize)
+		if err != nil {
+			http.Error(w, "Error retrieving users from the database", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(users)
+	}
+}
+
+// DeactivateUserHandler lets an admin deactivate an account. The user can no
+// longer log in, and their sessions and API keys are revoked.
+func DeactivateUserHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID int `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID <= 0 {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if admin, ok := UserFromContext(r.Context()); ok && admin.ID == req.ID {
+			http.Error(w, "You cannot deactivate your own account", http.StatusBadRequest)
+			return
+		}
+
+		user, err := models.GetUserByID(db, req.ID)
+		if err == sql.ErrNoRows {
+			writeErrorResponse(w, http.StatusNotFound, "NOT_FOUND", "User not found.")
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error fetching user", http.StatusInternalServerError)
+			return
+		}
+
+		if user.Active() {
+			if err := user.Deactivate(db); err != nil {
+				http.Error(w, "Error deactivating user", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(user)
+	}
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/ravirajdarisi/tigerhall-kittens/auth"
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newProfileUser(t *testing.T) *models.User {
+	user, err := models.NewUser("stripes", "old-password", "stripes@example.com")
+	require.NoError(t, err)
+	user.ID = 4
+	verifiedAt := time.Now()
+	user.VerifiedAt = &verifiedAt
+	return user
+}
+
+func patchProfile(t *testing.T, user *models.User, body map[string]interface{}) *http.Request {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPatch, "/users/me", bytes.NewBuffer(payload))
+	return req.WithContext(ContextWithUser(req.Context(), user))
+}
+
+func TestGetProfileHandler(t *testing.T) {
+	user := newProfileUser(t)
+	user.DisplayName = "Stripes"
+
+	req := httptest.NewRequest(http.MethodGet, "/users/me", nil)
+	req = req.WithContext(ContextWithUser(req.Context(), user))
+	rr := httptest.NewRecorder()
+	GetProfileHandler().ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	var got map[string]interface{}
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&got))
+	assert.Equal(t, "Stripes", got["display_name"])
+	assert.NotContains(t, got, "PasswordHash")
+}
+
+func TestUpdateProfileHandler_DisplayName(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	user := newProfileUser(t)
+
+	// Only the display name changes, so no password is needed.
+	mock.ExpectExec("UPDATE users SET email").
+		WithArgs(4, "stripes@example.com", "Stripes", user.VerifiedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rr := httptest.NewRecorder()
+	UpdateProfileHandler(db, nil).ServeHTTP(rr, patchProfile(t, user, map[string]interface{}{"display_name": "  Stripes "}))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "Stripes", user.DisplayName)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateProfileHandler_EmailChange(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	user := newProfileUser(t)
+	emailQueue := make(chan EmailMessage, 1)
+
+	mock.ExpectExec("UPDATE users SET email").
+		WithArgs(4, "new@example.com", "", nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rr := httptest.NewRecorder()
+	UpdateProfileHandler(db, emailQueue).ServeHTTP(rr, patchProfile(t, user, map[string]interface{}{
+		"email":            "new@example.com",
+		"current_password": "old-password",
+	}))
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.False(t, user.Verified())
+
+	select {
+	case msg := <-emailQueue:
+		assert.Equal(t, "new@example.com", msg.To)
+	case <-time.After(time.Second):
+		t.Fatal("Expected a verification email for the new address")
+	}
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateProfileHandler_WrongPassword(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	rr := httptest.NewRecorder()
+	UpdateProfileHandler(db, nil).ServeHTTP(rr, patchProfile(t, newProfileUser(t), map[string]interface{}{
+		"new_password":     "new-password",
+		"current_password": "guess",
+	}))
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateProfileHandler_DuplicateEmail(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE users SET email").
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "users_email_key"})
+
+	rr := httptest.NewRecorder()
+	UpdateProfileHandler(db, nil).ServeHTTP(rr, patchProfile(t, newProfileUser(t), map[string]interface{}{
+		"email":            "taken@example.com",
+		"current_password": "old-password",
+	}))
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetUserHandler(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id =").
+		WithArgs(4).
+		WillReturnRows(mockUserRows(models.User{ID: 4, Username: "stripes", Role: models.RoleRanger, CreatedAt: time.Now()}))
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id =").
+		WithArgs(5).
+		WillReturnRows(mockUserRows())
+
+	rr := httptest.NewRecorder()
+	GetUserHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/users/4", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	GetUserHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/users/5", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	GetUserHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/users/stripes", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeactivateUserHandler(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id =").
+		WithArgs(4).
+		WillReturnRows(mockUserRows(models.User{ID: 4, Username: "stripes", Role: models.RoleReporter, CreatedAt: time.Now()}))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users SET deactivated_at").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE refresh_tokens SET revoked_at").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE api_keys SET revoked_at").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest(http.MethodPost, "/users/deactivate", bytes.NewBufferString(`{"id": 4}`))
+	req = req.WithContext(ContextWithUser(req.Context(), &models.User{ID: 1, Role: models.RoleAdmin}))
+	rr := httptest.NewRecorder()
+	DeactivateUserHandler(db).ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	var got models.User
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&got))
+	assert.NotNil(t, got.DeactivatedAt)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRequireAuth_DeactivatedUser(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	deactivatedAt := time.Now()
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id =").
+		WithArgs(4).
+		WillReturnRows(mockUserRows(models.User{ID: 4, Username: "stripes", Role: models.RoleReporter, CreatedAt: time.Now(), DeactivatedAt: &deactivatedAt}))
+
+	token, _, err := auth.IssueToken(4, auth.PurposeAccess, auth.AccessTokenTTL)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	RequireAuth(db, GetProfileHandler()).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMethods(t *testing.T) {
+	handler := Methods{
+		http.MethodGet:   func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) },
+		http.MethodPatch: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) },
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/users/me", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/users/me", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.Equal(t, "GET, PATCH", rr.Header().Get("Allow"))
+}
+
+func TestResource(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	handler := Resource{Prefix: "/tigers/", Routes: map[string]http.Handler{
+		"":       http.HandlerFunc(ok),
+		"family": http.HandlerFunc(ok),
+	}}
+
+	for path, expected := range map[string]int{
+		"/tigers/4":         http.StatusOK,
+		"/tigers/4/family":  http.StatusOK,
+		"/tigers/4/unknown": http.StatusNotFound,
+		"/tigers/abc":       http.StatusNotFound,
+		"/tigers/":          http.StatusNotFound,
+	} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, expected, rr.Code, path)
+	}
+}
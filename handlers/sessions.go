@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/ravirajdarisi/tigerhall-kittens/auth"
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+)
+
+// TokenResponse is returned whenever a new session token pair is issued.
+type TokenResponse struct {
+	Status       string `json:"Status,omitempty"`
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+var (
+	errMissingCredentials = errors.New("missing bearer token")
+	errAccountDeactivated = errors.New("account is deactivated")
+)
+
+// issueSession signs a new access token for the user and persists a matching refresh token.
+func issueSession(db *sql.DB, user *models.User) (*TokenResponse, error) {
+	accessToken, _, err := auth.IssueToken(user.ID, auth.PurposeAccess, auth.AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := models.NewRefreshToken(user.ID, auth.HashToken(refreshToken), auth.RefreshTokenTTL).Save(db); err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// AuthenticatedUser resolves the user behind the bearer access token of the request.
+func AuthenticatedUser(db *sql.DB, r *http.Request) (*models.User, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil, errMissingCredentials
+	}
+
+	claims, err := auth.ParseToken(strings.TrimPrefix(header, "Bearer "), auth.PurposeAccess)
+	if err != nil {
+		return nil, err
+	}
+	user, err := models.GetUserByID(db, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if !user.Active() {
+		return nil, errAccountDeactivated
+	}
+	return user, nil
+}
+
+// RefreshHandler exchanges a refresh token for a new token pair. The presented
+// refresh token is revoked, so every refresh token can be used exactly once.
+func RefreshHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req refreshTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		stored, err := models.GetRefreshTokenByHash(db, auth.HashToken(req.RefreshToken))
+		if err != nil {
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+
+		if stored.RevokedAt.Valid {
+			// A revoked token being replayed means it may have leaked, so end every session of the user.
+			if err := models.RevokeRefreshTokensByUserID(db, stored.UserID); err != nil {
+				http.Error(w, "Error revoking sessions", http.StatusInternalServerError)
+				return
+			}
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		if !stored.Active() {
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+
+		revoked, err := stored.Revoke(db)
+		if err != nil {
+			http.Error(w, "Error rotating refresh token", http.StatusInternalServerError)
+			return
+		}
+		if !revoked {
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+
+		user, err := models.GetUserByID(db, stored.UserID)
+		if err != nil || !user.Active() {
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		// Sessions from before the user became a ranger or admin end here.
+		if user.NeedsTOTPEnrollment() {
+			writeErrorResponse(w, http.StatusForbidden, "TWO_FACTOR_REQUIRED", "Log in again to set up two-factor authentication.")
+			return
+		}
+
+		session, err := issueSession(db, user)
+		if err != nil {
+			http.Error(w, "Error issuing session", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(session)
+	}
+}
+
+// LogoutHandler revokes the given refresh token.
+func LogoutHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req refreshTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		stored, err := models.GetRefreshTokenByHash(db, auth.HashToken(req.RefreshToken))
+		if err == sql.ErrNoRows {
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error looking up refresh token", http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := stored.Revoke(db); err != nil {
+			http.Error(w, "Error revoking refresh token", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(struct{ Status string }{"Logged out successfully"})
+	}
+}
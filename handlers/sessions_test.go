@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ravirajdarisi/tigerhall-kittens/auth"
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var refreshTokenColumns = []string{"id", "user_id", "token_hash", "expires_at", "revoked_at", "created_at"}
+
+// mockUserRows returns sqlmock rows for the user, in the column order the models package selects.
+func mockUserRows(users ...models.User) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"id", "username", "password_hash", "email", "role", "created_at", "verified_at", "totp_secret", "totp_enabled_at", "display_name", "deactivated_at"})
+	for _, u := range users {
+		var verifiedAt, totpSecret, totpEnabledAt, deactivatedAt interface{}
+		if u.VerifiedAt != nil {
+			verifiedAt = *u.VerifiedAt
+		}
+		if u.TOTPSecret.Valid {
+			totpSecret = u.TOTPSecret.String
+		}
+		if u.TOTPEnabledAt != nil {
+			totpEnabledAt = *u.TOTPEnabledAt
+		}
+		if u.DeactivatedAt != nil {
+			deactivatedAt = *u.DeactivatedAt
+		}
+		rows.AddRow(u.ID, u.Username, u.PasswordHash, u.Email, string(u.Role), u.CreatedAt, verifiedAt, totpSecret, totpEnabledAt, u.DisplayName, deactivatedAt)
+	}
+	return rows
+}
+
+func TestRefreshHandler(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM refresh_tokens WHERE token_hash =").
+		WithArgs(auth.HashToken("old-token")).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow(3, 1, auth.HashToken("old-token"), time.Now().Add(time.Hour), nil, time.Now()))
+	mock.ExpectExec("UPDATE refresh_tokens SET revoked_at").
+		WithArgs(3, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id =").
+		WithArgs(1).
+		WillReturnRows(mockUserRows(models.User{ID: 1, Username: "testuser", PasswordHash: "hash", Email: "test@example.com", Role: models.RoleReporter}))
+	mock.ExpectQuery("INSERT INTO refresh_tokens").
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+
+	body, _ := json.Marshal(refreshTokenRequest{RefreshToken: "old-token"})
+	req, _ := http.NewRequest("POST", "/users/refresh", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	RefreshHandler(db).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var session TokenResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&session))
+	assert.NotEqual(t, "old-token", session.RefreshToken)
+
+	claims, err := auth.ParseToken(session.AccessToken, auth.PurposeAccess)
+	require.NoError(t, err)
+	assert.Equal(t, 1, claims.Subject)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefreshHandler_ReusedToken(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM refresh_tokens WHERE token_hash =").
+		WithArgs(auth.HashToken("used-token")).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow(3, 1, auth.HashToken("used-token"), time.Now().Add(time.Hour), time.Now(), time.Now()))
+	mock.ExpectExec("UPDATE refresh_tokens SET revoked_at = \\$2 WHERE user_id = \\$1").
+		WithArgs(1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	body, _ := json.Marshal(refreshTokenRequest{RefreshToken: "used-token"})
+	req, _ := http.NewRequest("POST", "/users/refresh", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	RefreshHandler(db).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLogoutHandler(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM refresh_tokens WHERE token_hash =").
+		WithArgs(auth.HashToken("token")).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow(3, 1, auth.HashToken("token"), time.Now().Add(time.Hour), nil, time.Now()))
+	mock.ExpectExec("UPDATE refresh_tokens SET revoked_at").
+		WithArgs(3, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	body, _ := json.Marshal(refreshTokenRequest{RefreshToken: "token"})
+	req, _ := http.NewRequest("POST", "/users/logout", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	LogoutHandler(db).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAuthenticatedUser(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	token, _, err := auth.IssueToken(1, auth.PurposeAccess, time.Minute)
+	require.NoError(t, err)
+
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id =").
+		WithArgs(1).
+		WillReturnRows(mockUserRows(models.User{ID: 1, Username: "testuser", PasswordHash: "hash", Email: "test@example.com", Role: models.RoleReporter}))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	user, err := AuthenticatedUser(db, req)
+	require.NoError(t, err)
+	assert.Equal(t, "testuser", user.Username)
+
+	// Requests without a token are rejected before touching the database.
+	_, err = AuthenticatedUser(db, httptest.NewRequest("GET", "/", nil))
+	assert.Error(t, err)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefreshHandler_TwoFactorRequired(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM refresh_tokens WHERE token_hash =").
+		WithArgs(auth.HashToken("old-token")).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow(3, 4, auth.HashToken("old-token"), time.Now().Add(time.Hour), nil, time.Now()))
+	mock.ExpectExec("UPDATE refresh_tokens SET revoked_at").
+		WithArgs(3, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id =").
+		WithArgs(4).
+		WillReturnRows(mockUserRows(models.User{ID: 4, Username: "ranger", PasswordHash: "hash", Email: "ranger@example.com", Role: models.RoleRanger}))
+
+	body, _ := json.Marshal(refreshTokenRequest{RefreshToken: "old-token"})
+	req, _ := http.NewRequest("POST", "/users/refresh", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	RefreshHandler(db).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "TWO_FACTOR_REQUIRED")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
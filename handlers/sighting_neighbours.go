@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"math"
+	"time"
+
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+	"github.com/ravirajdarisi/tigerhall-kittens/utils"
+)
+
+// neighbourMeasure is the distance and the time between a sighting and one of
+// the sightings taken right before or after it.
+type neighbourMeasure struct {
+	Neighbour  *models.Sighting
+	DistanceKm float64
+	// Elapsed is never negative, also for a neighbour taken later.
+	Elapsed time.Duration
+}
+
+// measureNeighbours measures the sighting against each of its neighbours in
+// the order given, skipping those that are nil. The sighting rule and the
+// speed rule both judge a sighting by these measures.
+func measureNeighbours(sighting models.Sighting, neighbours ...*models.Sighting) []neighbourMeasure {
+	var measures []neighbourMeasure
+	for _, neighbour := range neighbours {
+		if neighbour == nil {
+			continue
+		}
+		elapsed := sighting.Timestamp.Sub(neighbour.Timestamp)
+		if elapsed < 0 {
+			elapsed = -elapsed
+		}
+		measures = append(measures, neighbourMeasure{
+			Neighbour:  neighbour,
+			DistanceKm: utils.CalculateDistance(neighbour.Lat, neighbour.Lon, sighting.Lat, sighting.Lon),
+			Elapsed:    elapsed,
+		})
+	}
+	return measures
+}
+
+// sightingGap is how a neighbourMeasure is reported in the details of a
+// rejected sighting, rounded to one decimal place.
+type sightingGap struct {
+	SightingID     int     `json:"sighting_id"`
+	DistanceKm     float64 `json:"distance_km"`
+	ElapsedMinutes float64 `json:"elapsed_minutes"`
+}
+
+func (m neighbourMeasure) gap() sightingGap {
+	return sightingGap{
+		SightingID:     m.Neighbour.ID,
+		DistanceKm:     round1(m.DistanceKm),
+		ElapsedMinutes: round1(m.Elapsed.Minutes()),
+	}
+}
+
+// round1 rounds x to one decimal place.
+func round1(x float64) float64 {
+	return math.Round(x*10) / 10
+}
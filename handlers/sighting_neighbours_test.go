@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeasureNeighbours(t *testing.T) {
+	taken := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	sighting := models.Sighting{Lat: 10.0, Lon: 20.0, Timestamp: taken}
+	before := &models.Sighting{ID: 1, Lat: 11.0, Lon: 21.0, Timestamp: taken.Add(-3 * time.Hour)}
+	after := &models.Sighting{ID: 2, Lat: 10.01, Lon: 20.01, Timestamp: taken.Add(10 * time.Minute)}
+
+	assert.Empty(t, measureNeighbours(sighting, nil, nil))
+
+	// Missing neighbours are skipped and later ones are measured forwards in time.
+	measures := measureNeighbours(sighting, nil, after, before)
+	if assert.Len(t, measures, 2) {
+		assert.Equal(t, after, measures[0].Neighbour)
+		assert.Equal(t, 10*time.Minute, measures[0].Elapsed)
+		assert.Equal(t, before, measures[1].Neighbour)
+		assert.Equal(t, 3*time.Hour, measures[1].Elapsed)
+
+		// About 156 km, reported to one decimal place.
+		assert.InDelta(t, 155.9, measures[1].DistanceKm, 0.05)
+		assert.Equal(t, sightingGap{SightingID: 1, DistanceKm: 155.9, ElapsedMinutes: 180}, measures[1].gap())
+		assert.Equal(t, sightingGap{SightingID: 2, DistanceKm: 1.6, ElapsedMinutes: 10}, measures[0].gap())
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+)
+
+const (
+	maxRuleDistanceKm = 500
+	maxRuleGapMinutes = 30 * 24 * 60
+)
+
+// ruleViolation describes a sighting that is too close to the sighting before
+// or after it under the rule that applies to the tiger. It is reported in the
+// details of TOO_CLOSE_TO_PREVIOUS_SIGHTING.
+type ruleViolation struct {
+	Rule models.SightingRule `json:"rule"`
+	sightingGap
+}
+
+// checkSightingRule returns the first of the sighting's neighbours, either of
+// which may be nil, that is both closer in distance and in time than the rule
+// allows. A limit of zero is left out, so a rule with only a minimum distance
+// rejects nearby sightings whenever they were taken.
+func checkSightingRule(rule models.SightingRule, sighting models.Sighting, neighbours ...*models.Sighting) *ruleViolation {
+	if rule.MinDistanceKm == 0 && rule.MinGapMinutes == 0 {
+		return nil
+	}
+	for _, m := range measureNeighbours(sighting, neighbours...) {
+		tooClose := rule.MinDistanceKm == 0 || m.DistanceKm < rule.MinDistanceKm
+		tooSoon := rule.MinGapMinutes == 0 || m.Elapsed < rule.MinGap()
+		if tooClose && tooSoon {
+			return &ruleViolation{Rule: rule, sightingGap: m.gap()}
+		}
+	}
+	return nil
+}
+
+func (v *ruleViolation) message() string {
+	switch {
+	case v.Rule.MinDistanceKm == 0:
+		return fmt.Sprintf("New sighting was taken too soon after or before another sighting. Sightings must be at least %d minutes apart.", v.Rule.MinGapMinutes)
+	case v.Rule.MinGapMinutes == 0:
+		return fmt.Sprintf("New sighting is too close to the sighting before or after it. Sightings must be at least %v kilometers apart.", v.Rule.MinDistanceKm)
+	}
+	return fmt.Sprintf("New sighting is too close to the sighting before or after it. Sightings must be at least %v kilometers or %d minutes apart.", v.Rule.MinDistanceKm, v.Rule.MinGapMinutes)
+}
+
+// ListSightingRulesHandler lists the configured sighting rules.
+func ListSightingRulesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rules, err := models.GetSightingRules(db)
+		if err != nil {
+			http.Error(w, "Error retrieving sighting rules", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rules)
+	}
+}
+
+// SaveSightingRuleHandler sets the sighting rule for the global scope, a
+// reserve or a tiger, replacing the rule configured for it before.
+func SaveSightingRuleHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var rule models.SightingRule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			http.Error(w, "Invalid sighting rule", http.StatusBadRequest)
+			return
+		}
+		rule.Scope = models.SightingRuleScope(strings.ToLower(strings.TrimSpace(string(rule.Scope))))
+		rule.Reserve = strings.TrimSpace(rule.Reserve)
+
+		if validationErr := validateSightingRule(rule); validationErr != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(validationErr)
+			return
+		}
+		if rule.Scope == models.RuleScopeTiger {
+			if _, err := models.GetTigerByID(db, *rule.TigerID); err == sql.ErrNoRows {
+				writeErrorResponse(w, http.StatusBadRequest, "INVALID_TIGER_ID", "No tiger exists with this ID.")
+				return
+			} else if err != nil {
+				http.Error(w, "Error retrieving tiger", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if err := rule.Save(db); err != nil {
+			http.Error(w, "Error saving sighting rule", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rule)
+	}
+}
+
+// DeleteSightingRuleHandler removes a sighting rule, so the rule of the wider
+// scope applies again.
+func DeleteSightingRuleHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r, "/sightings/rules/")
+		if err != nil {
+			writeErrorResponse(w, http.StatusNotFound, "RULE_NOT_FOUND", "No sighting rule exists with this ID.")
+			return
+		}
+		deleted, err := models.DeleteSightingRule(db, id)
+		if err != nil {
+			http.Error(w, "Error deleting sighting rule", http.StatusInternalServerError)
+			return
+		}
+		if !deleted {
+			writeErrorResponse(w, http.StatusNotFound, "RULE_NOT_FOUND", "No sighting rule exists with this ID.")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// validateSightingRule checks a sighting rule before it is saved.
+func validateSightingRule(rule models.SightingRule) *ErrorResponse {
+	if !rule.Scope.Valid() {
+		return &ErrorResponse{Code: "INVALID_SCOPE", Message: "Scope must be one of global, reserve or tiger."}
+	}
+	if rule.Scope == models.RuleScopeReserve && (rule.Reserve == "" || utf8.RuneCountInString(rule.Reserve) > maxReserveLength) {
+		return &ErrorResponse{Code: "INVALID_RESERVE", Message: fmt.Sprintf("A reserve rule needs the name of the reserve, of at most %d characters.", maxReserveLength)}
+	}
+	if rule.Scope == models.RuleScopeTiger && (rule.TigerID == nil || *rule.TigerID <= 0) {
+		return &ErrorResponse{Code: "INVALID_TIGER_ID", Message: "A tiger rule needs the ID of the tiger."}
+	}
+	if rule.MinDistanceKm < 0 || rule.MinDistanceKm > maxRuleDistanceKm || math.IsNaN(rule.MinDistanceKm) {
+		return &ErrorResponse{Code: "INVALID_MIN_DISTANCE", Message: fmt.Sprintf("Minimum distance must be between 0 and %d kilometers.", maxRuleDistanceKm)}
+	}
+	if rule.MinGapMinutes < 0 || rule.MinGapMinutes > maxRuleGapMinutes {
+		return &ErrorResponse{Code: "INVALID_MIN_GAP", Message: fmt.Sprintf("Minimum gap must be between 0 and %d minutes (30 days).", maxRuleGapMinutes)}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckSightingRule(t *testing.T) {
+	taken := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	sighting := models.Sighting{Lat: 10.0, Lon: 20.0, Timestamp: taken}
+	rule := models.SightingRule{Scope: models.RuleScopeGlobal, MinDistanceKm: 5, MinGapMinutes: 60}
+
+	// A sighting far away and hours apart passes.
+	far := &models.Sighting{ID: 1, Lat: 11.0, Lon: 21.0, Timestamp: taken.Add(-3 * time.Hour)}
+	assert.Nil(t, checkSightingRule(rule, sighting, far, nil))
+
+	// Being only too soon or only too close is not enough to be rejected.
+	soon := &models.Sighting{ID: 2, Lat: 11.0, Lon: 21.0, Timestamp: taken.Add(59 * time.Minute)}
+	nearby := &models.Sighting{ID: 3, Lat: 10.01, Lon: 20.01, Timestamp: taken.Add(-72 * time.Hour)}
+	assert.Nil(t, checkSightingRule(rule, sighting, soon, nearby))
+
+	// A sighting within the minimum distance and the minimum gap is.
+	nearbySoon := &models.Sighting{ID: 4, Lat: 10.01, Lon: 20.01, Timestamp: taken.Add(59 * time.Minute)}
+	violation := checkSightingRule(rule, sighting, far, nearbySoon)
+	if assert.NotNil(t, violation) {
+		assert.Equal(t, 4, violation.SightingID)
+		assert.Contains(t, violation.message(), "at least 5 kilometers or 60 minutes apart")
+	}
+
+	// Without a minimum gap a sighting within the minimum distance is too close, however long ago it was taken.
+	violation = checkSightingRule(models.SightingRule{Scope: models.RuleScopeGlobal, MinDistanceKm: 5}, sighting, nearby)
+	if assert.NotNil(t, violation) {
+		assert.Equal(t, 3, violation.SightingID)
+		assert.Contains(t, violation.message(), "at least 5 kilometers apart")
+	}
+
+	// Without a minimum distance a sighting less than the minimum gap later is too soon, however far away it is.
+	violation = checkSightingRule(models.SightingRule{Scope: models.RuleScopeGlobal, MinGapMinutes: 60}, sighting, far, soon)
+	if assert.NotNil(t, violation) {
+		assert.Equal(t, 2, violation.SightingID)
+		assert.Contains(t, violation.message(), "at least 60 minutes apart")
+	}
+
+	// A rule of zeros allows any sighting.
+	assert.Nil(t, checkSightingRule(models.SightingRule{Scope: models.RuleScopeGlobal}, sighting, nearbySoon))
+}
+
+func TestSaveSightingRuleHandler(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	handler := SaveSightingRuleHandler(db)
+
+	tests := []struct {
+		name         string
+		body         string
+		expectedCode string
+	}{
+		{"Unknown scope", `{"scope": "country", "min_distance_km": 5}`, "INVALID_SCOPE"},
+		{"Reserve rule without reserve", `{"scope": "reserve", "reserve": " ", "min_distance_km": 5}`, "INVALID_RESERVE"},
+		{"Tiger rule without tiger", `{"scope": "tiger", "min_distance_km": 5}`, "INVALID_TIGER_ID"},
+		{"Negative distance", `{"scope": "global", "min_distance_km": -1}`, "INVALID_MIN_DISTANCE"},
+		{"Gap of a year", `{"scope": "global", "min_gap_minutes": 525600}`, "INVALID_MIN_GAP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPut, "/sightings/rules", bytes.NewBufferString(tt.body)))
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			var errResp ErrorResponse
+			assert.NoError(t, json.NewDecoder(rr.Body).Decode(&errResp))
+			assert.Equal(t, tt.expectedCode, errResp.Code)
+		})
+	}
+
+	// A tiger rule replaces the rule the tiger had before.
+	mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id = \\$1").
+		WithArgs(3).
+		WillReturnRows(mockTigerRows(models.Tiger{ID: 3, Name: "Kaa"}))
+	mock.ExpectQuery("INSERT INTO sighting_rules (.+) ON CONFLICT \\(tiger_id\\) WHERE scope = 'tiger'").
+		WithArgs(models.RuleScopeTiger, nil, 3, 2.5, 30).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "updated_at"}).AddRow(7, time.Now()))
+
+	rr := httptest.NewRecorder()
+	body := `{"scope": "Tiger", "tiger_id": 3, "reserve": "ignored", "min_distance_km": 2.5, "min_gap_minutes": 30}`
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPut, "/sightings/rules", bytes.NewBufferString(body)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var rule models.SightingRule
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&rule))
+	assert.Equal(t, 7, rule.ID)
+	assert.Empty(t, rule.Reserve)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteSightingRuleHandler(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	handler := DeleteSightingRuleHandler(db)
+
+	mock.ExpectExec("DELETE FROM sighting_rules WHERE id = \\$1").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/sightings/rules/7", nil))
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	mock.ExpectExec("DELETE FROM sighting_rules WHERE id = \\$1").WithArgs(8).WillReturnResult(sqlmock.NewResult(0, 0))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/sightings/rules/8", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+)
+
+// defaultMaxSpeedKmh is the fastest a tiger is assumed to travel between two
+// sightings when SIGHTING_MAX_SPEED_KMH is not set. Tigers sprint at about this
+// speed but can not keep it up, so it is a generous limit.
+const defaultMaxSpeedKmh = 60
+
+// speedRule limits how fast a tiger may have moved between its sightings.
+type speedRule struct {
+	// MaxKmh is the highest plausible speed, zero disables the rule.
+	MaxKmh float64
+	// Flag accepts sightings above the speed and flags them for review
+	// instead of rejecting them.
+	Flag bool
+}
+
+// sightingSpeedRule returns the speed rule configured by SIGHTING_MAX_SPEED_KMH
+// and SIGHTING_SPEED_ACTION, which is either "reject" (the default) or "flag".
+func sightingSpeedRule() speedRule {
+	rule := speedRule{MaxKmh: defaultMaxSpeedKmh}
+	if raw := os.Getenv("SIGHTING_MAX_SPEED_KMH"); raw != "" {
+		maxKmh, err := strconv.ParseFloat(raw, 64)
+		if err != nil || maxKmh < 0 || math.IsInf(maxKmh, 0) || math.IsNaN(maxKmh) {
+			log.Printf("Invalid SIGHTING_MAX_SPEED_KMH %q, using %v km/h", raw, rule.MaxKmh)
+		} else {
+			rule.MaxKmh = maxKmh
+		}
+	}
+	switch action := os.Getenv("SIGHTING_SPEED_ACTION"); action {
+	case "", "reject":
+	case "flag":
+		rule.Flag = true
+	default:
+		log.Printf("Invalid SIGHTING_SPEED_ACTION %q, rejecting implausible sightings", action)
+	}
+	return rule
+}
+
+// speedViolation describes the movement between two sightings that was faster
+// than the rule allows. It is reported in the details of IMPLAUSIBLE_SPEED.
+type speedViolation struct {
+	sightingGap
+	// SpeedKmh is left out for sightings taken at the same time.
+	SpeedKmh    float64 `json:"speed_kmh,omitempty"`
+	MaxSpeedKmh float64 `json:"max_speed_kmh"`
+}
+
+// check returns the first of the sighting's neighbours, either of which may be
+// nil, that the tiger would have had to reach faster than the rule allows.
+func (rule speedRule) check(sighting models.Sighting, neighbours ...*models.Sighting) *speedViolation {
+	if rule.MaxKmh <= 0 {
+		return nil
+	}
+	for _, m := range measureNeighbours(sighting, neighbours...) {
+		violation := &speedViolation{sightingGap: m.gap(), MaxSpeedKmh: rule.MaxKmh}
+		if m.Elapsed == 0 {
+			if m.DistanceKm > 0 {
+				return violation
+			}
+			continue
+		}
+		if speed := m.DistanceKm / m.Elapsed.Hours(); speed > rule.MaxKmh {
+			violation.SpeedKmh = round1(speed)
+			return violation
+		}
+	}
+	return nil
+}
+
+func (v *speedViolation) message() string {
+	elapsed := time.Duration(v.ElapsedMinutes * float64(time.Minute)).Round(time.Minute)
+	return fmt.Sprintf("The tiger would have travelled %.1f km in %s from sighting %d, faster than the plausible %v km/h.", v.DistanceKm, elapsed, v.SightingID, v.MaxSpeedKmh)
+}
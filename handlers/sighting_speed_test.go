@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSightingSpeedRule(t *testing.T) {
+	assert.Equal(t, speedRule{MaxKmh: defaultMaxSpeedKmh}, sightingSpeedRule())
+
+	t.Setenv("SIGHTING_MAX_SPEED_KMH", "25")
+	t.Setenv("SIGHTING_SPEED_ACTION", "flag")
+	assert.Equal(t, speedRule{MaxKmh: 25, Flag: true}, sightingSpeedRule())
+
+	// Invalid settings fall back to the defaults.
+	t.Setenv("SIGHTING_MAX_SPEED_KMH", "fast")
+	t.Setenv("SIGHTING_SPEED_ACTION", "ignore")
+	assert.Equal(t, speedRule{MaxKmh: defaultMaxSpeedKmh}, sightingSpeedRule())
+}
+
+func TestSpeedRule_Check(t *testing.T) {
+	taken := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	sighting := models.Sighting{Lat: 10.0, Lon: 20.0, Timestamp: taken}
+	rule := speedRule{MaxKmh: 60}
+
+	// About 156 km in three hours is 52 km/h.
+	plausible := &models.Sighting{ID: 1, Lat: 11.0, Lon: 21.0, Timestamp: taken.Add(-3 * time.Hour)}
+	assert.Nil(t, rule.check(sighting, plausible, nil))
+
+	// The same distance in two and a half hours is 62 km/h.
+	tooFast := &models.Sighting{ID: 2, Lat: 11.0, Lon: 21.0, Timestamp: taken.Add(150 * time.Minute)}
+	violation := rule.check(sighting, plausible, tooFast)
+	if assert.NotNil(t, violation) {
+		assert.Equal(t, 2, violation.SightingID)
+		assert.Equal(t, 62.4, violation.SpeedKmh)
+		assert.Equal(t, 60.0, violation.MaxSpeedKmh)
+		assert.Contains(t, violation.message(), "155.9 km in 2h30m0s from sighting 2")
+	}
+
+	// Sightings at the same time in different places can not both be right.
+	simultaneous := &models.Sighting{ID: 3, Lat: 11.0, Lon: 21.0, Timestamp: taken}
+	violation = rule.check(sighting, simultaneous)
+	if assert.NotNil(t, violation) {
+		assert.Zero(t, violation.SpeedKmh)
+	}
+
+	// A maximum of zero disables the rule.
+	assert.Nil(t, speedRule{}.check(sighting, tooFast))
+}
@@ -1,28 +1,27 @@
 package handlers
 
 import (
-	"bytes"
 	"database/sql"
 	"encoding/json"
-	"fmt"
-	"image"
-	"image/jpeg"
-	"image/png"
+	"errors"
 	"io"
 	"log"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ravirajdarisi/tigerhall-kittens/models"
+	"github.com/ravirajdarisi/tigerhall-kittens/storage"
 	"github.com/ravirajdarisi/tigerhall-kittens/utils"
 )
 
 type ErrorResponse struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
+	// Details holds machine readable information about the error, for the codes that have any.
+	Details interface{} `json:"details,omitempty"`
 }
 
 type NotificationMessage struct {
@@ -31,25 +30,104 @@ type NotificationMessage struct {
 }
 
 type SightingRepository interface {
-	GetLastSightingByTigerID(tigerID int) (*models.Sighting, error)
+	GetTigerByID(tigerID int) (*models.Tiger, error)
+	// LockTigerByID retrieves a tiger and locks it until the transaction ends.
+	// It can only be called within WithinTransaction.
+	LockTigerByID(tigerID int) (*models.Tiger, error)
+	// GetAdjacentSightings retrieves the sightings of a tiger right before and
+	// right after the given time. Either is nil when there is none.
+	GetAdjacentSightings(tigerID int, timestamp time.Time) (before, after *models.Sighting, err error)
+	// GetSightingRule retrieves the sighting rule that applies to the tiger.
+	GetSightingRule(tiger *models.Tiger) (models.SightingRule, error)
 	UpdateTigerLastSeen(tigerID int, timestamp time.Time, lat, lon float64) error
 	SaveSighting(sighting models.Sighting) error
 	GetUsersByTigerID(tigerID int) ([]int, error)
+	// WithinTransaction runs fn with a repository whose reads and writes all
+	// take part in one database transaction. The transaction is committed when
+	// fn returns nil and rolled back otherwise.
+	WithinTransaction(fn func(tx SightingRepository) error) error
+}
+
+// errNoTransaction is returned by repository methods that need a transaction when called outside one.
+var errNoTransaction = errors.New("sighting repository: not within a transaction")
+
+// dbConn is the part of *sql.DB and *sql.Tx the repository uses.
+type dbConn interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
 }
 
 type DBSightingRepository struct {
 	db *sql.DB
+	tx *sql.Tx // set on the repository passed to WithinTransaction
 }
 
 func NewDBSightingRepository(db *sql.DB) *DBSightingRepository {
 	return &DBSightingRepository{db: db}
 }
 
-// GetLastSightingByTigerID retrieves the most recent sighting of a given tiger.
-func (repo *DBSightingRepository) GetLastSightingByTigerID(tigerID int) (*models.Sighting, error) {
+// conn returns the transaction of the repository, if any, and the database otherwise.
+func (repo *DBSightingRepository) conn() dbConn {
+	if repo.tx != nil {
+		return repo.tx
+	}
+	return repo.db
+}
+
+// WithinTransaction runs fn with a repository bound to a new transaction.
+func (repo *DBSightingRepository) WithinTransaction(fn func(tx SightingRepository) error) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&DBSightingRepository{db: repo.db, tx: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetTigerByID retrieves the tiger a sighting is reported for. It does not lock
+// the tiger, even within a transaction; use LockTigerByID for that.
+func (repo *DBSightingRepository) GetTigerByID(tigerID int) (*models.Tiger, error) {
+	return models.GetTigerByID(repo.db, tigerID)
+}
+
+// LockTigerByID retrieves the tiger a sighting is reported for and locks it, so
+// sightings of the same tiger are recorded one after the other.
+func (repo *DBSightingRepository) LockTigerByID(tigerID int) (*models.Tiger, error) {
+	if repo.tx == nil {
+		return nil, errNoTransaction
+	}
+	return models.LockTigerByID(repo.tx, tigerID)
+}
+
+// GetAdjacentSightings retrieves the latest sighting of a tiger taken at or
+// before the given time and the earliest one taken after it.
+func (repo *DBSightingRepository) GetAdjacentSightings(tigerID int, timestamp time.Time) (before, after *models.Sighting, err error) {
+	before, err = repo.getSighting(`WHERE tiger_id = $1 AND timestamp <= $2 ORDER BY timestamp DESC, id DESC LIMIT 1`, tigerID, timestamp)
+	if err != nil {
+		return nil, nil, err
+	}
+	after, err = repo.getSighting(`WHERE tiger_id = $1 AND timestamp > $2 ORDER BY timestamp, id LIMIT 1`, tigerID, timestamp)
+	if err != nil {
+		return nil, nil, err
+	}
+	return before, after, nil
+}
+
+// GetSightingRule retrieves the rule for the tiger, its reserve or the global rule.
+func (repo *DBSightingRepository) GetSightingRule(tiger *models.Tiger) (models.SightingRule, error) {
+	return models.GetSightingRuleForTiger(repo.conn(), tiger)
+}
+
+// getSighting retrieves the first sighting selected by the given clause.
+func (repo *DBSightingRepository) getSighting(clause string, args ...interface{}) (*models.Sighting, error) {
 	sighting := &models.Sighting{}
-	query := `SELECT id, tiger_id, lat, lon, timestamp, image_path FROM sightings WHERE tiger_id = $1 ORDER BY timestamp DESC LIMIT 1`
-	err := repo.db.QueryRow(query, tigerID).Scan(&sighting.ID, &sighting.TigerID, &sighting.Lat, &sighting.Lon, &sighting.Timestamp, &sighting.ImagePath)
+	query := `SELECT id, tiger_id, lat, lon, timestamp, image_path FROM sightings ` + clause
+	err := repo.conn().QueryRow(query, args...).Scan(&sighting.ID, &sighting.TigerID, &sighting.Lat, &sighting.Lon, &sighting.Timestamp, &sighting.ImagePath)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil // No sighting found is not an error
@@ -61,22 +139,23 @@ func (repo *DBSightingRepository) GetLastSightingByTigerID(tigerID int) (*models
 
 func (repo *DBSightingRepository) UpdateTigerLastSeen(tigerID int, timestamp time.Time, lat, lon float64) error {
 	query := `UPDATE tigers SET last_seen_timestamp = $2, last_seen_lat = $3, last_seen_lon = $4 WHERE id = $1`
-	_, err := repo.db.Exec(query, tigerID, timestamp, lat, lon)
+	_, err := repo.conn().Exec(query, tigerID, timestamp, lat, lon)
 	return err
 }
 
 // SaveSighting saves a new sighting to the database.
 func (repo *DBSightingRepository) SaveSighting(sighting models.Sighting) error {
-	query := `INSERT INTO sightings (user_id, tiger_id, lat, lon, timestamp, image_path) VALUES ($1, $2, $3, $4, $5,$6)`
-	_, err := repo.db.Exec(query, sighting.UserID, sighting.TigerID, sighting.Lat, sighting.Lon, sighting.Timestamp, sighting.ImagePath)
+	query := `INSERT INTO sightings (user_id, tiger_id, lat, lon, timestamp, image_path, review_reason) VALUES ($1, $2, $3, $4, $5,$6, $7)`
+	_, err := repo.conn().Exec(query, sighting.UserID, sighting.TigerID, sighting.Lat, sighting.Lon, sighting.Timestamp, sighting.ImagePath, sighting.ReviewReason)
 	return err
 }
 
 // GetUsersByTigerID retrieves a list of unique user IDs who have reported a sighting of a specific tiger.
+// Users who have not verified their email address are left out, as they receive no notifications.
 func (repo *DBSightingRepository) GetUsersByTigerID(tigerID int) ([]int, error) {
 	var userIDs []int
-	query := `SELECT DISTINCT user_id FROM sightings WHERE tiger_id = $1`
-	rows, err := repo.db.Query(query, tigerID)
+	query := `SELECT DISTINCT s.user_id FROM sightings s JOIN users u ON u.id = s.user_id WHERE s.tiger_id = $1 AND u.verified_at IS NOT NULL`
+	rows, err := repo.conn().Query(query, tigerID)
 	if err != nil {
 		return nil, err
 	}
@@ -98,7 +177,8 @@ func (repo *DBSightingRepository) GetUsersByTigerID(tigerID int) ([]int, error)
 }
 
 
-func CreateSightingHandler(repo SightingRepository, notificationQueue chan NotificationMessage) http.HandlerFunc {
+// CreateSightingHandler records a new sighting reported by the authenticated user.
+func CreateSightingHandler(repo SightingRepository, images storage.Store, notificationQueue chan NotificationMessage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if err := r.ParseMultipartForm(10 << 20); err != nil {
 			http.Error(w, "Failed to parse multipart form: "+err.Error(), http.StatusBadRequest)
@@ -112,6 +192,14 @@ func CreateSightingHandler(repo SightingRepository, notificationQueue chan Notif
 			return
 		}
 
+		// The reporter is always the authenticated user, never the user_id sent by the client.
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			writeErrorResponse(w, http.StatusUnauthorized, "UNAUTHORIZED", "A valid access token is required.")
+			return
+		}
+		newSighting.UserID = user.ID
+
 		// Perform validations
 		if validationErr := validateSighting(newSighting); validationErr != nil {
 			w.WriteHeader(http.StatusBadRequest)
@@ -119,6 +207,30 @@ func CreateSightingHandler(repo SightingRepository, notificationQueue chan Notif
 			return
 		}
 
+		// Sightings can only be reported for known tigers that are still alive.
+		tiger, err := repo.GetTigerByID(newSighting.TigerID)
+		if err == sql.ErrNoRows {
+			writeErrorResponse(w, http.StatusNotFound, "TIGER_NOT_FOUND", "No tiger exists with this ID.")
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error retrieving tiger", http.StatusInternalServerError)
+			return
+		}
+		// Sightings of a merged duplicate are recorded for the surviving tiger.
+		if tiger.Merged() {
+			tiger, err = repo.GetTigerByID(*tiger.MergedIntoID)
+			if err != nil {
+				http.Error(w, "Error retrieving tiger", http.StatusInternalServerError)
+				return
+			}
+			newSighting.TigerID = tiger.ID
+		}
+		if !tiger.AcceptsSightings() {
+			writeErrorResponse(w, http.StatusConflict, "TIGER_DECEASED", "Sightings can not be reported for a deceased tiger.")
+			return
+		}
+
 		// Process the image upload synchronously
 		file, header, err := r.FormFile("image")
 		if err != nil {
@@ -133,73 +245,104 @@ func CreateSightingHandler(repo SightingRepository, notificationQueue chan Notif
 			return
 		}
 
-		ext := filepath.Ext(header.Filename)
-		imagePath, err := processImageUpload(imgData, ext)
+		// The image is only stored once the sighting passed the checks below,
+		// so rejected reports leave no blobs behind.
+		encoded, ext, err := prepareImageUpload(imgData, filepath.Ext(header.Filename))
 		if err != nil {
 			log.Printf("Failed to process image upload: %v", err)
 			http.Error(w, "Failed to process image upload", http.StatusInternalServerError)
 			return
 		}
-		newSighting.ImagePath = imagePath
 
-		// Database operations
-		lastSighting, err := repo.GetLastSightingByTigerID(newSighting.TigerID)
+		// The checks run first without a lock, so the upload of the image does
+		// not hold up other reports of the same tiger.
+		_, _, err = checkSighting(repo, tiger, &newSighting)
+		var rejection *sightingRejection
+		if errors.As(err, &rejection) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(rejection.status)
+			json.NewEncoder(w).Encode(rejection.resp)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to check sighting of tiger %d: %v", newSighting.TigerID, err)
+			http.Error(w, "Failed to save sighting", http.StatusInternalServerError)
+			return
+		}
 
-		log.Println(newSighting.UserID)
+		key, stored, err := storeImage(images, encoded, ext)
 		if err != nil {
-			http.Error(w, "Error retrieving last sighting", http.StatusInternalServerError)
+			log.Printf("Failed to store image of sighting of tiger %d: %v", newSighting.TigerID, err)
+			http.Error(w, "Failed to save sighting", http.StatusInternalServerError)
 			return
 		}
+		newSighting.ImagePath = key
 
+		// Lock the tiger while the sighting is checked again and recorded, so
+		// concurrent reports can not both pass the checks and a failure leaves
+		// neither the sighting nor the tiger's last seen details.
 		var filteredUserIDs []int
+		err = repo.WithinTransaction(func(tx SightingRepository) error {
+			tiger, err := tx.LockTigerByID(newSighting.TigerID)
+			if err != nil {
+				return err
+			}
+			if tiger.Merged() {
+				return &sightingRejection{http.StatusConflict, ErrorResponse{Code: "TIGER_MERGED", Message: "The tiger was merged into another one while the sighting was reported. Please report it again."}}
+			}
+			if !tiger.AcceptsSightings() {
+				return &sightingRejection{http.StatusConflict, ErrorResponse{Code: "TIGER_DECEASED", Message: "Sightings can not be reported for a deceased tiger."}}
+			}
 
-		if lastSighting != nil {
-			// Log the latitudes and longitudes being compared
-			log.Printf("Last sighting lat: %v, lon: %v", lastSighting.Lat, lastSighting.Lon)
-			log.Printf("New sighting lat: %v, lon: %v", newSighting.Lat, newSighting.Lon)
-
-			// Check distance from the last sighting
-			distance := utils.CalculateDistance(lastSighting.Lat, lastSighting.Lon, newSighting.Lat, newSighting.Lon)
-
-			// Log the calculated distance
-			log.Printf("Calculated distance: %v kilometers", distance)
-
-			if distance < 5 {
-				errMsg := ErrorResponse{
-					Code:    "TOO_CLOSE_TO_PREVIOUS_SIGHTING",
-					Message: "New sighting is too close to the last sighting. Sightings must be at least 5 kilometers apart.",
-				}
-				w.WriteHeader(http.StatusBadRequest)
-				json.NewEncoder(w).Encode(errMsg)
-				return
+			before, after, err := checkSighting(tx, tiger, &newSighting)
+			if err != nil {
+				return err
 			}
 
+			if before != nil || after != nil {
+				// Fetch user IDs of those who have previously sighted the same tiger
+				userIDs, err := tx.GetUsersByTigerID(newSighting.TigerID)
+				if err != nil {
+					return err
+				}
 
-			// Fetch user IDs of those who have previously sighted the same tiger
-			userIDs, err := repo.GetUsersByTigerID(newSighting.TigerID)
-			if err != nil {
-				http.Error(w, "Failed to fetch users who have sighted the tiger", http.StatusInternalServerError)
-				return
+				// Filter out the current user from the notifcation list
+				for _, userID := range userIDs {
+					if userID != newSighting.UserID {
+						filteredUserIDs = append(filteredUserIDs, userID)
+					}
+				}
 			}
 
-			// Filter out the current user from the notifcation list
-			for _, userID := range userIDs {
-				if userID != newSighting.UserID {
-					filteredUserIDs = append(filteredUserIDs, userID)
+			// A backdated sighting only goes into the history; the tiger keeps
+			// the last seen details of the newer report.
+			if !newSighting.Timestamp.Before(tiger.LastSeenTimestamp) {
+				if err := tx.UpdateTigerLastSeen(newSighting.TigerID, newSighting.Timestamp, newSighting.Lat, newSighting.Lon); err != nil {
+					return err
 				}
 			}
+			return tx.SaveSighting(newSighting)
+		})
+		// An image another sighting already used is left in place.
+		if err != nil && stored {
+			if err := images.Delete(key); err != nil {
+				log.Printf("Failed to delete image %s of unrecorded sighting: %v", key, err)
+			}
 		}
-
-		
-		if err := repo.UpdateTigerLastSeen(newSighting.TigerID, newSighting.Timestamp, newSighting.Lat, newSighting.Lon); err != nil {
-			http.Error(w, "Failed to update tiger's last seen information", http.StatusInternalServerError)
+		if errors.As(err, &rejection) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(rejection.status)
+			json.NewEncoder(w).Encode(rejection.resp)
 			return
 		}
-
-		if err := repo.SaveSighting(newSighting); err != nil {
+		if err != nil {
+			log.Printf("Failed to record sighting of tiger %d: %v", newSighting.TigerID, err)
 			http.Error(w, "Failed to save sighting", http.StatusInternalServerError)
 			return
 		}
+		if newSighting.ReviewReason != "" {
+			log.Printf("Flagged sighting of tiger %d for review: %s", newSighting.TigerID, newSighting.ReviewReason)
+		}
 
 		// Send notifications if there are users to notify
 		if len(filteredUserIDs) > 0 {
@@ -217,6 +360,52 @@ func CreateSightingHandler(repo SightingRepository, notificationQueue chan Notif
 	}
 }
 
+// checkSighting checks a new sighting against the ones taken right before and
+// after it, and returns those. A rejected sighting is reported as a
+// *sightingRejection; one to be reviewed gets its ReviewReason set.
+func checkSighting(repo SightingRepository, tiger *models.Tiger, sighting *models.Sighting) (before, after *models.Sighting, err error) {
+	// Reports can arrive late, so the sighting is compared with the ones
+	// taken right before and after it rather than with the latest one.
+	before, after, err = repo.GetAdjacentSightings(sighting.TigerID, sighting.Timestamp)
+	if err != nil {
+		return nil, nil, err
+	}
+	rule, err := repo.GetSightingRule(tiger)
+	if err != nil {
+		return nil, nil, err
+	}
+	if violation := checkSightingRule(rule, *sighting, before, after); violation != nil {
+		return nil, nil, &sightingRejection{http.StatusBadRequest, ErrorResponse{Code: "TOO_CLOSE_TO_PREVIOUS_SIGHTING", Message: violation.message(), Details: violation}}
+	}
+
+	// A tiger that would have had to move implausibly fast between
+	// sightings points to a misidentification or a wrong time or place.
+	sighting.ReviewReason = ""
+	speedRule := sightingSpeedRule()
+	if violation := speedRule.check(*sighting, before, after); violation != nil {
+		if !speedRule.Flag {
+			return nil, nil, &sightingRejection{http.StatusBadRequest, ErrorResponse{Code: "IMPLAUSIBLE_SPEED", Message: violation.message(), Details: violation}}
+		}
+		sighting.ReviewReason = violation.message()
+	}
+	return before, after, nil
+}
+
+// sightingRejection is returned from the transaction of CreateSightingHandler
+// to turn down a sighting with the given status and response.
+type sightingRejection struct {
+	status int
+	resp   ErrorResponse
+}
+
+func (e *sightingRejection) Error() string {
+	return e.resp.Message
+}
+
+// maxSightingClockSkew is how far ahead of the server clock a sighting's
+// timestamp may be, as the reporter's device clock may run slightly fast.
+const maxSightingClockSkew = 5 * time.Minute
+
 func validateSighting(newSighting models.Sighting) *ErrorResponse {
 	// Validate Timestamp
 	if newSighting.Timestamp.IsZero() {
@@ -226,6 +415,14 @@ func validateSighting(newSighting models.Sighting) *ErrorResponse {
 		}
 	}
 
+	// A sighting from the future would hold the tiger's last seen details until that date.
+	if newSighting.Timestamp.After(time.Now().Add(maxSightingClockSkew)) {
+		return &ErrorResponse{
+			Code:    "INVALID_TIMESTAMP",
+			Message: "Timestamp must not be in the future.",
+		}
+	}
+
 	// Validate Latitude
 	if newSighting.Lat < -90 || newSighting.Lat > 90 || newSighting.Lat == 0 {
 		return &ErrorResponse{
@@ -262,58 +459,28 @@ func validateSighting(newSighting models.Sighting) *ErrorResponse {
 	return nil
 }
 
-func processImageUpload(imgData []byte, ext string) (string, error) {
-	// Determine the storage path.
-	storagePath := os.Getenv("IMAGE_STORAGE_PATH")
-	if storagePath == "" {
-		storagePath = "./default_storage" // Default path relative to the project
-	}
-
-	// Ensure the storage directory exists.
-	if _, err := os.Stat(storagePath); os.IsNotExist(err) {
-		err := os.MkdirAll(storagePath, 0755) // Create the directory with read & execute permissions
-		if err != nil {
-			return "", fmt.Errorf("failed to create storage directory: %v", err)
-		}
+// prepareImageUpload resizes an uploaded image and encodes it again, without
+// storing it yet. It returns the encoded image and its normalized extension;
+// storeImage keeps it under a key derived from its content.
+func prepareImageUpload(imgData []byte, ext string) ([]byte, string, error) {
+	ext = strings.ToLower(ext)
+	if ext == ".jpeg" {
+		ext = ".jpg"
 	}
 
-	// Decode the image from the buffered data.
-	var img image.Image
-	var err error
-	switch ext {
-	case ".jpg", ".jpeg":
-		img, err = jpeg.Decode(bytes.NewReader(imgData))
-	case ".png":
-		img, err = png.Decode(bytes.NewReader(imgData))
-	default:
-		return "", fmt.Errorf("unsupported file type")
-	}
+	img, err := decodeImage(imgData, ext)
 	if err != nil {
-		return "", fmt.Errorf("failed to decode image: %v", err)
-	}
-
-	resizedImg := utils.ResizeImage(img, 250, 250)
-	fileName := "resized_image" + ext
-	filePath := filepath.Join(storagePath, fileName)
-	dst, err := os.Create(filePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to create file: %v", err)
-	}
-	defer dst.Close()
-	switch ext {
-	case ".jpg", ".jpeg":
-		err = jpeg.Encode(dst, resizedImg, nil)
-	case ".png":
-		err = png.Encode(dst, resizedImg)
+		return nil, "", err
 	}
+	encoded, err := encodeImage(utils.ResizeImage(img, 250, 250), ext)
 	if err != nil {
-		return "", fmt.Errorf("failed to write image to file: %v", err)
+		return nil, "", err
 	}
-
-	return filePath, nil
+	return encoded, ext, nil
 }
 
 // ListSightingsHandler creates an HTTP handler function for listing sightings with pagination.
+// Requests with a cursor or limit parameter are paginated with cursors, others with page and pageSize.
 func ListSightingsHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 	
@@ -329,27 +496,44 @@ func ListSightingsHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Parse pagination parameters
-		page, err := strconv.Atoi(r.URL.Query().Get("page"))
-		if err != nil || page < 1 {
-			page = 1 
+		page, validationErr := parsePageRequest(r.URL.Query())
+		if validationErr != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(validationErr)
+			return
 		}
 
-		pageSize, err := strconv.Atoi(r.URL.Query().Get("pageSize"))
-		if err != nil || pageSize <= 0 {
-			pageSize = 10
+		if page.Keyset {
+			sightings, more, err := models.GetSightingsPageByTigerID(db, tigerID, page.Limit, page.Cursor)
+			if err == models.ErrInvalidCursor {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(invalidCursorResponse)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Failed to fetch sightings", http.StatusInternalServerError)
+				return
+			}
+			var prev, next *models.Cursor
+			if len(sightings) > 0 {
+				prev, next = page.adjacent(models.SightingCursor(sightings[0], true), models.SightingCursor(sightings[len(sightings)-1], false), more)
+			}
+			setImageURLs(sightings)
+			writePage(w, r, sightings, page.Limit, prev, next)
+			return
 		}
 
-		// Calculate offset
-		offset := (page - 1) * pageSize
-
 		// Fetch sightings with pagination
-		sightings, err := models.GetAllSightingsByTigerID(db, tigerID, pageSize, offset)
+		sightings, err := models.GetAllSightingsByTigerID(db, tigerID, page.Limit, page.Offset)
 		if err != nil {
 			http.Error(w, "Failed to fetch sightings", http.StatusInternalServerError)
 			return
 		}
 
 		// Respond with the list of sightings in JSON format
+		setImageURLs(sightings)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(sightings)
 	}
@@ -5,11 +5,20 @@ import (
 	_"database/sql"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/ravirajdarisi/tigerhall-kittens/models"
+	"github.com/ravirajdarisi/tigerhall-kittens/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -20,9 +29,33 @@ type MockSightingRepository struct {
 }
 
 // Define methods that match the interface you are mocking
-func (m *MockSightingRepository) GetLastSightingByTigerID(tigerID int) (*models.Sighting, error) {
+func (m *MockSightingRepository) GetTigerByID(tigerID int) (*models.Tiger, error) {
+	args := m.Called(tigerID)
+	tiger, _ := args.Get(0).(*models.Tiger)
+	return tiger, args.Error(1)
+}
+
+func (m *MockSightingRepository) LockTigerByID(tigerID int) (*models.Tiger, error) {
 	args := m.Called(tigerID)
-	return args.Get(0).(*models.Sighting), args.Error(1)
+	tiger, _ := args.Get(0).(*models.Tiger)
+	return tiger, args.Error(1)
+}
+
+func (m *MockSightingRepository) WithinTransaction(fn func(tx SightingRepository) error) error {
+	if err := m.Called().Error(0); err != nil {
+		return err
+	}
+	return fn(m)
+}
+
+func (m *MockSightingRepository) GetAdjacentSightings(tigerID int, timestamp time.Time) (*models.Sighting, *models.Sighting, error) {
+	args := m.Called(tigerID, timestamp)
+	return args.Get(0).(*models.Sighting), args.Get(1).(*models.Sighting), args.Error(2)
+}
+
+func (m *MockSightingRepository) GetSightingRule(tiger *models.Tiger) (models.SightingRule, error) {
+	args := m.Called(tiger.ID)
+	return args.Get(0).(models.SightingRule), args.Error(1)
 }
 
 func (m *MockSightingRepository) UpdateTigerLastSeen(tigerID int, timestamp time.Time, lat, lon float64) error {
@@ -41,39 +74,459 @@ func (m *MockSightingRepository) GetUsersByTigerID(tigerID int) ([]int, error) {
 }
 
 func TestCreateSightingHandler(t *testing.T) {
+
 	mockRepo := new(MockSightingRepository)
 	dummyNotificationQueue := make(chan NotificationMessage, 1)
-	handler := CreateSightingHandler(mockRepo,dummyNotificationQueue)
+	images := storage.NewLocalStore(t.TempDir())
+	handler := CreateSightingHandler(mockRepo, images, dummyNotificationQueue)
 
 	// Setup mock behavior
 	mockSighting := &models.Sighting{} 
-	mockRepo.On("GetLastSightingByTigerID", mock.Anything).Return(mockSighting, nil)
+	mockRepo.On("GetTigerByID", 1).Return(&models.Tiger{ID: 1, Status: models.TigerActive}, nil)
+	mockRepo.On("WithinTransaction").Return(nil)
+	mockRepo.On("LockTigerByID", 1).Return(&models.Tiger{ID: 1, Status: models.TigerActive}, nil)
+	mockRepo.On("GetAdjacentSightings", mock.Anything, mock.Anything).Return(mockSighting, (*models.Sighting)(nil), nil)
+	mockRepo.On("GetSightingRule", mock.Anything).Return(models.DefaultSightingRule, nil)
 	mockRepo.On("UpdateTigerLastSeen", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
-	mockRepo.On("SaveSighting", mock.Anything).Return(nil)
+	var imagePath string
+	mockRepo.On("SaveSighting", mock.MatchedBy(func(s models.Sighting) bool { return s.UserID == 7 })).
+		Run(func(args mock.Arguments) { imagePath = args.Get(0).(models.Sighting).ImagePath }).
+		Return(nil)
 	mockRepo.On("GetUsersByTigerID", mock.Anything).Return([]int{}, nil)
 
 	
-	// Simulate a valid sighting JSON payload
+	// Simulate a valid sighting JSON payload. The user_id is ignored in favour of the authenticated user.
 	sighting := models.Sighting{
 		UserID:    1,
 		TigerID:   1,
 		Lat:       10.0,
 		Lon:       20.0,
 		Timestamp: time.Now(),
-		ImagePath: "path/to/dummy/image.jpg", // Added dummy image path
 	}
 
-	payload, _ := json.Marshal(sighting)
-
-	req, _ := http.NewRequest("POST", "/sighting", bytes.NewBuffer(payload))
+	req := newSightingRequest(t, sighting)
+	req = req.WithContext(ContextWithUser(req.Context(), &models.User{ID: 7}))
 	rr := httptest.NewRecorder()
 	handler.ServeHTTP(rr, req)
 	responseBody := rr.Body.String()
 	fmt.Println("Response body:", responseBody)
 	assert.Equal(t, http.StatusCreated, rr.Code)
 	mockRepo.AssertExpectations(t)
+
+	_, err := images.Stat(imagePath)
+	assert.NoError(t, err)
+}
+
+func TestCreateSightingHandler_Unauthenticated(t *testing.T) {
+	mockRepo := new(MockSightingRepository)
+	handler := CreateSightingHandler(mockRepo, storage.NewLocalStore(t.TempDir()), make(chan NotificationMessage, 1))
+
+	sighting := models.Sighting{UserID: 1, TigerID: 1, Lat: 10.0, Lon: 20.0, Timestamp: time.Now()}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newSightingRequest(t, sighting))
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	mockRepo.AssertNotCalled(t, "SaveSighting", mock.Anything)
+}
+
+func TestCreateSightingHandler_FutureTimestamp(t *testing.T) {
+	mockRepo := new(MockSightingRepository)
+	handler := CreateSightingHandler(mockRepo, storage.NewLocalStore(t.TempDir()), make(chan NotificationMessage, 1))
+
+	sighting := models.Sighting{TigerID: 1, Lat: 10.0, Lon: 20.0, Timestamp: time.Date(2099, 1, 1, 0, 0, 0, 0, time.UTC)}
+	req := newSightingRequest(t, sighting)
+	req = req.WithContext(ContextWithUser(req.Context(), &models.User{ID: 7}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	var errResp ErrorResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&errResp))
+	assert.Equal(t, "INVALID_TIMESTAMP", errResp.Code)
+	mockRepo.AssertNotCalled(t, "GetTigerByID", mock.Anything)
+}
+
+func TestValidateSighting_Timestamp(t *testing.T) {
+	tests := []struct {
+		name      string
+		timestamp time.Time
+		valid     bool
+	}{
+		{"Now", time.Now(), true},
+		{"Past", time.Now().Add(-48 * time.Hour), true},
+		{"Within clock skew", time.Now().Add(maxSightingClockSkew / 2), true},
+		{"Beyond clock skew", time.Now().Add(2 * maxSightingClockSkew), false},
+		{"Missing", time.Time{}, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateSighting(models.Sighting{UserID: 7, TigerID: 1, Lat: 10.0, Lon: 20.0, Timestamp: tc.timestamp})
+			if tc.valid {
+				assert.Nil(t, err)
+			} else if assert.NotNil(t, err) {
+				assert.Equal(t, "INVALID_TIMESTAMP", err.Code)
+			}
+		})
+	}
+}
+
+func TestCreateSightingHandler_DeceasedTiger(t *testing.T) {
+
+	mockRepo := new(MockSightingRepository)
+	handler := CreateSightingHandler(mockRepo, storage.NewLocalStore(t.TempDir()), make(chan NotificationMessage, 1))
+	mockRepo.On("GetTigerByID", 1).Return(&models.Tiger{ID: 1, Status: models.TigerDeceased}, nil)
+
+	sighting := models.Sighting{TigerID: 1, Lat: 10.0, Lon: 20.0, Timestamp: time.Now()}
+	req := newSightingRequest(t, sighting)
+	req = req.WithContext(ContextWithUser(req.Context(), &models.User{ID: 7}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	var errResp ErrorResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&errResp))
+	assert.Equal(t, "TIGER_DECEASED", errResp.Code)
+	mockRepo.AssertNotCalled(t, "SaveSighting", mock.Anything)
+}
+
+func TestCreateSightingHandler_MergedTiger(t *testing.T) {
+
+	mockRepo := new(MockSightingRepository)
+	handler := CreateSightingHandler(mockRepo, storage.NewLocalStore(t.TempDir()), make(chan NotificationMessage, 1))
+
+	survivorID := 1
+	mockRepo.On("GetTigerByID", 2).Return(&models.Tiger{ID: 2, Status: models.TigerActive, MergedIntoID: &survivorID}, nil)
+	mockRepo.On("GetTigerByID", 1).Return(&models.Tiger{ID: 1, Status: models.TigerActive}, nil)
+	mockRepo.On("WithinTransaction").Return(nil)
+	mockRepo.On("LockTigerByID", 1).Return(&models.Tiger{ID: 1, Status: models.TigerActive}, nil)
+	mockRepo.On("GetAdjacentSightings", 1, mock.Anything).Return((*models.Sighting)(nil), (*models.Sighting)(nil), nil)
+	mockRepo.On("GetSightingRule", mock.Anything).Return(models.DefaultSightingRule, nil)
+	mockRepo.On("UpdateTigerLastSeen", 1, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	mockRepo.On("SaveSighting", mock.MatchedBy(func(s models.Sighting) bool { return s.TigerID == 1 })).Return(nil)
+
+	sighting := models.Sighting{TigerID: 2, Lat: 10.0, Lon: 20.0, Timestamp: time.Now()}
+	req := newSightingRequest(t, sighting)
+	req = req.WithContext(ContextWithUser(req.Context(), &models.User{ID: 7}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	mockRepo.AssertExpectations(t)
 }
 
+func TestCreateSightingHandler_TooClose(t *testing.T) {
+
+	mockRepo := new(MockSightingRepository)
+	dir := t.TempDir()
+	handler := CreateSightingHandler(mockRepo, storage.NewLocalStore(dir), make(chan NotificationMessage, 1))
+	mockRepo.On("GetTigerByID", 1).Return(&models.Tiger{ID: 1, Status: models.TigerActive}, nil)
+	mockRepo.On("WithinTransaction").Return(nil)
+	mockRepo.On("LockTigerByID", 1).Return(&models.Tiger{ID: 1, Status: models.TigerActive}, nil)
+	mockRepo.On("GetAdjacentSightings", 1, mock.Anything).Return((*models.Sighting)(nil), &models.Sighting{ID: 4, TigerID: 1, Lat: 10.01, Lon: 20.01}, nil)
+	rule := models.SightingRule{ID: 2, Scope: models.RuleScopeReserve, Reserve: "Ranthambore", MinDistanceKm: 2}
+	mockRepo.On("GetSightingRule", 1).Return(rule, nil)
+
+	sighting := models.Sighting{TigerID: 1, Lat: 10.0, Lon: 20.0, Timestamp: time.Now()}
+	req := newSightingRequest(t, sighting)
+	req = req.WithContext(ContextWithUser(req.Context(), &models.User{ID: 7}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	// The rule that applied is reported with the error.
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	var errResp struct {
+		Code    string        `json:"code"`
+		Message string        `json:"message"`
+		Details ruleViolation `json:"details"`
+	}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&errResp))
+	assert.Equal(t, "TOO_CLOSE_TO_PREVIOUS_SIGHTING", errResp.Code)
+	assert.Contains(t, errResp.Message, "at least 2 kilometers apart")
+	assert.Equal(t, rule, errResp.Details.Rule)
+	assert.Equal(t, 4, errResp.Details.SightingID)
+	assert.Equal(t, 1.6, errResp.Details.DistanceKm)
+	mockRepo.AssertNotCalled(t, "UpdateTigerLastSeen", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mockRepo.AssertNotCalled(t, "SaveSighting", mock.Anything)
+
+	// The image of a rejected sighting is not stored.
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
 
+func TestCreateSightingHandler_Backdated(t *testing.T) {
 
+	lastSeen := time.Now().Add(-time.Hour)
+	tiger := &models.Tiger{ID: 1, Status: models.TigerActive, LastSeenTimestamp: lastSeen}
+	mockRepo := new(MockSightingRepository)
+	handler := CreateSightingHandler(mockRepo, storage.NewLocalStore(t.TempDir()), make(chan NotificationMessage, 1))
+	mockRepo.On("GetTigerByID", 1).Return(tiger, nil)
+	mockRepo.On("WithinTransaction").Return(nil)
+	mockRepo.On("LockTigerByID", 1).Return(tiger, nil)
+	mockRepo.On("GetAdjacentSightings", 1, mock.Anything).Return(
+		&models.Sighting{TigerID: 1, Lat: 11.0, Lon: 21.0, Timestamp: lastSeen.Add(-72 * time.Hour)},
+		&models.Sighting{TigerID: 1, Lat: 12.0, Lon: 22.0, Timestamp: lastSeen},
+		nil)
+	mockRepo.On("GetSightingRule", mock.Anything).Return(models.DefaultSightingRule, nil)
+	mockRepo.On("GetUsersByTigerID", 1).Return([]int{}, nil)
+	mockRepo.On("SaveSighting", mock.Anything).Return(nil)
 
+	// The sighting was taken two days ago, between the two sightings above.
+	sighting := models.Sighting{TigerID: 1, Lat: 10.0, Lon: 20.0, Timestamp: lastSeen.Add(-48 * time.Hour)}
+	req := newSightingRequest(t, sighting)
+	req = req.WithContext(ContextWithUser(req.Context(), &models.User{ID: 7}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "UpdateTigerLastSeen", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCreateSightingHandler_ImplausibleSpeed(t *testing.T) {
+
+	taken := time.Now().Add(-time.Hour)
+	previous := &models.Sighting{ID: 5, TigerID: 1, Lat: 12.0, Lon: 22.0, Timestamp: taken.Add(-10 * time.Minute)}
+	newRepo := func() *MockSightingRepository {
+		mockRepo := new(MockSightingRepository)
+		mockRepo.On("GetTigerByID", 1).Return(&models.Tiger{ID: 1, Status: models.TigerActive}, nil)
+		mockRepo.On("WithinTransaction").Return(nil)
+		mockRepo.On("LockTigerByID", 1).Return(&models.Tiger{ID: 1, Status: models.TigerActive}, nil)
+		mockRepo.On("GetAdjacentSightings", 1, mock.Anything).Return(previous, (*models.Sighting)(nil), nil)
+		mockRepo.On("GetSightingRule", mock.Anything).Return(models.DefaultSightingRule, nil)
+		return mockRepo
+	}
+	sighting := models.Sighting{TigerID: 1, Lat: 10.0, Lon: 20.0, Timestamp: taken}
+
+	// By default the sighting is rejected, with the movement in the details.
+	mockRepo := newRepo()
+	req := newSightingRequest(t, sighting)
+	req = req.WithContext(ContextWithUser(req.Context(), &models.User{ID: 7}))
+	rr := httptest.NewRecorder()
+	CreateSightingHandler(mockRepo, storage.NewLocalStore(t.TempDir()), make(chan NotificationMessage, 1)).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	var errResp struct {
+		Code    string         `json:"code"`
+		Details speedViolation `json:"details"`
+	}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&errResp))
+	assert.Equal(t, "IMPLAUSIBLE_SPEED", errResp.Code)
+	assert.Equal(t, 5, errResp.Details.SightingID)
+	assert.Equal(t, float64(defaultMaxSpeedKmh), errResp.Details.MaxSpeedKmh)
+	mockRepo.AssertNotCalled(t, "SaveSighting", mock.Anything)
+
+	// Flagged sightings are recorded with the reason for the review.
+	t.Setenv("SIGHTING_SPEED_ACTION", "flag")
+	mockRepo = newRepo()
+	mockRepo.On("GetUsersByTigerID", 1).Return([]int{}, nil)
+	mockRepo.On("UpdateTigerLastSeen", 1, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	mockRepo.On("SaveSighting", mock.MatchedBy(func(s models.Sighting) bool { return s.ReviewReason != "" })).Return(nil)
+
+	req = newSightingRequest(t, sighting)
+	req = req.WithContext(ContextWithUser(req.Context(), &models.User{ID: 7}))
+	rr = httptest.NewRecorder()
+	CreateSightingHandler(mockRepo, storage.NewLocalStore(t.TempDir()), make(chan NotificationMessage, 1)).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var created models.Sighting
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&created))
+	assert.Contains(t, created.ReviewReason, "from sighting 5")
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCreateSightingHandler_TigerMergedConcurrently(t *testing.T) {
+
+	// The tiger is merged after it was checked but before its row is locked.
+	survivorID := 2
+	mockRepo := new(MockSightingRepository)
+	dir := t.TempDir()
+	handler := CreateSightingHandler(mockRepo, storage.NewLocalStore(dir), make(chan NotificationMessage, 1))
+	mockRepo.On("GetTigerByID", 1).Return(&models.Tiger{ID: 1, Status: models.TigerActive}, nil)
+	mockRepo.On("GetAdjacentSightings", 1, mock.Anything).Return((*models.Sighting)(nil), (*models.Sighting)(nil), nil)
+	mockRepo.On("GetSightingRule", mock.Anything).Return(models.DefaultSightingRule, nil)
+	mockRepo.On("WithinTransaction").Return(nil)
+	mockRepo.On("LockTigerByID", 1).Return(&models.Tiger{ID: 1, Status: models.TigerActive, MergedIntoID: &survivorID}, nil)
+
+	sighting := models.Sighting{TigerID: 1, Lat: 10.0, Lon: 20.0, Timestamp: time.Now()}
+	req := newSightingRequest(t, sighting)
+	req = req.WithContext(ContextWithUser(req.Context(), &models.User{ID: 7}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	var errResp ErrorResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&errResp))
+	assert.Equal(t, "TIGER_MERGED", errResp.Code)
+	mockRepo.AssertNotCalled(t, "SaveSighting", mock.Anything)
+
+	// The image uploaded before the tiger was locked is deleted again.
+	var files []string
+	assert.NoError(t, filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	}))
+	assert.Empty(t, files)
+}
+
+func TestCreateSightingHandler_SaveFailsWithSharedImage(t *testing.T) {
+
+	mockRepo := new(MockSightingRepository)
+	images := storage.NewLocalStore(t.TempDir())
+	handler := CreateSightingHandler(mockRepo, images, make(chan NotificationMessage, 1))
+	mockRepo.On("GetTigerByID", 1).Return(&models.Tiger{ID: 1, Status: models.TigerActive}, nil)
+	mockRepo.On("WithinTransaction").Return(nil)
+	mockRepo.On("LockTigerByID", 1).Return(&models.Tiger{ID: 1, Status: models.TigerActive}, nil)
+	mockRepo.On("GetAdjacentSightings", 1, mock.Anything).Return((*models.Sighting)(nil), (*models.Sighting)(nil), nil)
+	mockRepo.On("GetSightingRule", mock.Anything).Return(models.DefaultSightingRule, nil)
+	mockRepo.On("UpdateTigerLastSeen", 1, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	mockRepo.On("SaveSighting", mock.Anything).Return(fmt.Errorf("disk full"))
+
+	// An earlier sighting uploaded the same image.
+	sighting := models.Sighting{TigerID: 1, Lat: 10.0, Lon: 20.0, Timestamp: time.Now()}
+	req := newSightingRequest(t, sighting)
+	assert.NoError(t, req.ParseMultipartForm(1<<20))
+	file, header, err := req.FormFile("image")
+	assert.NoError(t, err)
+	upload, err := io.ReadAll(file)
+	assert.NoError(t, err)
+	encoded, ext, err := prepareImageUpload(upload, filepath.Ext(header.Filename))
+	assert.NoError(t, err)
+	key, _, err := storeImage(images, encoded, ext)
+	assert.NoError(t, err)
+
+	req = newSightingRequest(t, sighting)
+	req = req.WithContext(ContextWithUser(req.Context(), &models.User{ID: 7}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	_, err = images.Stat(key)
+	assert.NoError(t, err, "the image of the earlier sighting must be kept")
+}
+
+func TestDBSightingRepository_WithinTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	repo := NewDBSightingRepository(db)
+
+	_, err = repo.LockTigerByID(1)
+	assert.Equal(t, errNoTransaction, err)
+
+	// Both rows are written in one transaction, after the tiger is locked.
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM tigers WHERE id = \\$1 FOR UPDATE").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(tigerColumns).AddRow(tigerRowValues(models.Tiger{ID: 1, Name: "Stripes", Status: models.TigerActive})...))
+	mock.ExpectExec("UPDATE tigers SET last_seen_timestamp").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO sightings").WillReturnError(fmt.Errorf("disk full"))
+	mock.ExpectRollback()
+
+	err = repo.WithinTransaction(func(tx SightingRepository) error {
+		if _, err := tx.LockTigerByID(1); err != nil {
+			return err
+		}
+		if err := tx.UpdateTigerLastSeen(1, time.Now(), 10, 20); err != nil {
+			return err
+		}
+		return tx.SaveSighting(models.Sighting{TigerID: 1, Lat: 10, Lon: 20, Timestamp: time.Now()})
+	})
+	assert.EqualError(t, err, "disk full")
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO sightings").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err = repo.WithinTransaction(func(tx SightingRepository) error {
+		return tx.SaveSighting(models.Sighting{TigerID: 1, Lat: 10, Lon: 20, Timestamp: time.Now()})
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDBSightingRepository_GetAdjacentSightings(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	columns := []string{"id", "tiger_id", "lat", "lon", "timestamp", "image_path"}
+	taken := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery("WHERE tiger_id = \\$1 AND timestamp <= \\$2 ORDER BY timestamp DESC, id DESC LIMIT 1").
+		WithArgs(1, taken).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(3, 1, 10.0, 20.0, taken.Add(-time.Hour), ""))
+	mock.ExpectQuery("WHERE tiger_id = \\$1 AND timestamp > \\$2 ORDER BY timestamp, id LIMIT 1").
+		WithArgs(1, taken).
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	before, after, err := NewDBSightingRepository(db).GetAdjacentSightings(1, taken)
+	assert.NoError(t, err)
+	if assert.NotNil(t, before) {
+		assert.Equal(t, 3, before.ID)
+	}
+	assert.Nil(t, after)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListSightingsHandler(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	columns := []string{"id", "tiger_id", "lat", "lon", "timestamp", "image_path", "review_reason"}
+	taken := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	// Existing clients page with page and pageSize and get a plain array.
+	mock.ExpectQuery("FROM sightings WHERE tiger_id = \\$1 ORDER BY timestamp DESC LIMIT \\$2 OFFSET \\$3").
+		WithArgs(1, 5, 5).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(3, 1, 10.0, 20.0, taken, "ab/cd/abcd.png", ""))
+
+	rr := httptest.NewRecorder()
+	ListSightingsHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/sightings/list?tigerID=1&page=2&pageSize=5", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var sightings []models.Sighting
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&sightings))
+	assert.Len(t, sightings, 1)
+	assert.Equal(t, "/images/3", sightings[0].ImageURL)
+
+	// A limit switches to cursors. The last page has no next cursor.
+	mock.ExpectQuery("FROM sightings WHERE tiger_id = \\$1 ORDER BY timestamp DESC, id DESC LIMIT \\$2").
+		WithArgs(1, 6).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(3, 1, 10.0, 20.0, taken, "", ""))
+
+	rr = httptest.NewRecorder()
+	ListSightingsHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/sightings/list?tigerID=1&limit=5", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get("Link"))
+	var page PageResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&page))
+	assert.Len(t, page.Data, 1)
+	assert.Empty(t, page.NextCursor)
+	assert.Empty(t, page.PrevCursor)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// newSightingRequest builds the multipart request CreateSightingHandler expects,
+// with the sighting as JSON and a small PNG as the image.
+func newSightingRequest(t *testing.T, sighting models.Sighting) *http.Request {
+	payload, err := json.Marshal(sighting)
+	assert.NoError(t, err)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	assert.NoError(t, writer.WriteField("sightingInfo", string(payload)))
+
+	part, err := writer.CreateFormFile("image", "tiger.png")
+	assert.NoError(t, err)
+	assert.NoError(t, png.Encode(part, image.NewRGBA(image.Rect(0, 0, 10, 10))))
+	assert.NoError(t, writer.Close())
+
+	req, _ := http.NewRequest("POST", "/sighting", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
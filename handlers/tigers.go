@@ -4,8 +4,16 @@ import (
 
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/ravirajdarisi/tigerhall-kittens/models"
 )
@@ -25,17 +33,40 @@ func CreateTigerHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		// New tigers always start out active.
+		newTiger.Status = models.TigerActive
+		newTiger.StatusReason = ""
+		newTiger.StatusEffectiveAt = nil
+		newTiger.MergedIntoID = nil
+		normalizeTiger(&newTiger)
+
 		// Validate the input data.
-		if newTiger.Name == "" || newTiger.DateOfBirth.IsZero() ||
-		   newTiger.LastSeenTimestamp.IsZero() ||
-		   newTiger.LastSeenLat < -90 || newTiger.LastSeenLat > 90 || newTiger.LastSeenLat == 0 ||
-		   newTiger.LastSeenLon < -180 || newTiger.LastSeenLon > 180 || newTiger.LastSeenLon == 0 {
-			http.Error(w, "Missing or invalid tiger details: Ensure all fields are present and latitude/longitude are within valid ranges", http.StatusBadRequest)
+		if validationErr := validateTiger(newTiger); validationErr != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(validationErr)
+			return
+		}
+		if validationErr, err := validateParents(db, &newTiger); err != nil {
+			http.Error(w, "Error checking tiger parents", http.StatusInternalServerError)
+			return
+		} else if validationErr != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(validationErr)
 			return
 		}
 
 		// Insert the new tiger record into the database.
 		err = newTiger.Save(db)
+		if err == models.ErrDuplicateTigerName {
+			writeErrorResponse(w, http.StatusConflict, "DUPLICATE_TIGER_NAME", "Another tiger already has this name.")
+			return
+		}
+		if err == models.ErrDuplicateIdentificationCode {
+			writeErrorResponse(w, http.StatusConflict, "DUPLICATE_IDENTIFICATION_CODE", "One of the identification codes already belongs to another tiger.")
+			return
+		}
 		if err != nil {
 			http.Error(w, "Error saving tiger to the database", http.StatusInternalServerError)
 			return
@@ -48,31 +79,771 @@ func CreateTigerHandler(db *sql.DB) http.HandlerFunc {
 }
 
 
+// ListAllTigersHandler lists the tigers matching the filters in the query
+// string. Requests with a cursor or limit parameter are paginated with cursors,
+// others with page and pageSize.
 func ListAllTigersHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Parse pagination parameters
-		page, err := strconv.Atoi(r.URL.Query().Get("page"))
-		if err != nil || page < 1 {
-			page = 1 // Default to the first page if not specified or invalid
+		var sort models.TigerSort
+		var page pageRequest
+
+		filter, validationErr := parseTigerFilter(r.URL.Query())
+		if validationErr == nil {
+			sort, validationErr = parseTigerSort(r.URL.Query().Get("sort"))
+		}
+		if validationErr == nil {
+			page, validationErr = parsePageRequest(r.URL.Query())
+		}
+		if validationErr != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(validationErr)
+			return
 		}
 
-		pageSize, err := strconv.Atoi(r.URL.Query().Get("pageSize"))
-		if err != nil || pageSize <= 0 {
-			pageSize = 10 // Default page size or enforce a maximum to prevent overly large requests
+		// Retrieve paginated tigers from the database.
+		var tigers []models.Tiger
+		var more bool
+		var err error
+		if page.Keyset {
+			tigers, more, err = models.GetTigersPage(db, page.Limit, filter, sort, page.Cursor)
+		} else {
+			tigers, err = models.GetAllTigers(db, page.Limit, page.Offset, filter, sort)
+		}
+		if err == models.ErrInvalidCursor {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(invalidCursorResponse)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error retrieving tigers from the database", http.StatusInternalServerError)
+			return
+		}
+		total, err := models.CountTigers(db, filter)
+		if err != nil {
+			http.Error(w, "Error counting tigers in the database", http.StatusInternalServerError)
+			return
+		}
+		if tigers == nil {
+			tigers = []models.Tiger{}
 		}
 
-		// Calculate offset
-		offset := (page - 1) * pageSize
+		// Respond to the request with the list of tigers and the number of tigers on all pages.
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		if page.Keyset {
+			var prev, next *models.Cursor
+			if len(tigers) > 0 {
+				prev, next = page.adjacent(sort.Cursor(tigers[0], true), sort.Cursor(tigers[len(tigers)-1], false), more)
+			}
+			writePage(w, r, tigers, page.Limit, prev, next)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tigers)
+	}
+}
 
-		// Retrieve paginated tigers from the database.
-		tigers, err := models.GetAllTigers(db, pageSize, offset)
+const (
+	defaultNearbyRadiusKm = 20
+	maxNearbyRadiusKm     = 500
+	defaultNearbyLimit    = 20
+)
+
+// NearbyTigersHandler lists the tigers last seen within radiusKm of a point,
+// nearest first, as in /tigers/nearby?lat=21.1&lon=79.0&radiusKm=20. The
+// filters of /tigers/list apply too, except bbox.
+func NearbyTigersHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		lat, latErr := strconv.ParseFloat(query.Get("lat"), 64)
+		lon, lonErr := strconv.ParseFloat(query.Get("lon"), 64)
+		if latErr != nil || lonErr != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+			writeErrorResponse(w, http.StatusBadRequest, "INVALID_LOCATION", "lat must be between -90 and 90 and lon between -180 and 180.")
+			return
+		}
+
+		radiusKm := float64(defaultNearbyRadiusKm)
+		if raw := query.Get("radiusKm"); raw != "" {
+			var err error
+			radiusKm, err = strconv.ParseFloat(raw, 64)
+			if err != nil || radiusKm <= 0 || radiusKm > maxNearbyRadiusKm {
+				writeErrorResponse(w, http.StatusBadRequest, "INVALID_RADIUS", fmt.Sprintf("radiusKm must be greater than 0 and at most %d.", maxNearbyRadiusKm))
+				return
+			}
+		}
+
+		limit := defaultNearbyLimit
+		if raw := query.Get("limit"); raw != "" {
+			var err error
+			limit, err = strconv.Atoi(raw)
+			if err != nil || limit < 1 || limit > models.MaxPageSize {
+				writeErrorResponse(w, http.StatusBadRequest, "INVALID_LIMIT", fmt.Sprintf("Limit must be between 1 and %d.", models.MaxPageSize))
+				return
+			}
+		}
+
+		query.Del("bbox")
+		filter, validationErr := parseTigerFilter(query)
+		if validationErr != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(validationErr)
+			return
+		}
+
+		tigers, err := models.GetTigersNear(db, lat, lon, radiusKm, limit, filter)
 		if err != nil {
 			http.Error(w, "Error retrieving tigers from the database", http.StatusInternalServerError)
 			return
 		}
 
-		// Respond to the request with the list of tigers.
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(tigers)
 	}
 }
+
+// parseTigerFilter reads the filters of /tigers/list from the query string.
+// Deceased tigers are only listed on request.
+func parseTigerFilter(query url.Values) (models.TigerFilter, *ErrorResponse) {
+	filter := models.TigerFilter{
+		IncludeDeceased:    query.Get("includeDeceased") == "true",
+		Search:             strings.TrimSpace(query.Get("q")),
+		Sex:                models.TigerSex(strings.ToLower(query.Get("sex"))),
+		Subspecies:         models.TigerSubspecies(strings.ToLower(query.Get("subspecies"))),
+		IdentificationCode: strings.TrimSpace(query.Get("identificationCode")),
+		Alias:              strings.TrimSpace(query.Get("alias")),
+		Tags:               normalizeList(query["tag"], strings.ToLower),
+	}
+	if filter.Sex != "" && !filter.Sex.Valid() {
+		return filter, &ErrorResponse{Code: "INVALID_SEX", Message: "Sex must be one of female, male or unknown."}
+	}
+	if !filter.Subspecies.Valid() {
+		return filter, &ErrorResponse{Code: "INVALID_SUBSPECIES", Message: "Subspecies must be one of bengal, amur, indochinese, malayan, south_china or sumatran."}
+	}
+
+	for _, status := range normalizeList(query["status"], strings.ToLower) {
+		if !models.TigerStatus(status).Valid() {
+			return filter, &ErrorResponse{Code: "INVALID_STATUS", Message: "Status must be one of active, missing, deceased or relocated."}
+		}
+		filter.Statuses = append(filter.Statuses, models.TigerStatus(status))
+	}
+
+	var err error
+	if filter.LastSeenFrom, err = parseTimeParam(query.Get("lastSeenFrom"), false); err != nil {
+		return filter, &ErrorResponse{Code: "INVALID_DATE_RANGE", Message: "lastSeenFrom must be a date (2006-01-02) or a timestamp (RFC 3339)."}
+	}
+	if filter.LastSeenTo, err = parseTimeParam(query.Get("lastSeenTo"), true); err != nil {
+		return filter, &ErrorResponse{Code: "INVALID_DATE_RANGE", Message: "lastSeenTo must be a date (2006-01-02) or a timestamp (RFC 3339)."}
+	}
+	if filter.LastSeenFrom != nil && filter.LastSeenTo != nil && filter.LastSeenFrom.After(*filter.LastSeenTo) {
+		return filter, &ErrorResponse{Code: "INVALID_DATE_RANGE", Message: "lastSeenFrom must not be after lastSeenTo."}
+	}
+
+	if raw := query.Get("bbox"); raw != "" {
+		area, ok := parseBoundingBox(raw)
+		if !ok {
+			return filter, &ErrorResponse{Code: "INVALID_BBOX", Message: "bbox must be minLon,minLat,maxLon,maxLat with valid coordinates and minLat not above maxLat."}
+		}
+		filter.Area = area
+	}
+	return filter, nil
+}
+
+// parseTimeParam parses a timestamp or a date from the query string. A date
+// stands for its first moment, or its last one when it ends a range.
+func parseTimeParam(raw string, endOfDay bool) (*time.Time, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return &t, nil
+}
+
+// parseBoundingBox parses a bounding box in the minLon,minLat,maxLon,maxLat
+// order of GeoJSON. minLon may exceed maxLon for boxes across the antimeridian.
+func parseBoundingBox(raw string) (*models.BoundingBox, bool) {
+	parts := strings.Split(raw, ",")
+	if len(parts) != 4 {
+		return nil, false
+	}
+	var coords [4]float64
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, false
+		}
+		coords[i] = v
+	}
+	box := &models.BoundingBox{MinLon: coords[0], MinLat: coords[1], MaxLon: coords[2], MaxLat: coords[3]}
+	for _, lat := range []float64{box.MinLat, box.MaxLat} {
+		if lat < -90 || lat > 90 {
+			return nil, false
+		}
+	}
+	for _, lon := range []float64{box.MinLon, box.MaxLon} {
+		if lon < -180 || lon > 180 {
+			return nil, false
+		}
+	}
+	if box.MinLat > box.MaxLat {
+		return nil, false
+	}
+	return box, true
+}
+
+// parseTigerSort reads the sort parameter of /tigers/list, such as "name" or
+// "-lastSeen" for descending order.
+func parseTigerSort(raw string) (models.TigerSort, *ErrorResponse) {
+	if raw == "" {
+		return models.TigerSort{}, nil
+	}
+	sort := models.TigerSort{Field: models.TigerSortField(strings.TrimPrefix(raw, "-")), Descending: strings.HasPrefix(raw, "-")}
+	if sort.Field == "" || !sort.Valid() {
+		return sort, &ErrorResponse{Code: "INVALID_SORT", Message: "Sort must be one of lastSeen, name, dateOfBirth or id, optionally prefixed with '-' for descending order."}
+	}
+	return sort, nil
+}
+
+// TigerDetailResponse is a tiger together with statistics about its sightings.
+type TigerDetailResponse struct {
+	models.Tiger
+	Summary models.TigerSummary `json:"summary"`
+}
+
+// GetTigerHandler returns the tiger with the ID in the path, as in /tigers/42.
+// Lookups of a tiger that was merged into another are redirected to the survivor.
+func GetTigerHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r, "/tigers/")
+		if err != nil {
+			writeErrorResponse(w, http.StatusNotFound, "TIGER_NOT_FOUND", "No tiger exists with this ID.")
+			return
+		}
+
+		tiger, err := models.GetTigerByID(db, id)
+		if err == sql.ErrNoRows {
+			writeErrorResponse(w, http.StatusNotFound, "TIGER_NOT_FOUND", "No tiger exists with this ID.")
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error retrieving tiger from the database", http.StatusInternalServerError)
+			return
+		}
+		if tiger.Merged() {
+			http.Redirect(w, r, "/tigers/"+strconv.Itoa(*tiger.MergedIntoID), http.StatusMovedPermanently)
+			return
+		}
+
+		summary, err := models.GetTigerSummary(db, id)
+		if err != nil {
+			http.Error(w, "Error retrieving tiger sightings from the database", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(TigerDetailResponse{Tiger: *tiger, Summary: *summary})
+	}
+}
+
+// UpdateTigerRequest holds the fields of PATCH /tigers/{id}. Fields left out of
+// the request are not changed.
+type UpdateTigerRequest struct {
+	Name              *string             `json:"name"`
+	DateOfBirth       *time.Time          `json:"date_of_birth"`
+	LastSeenTimestamp *time.Time          `json:"last_seen_timestamp"`
+	LastSeenLat       *float64            `json:"last_seen_lat"`
+	LastSeenLon       *float64            `json:"last_seen_lon"`
+	Status            *models.TigerStatus `json:"status"`
+	StatusReason      *string             `json:"status_reason"`
+	StatusEffectiveAt *time.Time          `json:"status_effective_at"`
+	MotherID          optionalID          `json:"mother_id"`
+	FatherID          optionalID          `json:"father_id"`
+
+	Sex                 *models.TigerSex        `json:"sex"`
+	Subspecies          *models.TigerSubspecies `json:"subspecies"`
+	DistinguishingMarks *string                 `json:"distinguishing_marks"`
+	StripeNotes         *string                 `json:"stripe_notes"`
+	Reserve             *string                 `json:"reserve"`
+	Sensitive           *bool                   `json:"sensitive"`
+	IdentificationCodes *[]string               `json:"identification_codes"`
+	Aliases             *[]string               `json:"aliases"`
+	Tags                *[]string               `json:"tags"`
+}
+
+// optionalID is an ID field of a partial update. It tells a field that was left
+// out of the request apart from one that was explicitly set to null.
+type optionalID struct {
+	Set bool
+	ID  *int
+}
+
+func (o *optionalID) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	return json.Unmarshal(data, &o.ID)
+}
+
+// apply copies the fields present in the request onto the tiger. A status
+// change without an effective date takes effect now.
+func (req UpdateTigerRequest) apply(tiger *models.Tiger) {
+	if req.Name != nil {
+		tiger.Name = *req.Name
+	}
+	if req.DateOfBirth != nil {
+		tiger.DateOfBirth = *req.DateOfBirth
+	}
+	if req.LastSeenTimestamp != nil {
+		tiger.LastSeenTimestamp = *req.LastSeenTimestamp
+	}
+	if req.LastSeenLat != nil {
+		tiger.LastSeenLat = *req.LastSeenLat
+	}
+	if req.LastSeenLon != nil {
+		tiger.LastSeenLon = *req.LastSeenLon
+	}
+	if req.Status != nil && *req.Status != tiger.Status {
+		tiger.Status = *req.Status
+		tiger.StatusReason = ""
+		now := time.Now()
+		tiger.StatusEffectiveAt = &now
+	}
+	if req.StatusReason != nil {
+		tiger.StatusReason = strings.TrimSpace(*req.StatusReason)
+	}
+	if req.StatusEffectiveAt != nil {
+		tiger.StatusEffectiveAt = req.StatusEffectiveAt
+	}
+	if req.MotherID.Set {
+		tiger.MotherID = req.MotherID.ID
+	}
+	if req.FatherID.Set {
+		tiger.FatherID = req.FatherID.ID
+	}
+	if req.Sex != nil {
+		tiger.Sex = *req.Sex
+	}
+	if req.Subspecies != nil {
+		tiger.Subspecies = *req.Subspecies
+	}
+	if req.DistinguishingMarks != nil {
+		tiger.DistinguishingMarks = *req.DistinguishingMarks
+	}
+	if req.StripeNotes != nil {
+		tiger.StripeNotes = *req.StripeNotes
+	}
+	if req.Reserve != nil {
+		tiger.Reserve = *req.Reserve
+	}
+	if req.Sensitive != nil {
+		tiger.Sensitive = *req.Sensitive
+	}
+	if req.IdentificationCodes != nil {
+		tiger.IdentificationCodes = *req.IdentificationCodes
+	}
+	if req.Aliases != nil {
+		tiger.Aliases = *req.Aliases
+	}
+	if req.Tags != nil {
+		tiger.Tags = *req.Tags
+	}
+	normalizeTiger(tiger)
+}
+
+// normalizeTiger trims the descriptive fields of a tiger, lower-cases its sex,
+// subspecies and tags, and drops empty and repeated entries from its lists.
+func normalizeTiger(tiger *models.Tiger) {
+	tiger.Sex = models.TigerSex(strings.ToLower(strings.TrimSpace(string(tiger.Sex))))
+	if tiger.Sex == "" {
+		tiger.Sex = models.TigerSexUnknown
+	}
+	tiger.Subspecies = models.TigerSubspecies(strings.ToLower(strings.TrimSpace(string(tiger.Subspecies))))
+	tiger.DistinguishingMarks = strings.TrimSpace(tiger.DistinguishingMarks)
+	tiger.StripeNotes = strings.TrimSpace(tiger.StripeNotes)
+	tiger.Reserve = strings.TrimSpace(tiger.Reserve)
+	tiger.IdentificationCodes = normalizeList(tiger.IdentificationCodes, nil)
+	tiger.Aliases = normalizeList(tiger.Aliases, nil)
+	tiger.Tags = normalizeList(tiger.Tags, strings.ToLower)
+}
+
+// normalizeList trims the entries of a list, applies transform to them when it
+// is set, and drops empty and repeated entries. The result is never nil.
+func normalizeList(values []string, transform func(string) string) []string {
+	seen := make(map[string]bool, len(values))
+	result := []string{}
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if transform != nil {
+			v = transform(v)
+		}
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		result = append(result, v)
+	}
+	return result
+}
+
+// errInvalidTiger stops UpdateTiger when the patched tiger does not pass validation.
+var errInvalidTiger = errors.New("invalid tiger")
+
+// UpdateTigerHandler corrects the details of the tiger with the ID in the path
+// or moves it to another status, as in PATCH /tigers/42.
+func UpdateTigerHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r, "/tigers/")
+		if err != nil {
+			writeErrorResponse(w, http.StatusNotFound, "TIGER_NOT_FOUND", "No tiger exists with this ID.")
+			return
+		}
+
+		var req UpdateTigerRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid tiger data", http.StatusBadRequest)
+			return
+		}
+
+		// The patch is applied to the locked row, so it can not undo a sighting
+		// or a merge that happened after the request was sent.
+		var validationErr *ErrorResponse
+		tiger, err := models.UpdateTiger(db, id, func(tiger *models.Tiger) error {
+			req.apply(tiger)
+			if validationErr = validateTiger(*tiger); validationErr != nil {
+				return errInvalidTiger
+			}
+			var err error
+			if validationErr, err = validateParents(db, tiger); err != nil {
+				return err
+			} else if validationErr != nil {
+				return errInvalidTiger
+			}
+			return nil
+		})
+		if err == sql.ErrNoRows {
+			writeErrorResponse(w, http.StatusNotFound, "TIGER_NOT_FOUND", "No tiger exists with this ID.")
+			return
+		}
+		if err == models.ErrTigerAlreadyMerged {
+			writeErrorResponse(w, http.StatusConflict, "TIGER_MERGED", fmt.Sprintf("This tiger was merged into tiger %d. Update that one instead.", *tiger.MergedIntoID))
+			return
+		}
+		if err == errInvalidTiger {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(validationErr)
+			return
+		}
+		if err == models.ErrDuplicateTigerName {
+			writeErrorResponse(w, http.StatusConflict, "DUPLICATE_TIGER_NAME", "Another tiger already has this name.")
+			return
+		}
+		if err == models.ErrDuplicateIdentificationCode {
+			writeErrorResponse(w, http.StatusConflict, "DUPLICATE_IDENTIFICATION_CODE", "One of the identification codes already belongs to another tiger.")
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error updating tiger in the database", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tiger)
+	}
+}
+
+const (
+	maxTigerNotesLength = 2000
+	maxTigerListLength  = 20
+	maxAliasLength      = 255
+	maxTagLength        = 32
+	maxReserveLength    = 100
+)
+
+var identificationCodePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:/-]{0,63}$`)
+
+// validateTiger checks a tiger before it is created or updated.
+func validateTiger(tiger models.Tiger) *ErrorResponse {
+	if strings.TrimSpace(tiger.Name) == "" {
+		return &ErrorResponse{
+			Code:    "INVALID_NAME",
+			Message: "Name is required.",
+		}
+	}
+
+	if tiger.DateOfBirth.IsZero() || tiger.DateOfBirth.After(time.Now()) {
+		return &ErrorResponse{
+			Code:    "INVALID_DATE_OF_BIRTH",
+			Message: "Date of birth is required and must not be in the future.",
+		}
+	}
+
+	if tiger.LastSeenTimestamp.IsZero() {
+		return &ErrorResponse{
+			Code:    "INVALID_TIMESTAMP",
+			Message: "Last seen timestamp is required and must be a valid date.",
+		}
+	}
+
+	if tiger.LastSeenLat < -90 || tiger.LastSeenLat > 90 || tiger.LastSeenLat == 0 {
+		return &ErrorResponse{
+			Code:    "INVALID_LATITUDE",
+			Message: "Latitude must be between -90 and 90 and not zero.",
+		}
+	}
+
+	if tiger.LastSeenLon < -180 || tiger.LastSeenLon > 180 || tiger.LastSeenLon == 0 {
+		return &ErrorResponse{
+			Code:    "INVALID_LONGITUDE",
+			Message: "Longitude must be between -180 and 180 and not zero.",
+		}
+	}
+
+	if !tiger.Status.Valid() {
+		return &ErrorResponse{
+			Code:    "INVALID_STATUS",
+			Message: "Status must be one of active, missing, deceased or relocated.",
+		}
+	}
+
+	if tiger.Status != models.TigerActive && tiger.StatusReason == "" {
+		return &ErrorResponse{
+			Code:    "MISSING_STATUS_REASON",
+			Message: "A reason is required when a tiger is not active.",
+		}
+	}
+
+	if effective := tiger.StatusEffectiveAt; effective != nil && (effective.After(time.Now()) || effective.Before(tiger.DateOfBirth)) {
+		return &ErrorResponse{
+			Code:    "INVALID_STATUS_DATE",
+			Message: "The status effective date must be between the date of birth and now.",
+		}
+	}
+
+	if !tiger.Sex.Valid() {
+		return &ErrorResponse{
+			Code:    "INVALID_SEX",
+			Message: "Sex must be one of female, male or unknown.",
+		}
+	}
+
+	if !tiger.Subspecies.Valid() {
+		return &ErrorResponse{
+			Code:    "INVALID_SUBSPECIES",
+			Message: "Subspecies must be one of bengal, amur, indochinese, malayan, south_china or sumatran.",
+		}
+	}
+
+	if utf8.RuneCountInString(tiger.DistinguishingMarks) > maxTigerNotesLength || utf8.RuneCountInString(tiger.StripeNotes) > maxTigerNotesLength {
+		return &ErrorResponse{
+			Code:    "INVALID_NOTES",
+			Message: fmt.Sprintf("Distinguishing marks and stripe notes can be at most %d characters long.", maxTigerNotesLength),
+		}
+	}
+
+	if utf8.RuneCountInString(tiger.Reserve) > maxReserveLength {
+		return &ErrorResponse{
+			Code:    "INVALID_RESERVE",
+			Message: fmt.Sprintf("Reserve can be at most %d characters long.", maxReserveLength),
+		}
+	}
+
+	if len(tiger.IdentificationCodes) > maxTigerListLength {
+		return &ErrorResponse{
+			Code:    "INVALID_IDENTIFICATION_CODE",
+			Message: fmt.Sprintf("A tiger can have at most %d identification codes.", maxTigerListLength),
+		}
+	}
+	for _, code := range tiger.IdentificationCodes {
+		if !identificationCodePattern.MatchString(code) {
+			return &ErrorResponse{
+				Code:    "INVALID_IDENTIFICATION_CODE",
+				Message: "Identification codes can only contain letters, digits, '-', '_', '.', ':' and '/', and be at most 64 characters long.",
+			}
+		}
+	}
+
+	if len(tiger.Aliases) > maxTigerListLength {
+		return &ErrorResponse{
+			Code:    "INVALID_ALIAS",
+			Message: fmt.Sprintf("A tiger can have at most %d aliases.", maxTigerListLength),
+		}
+	}
+	for _, alias := range tiger.Aliases {
+		if utf8.RuneCountInString(alias) > maxAliasLength || strings.EqualFold(alias, strings.TrimSpace(tiger.Name)) {
+			return &ErrorResponse{
+				Code:    "INVALID_ALIAS",
+				Message: fmt.Sprintf("Aliases can be at most %d characters long and must differ from the name.", maxAliasLength),
+			}
+		}
+	}
+
+	if len(tiger.Tags) > maxTigerListLength {
+		return &ErrorResponse{
+			Code:    "INVALID_TAG",
+			Message: fmt.Sprintf("A tiger can have at most %d tags.", maxTigerListLength),
+		}
+	}
+	for _, tag := range tiger.Tags {
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return &ErrorResponse{
+				Code:    "INVALID_TAG",
+				Message: fmt.Sprintf("Tags can be at most %d characters long.", maxTagLength),
+			}
+		}
+	}
+
+	// All validations passed
+	return nil
+}
+
+// MergeTigersHandler folds a duplicate tiger into the tiger it turned out to be.
+// All sightings move to the survivor and the duplicate's name becomes an alias.
+func MergeTigersHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			SourceID int `json:"source_id"`
+			TargetID int `json:"target_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SourceID <= 0 || req.TargetID <= 0 {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		survivor, err := models.MergeTigers(db, req.SourceID, req.TargetID)
+		switch err {
+		case nil:
+		case sql.ErrNoRows:
+			writeErrorResponse(w, http.StatusNotFound, "TIGER_NOT_FOUND", "No tiger exists with this ID.")
+			return
+		case models.ErrMergeSameTiger:
+			writeErrorResponse(w, http.StatusBadRequest, "INVALID_MERGE", "A tiger can not be merged into itself.")
+			return
+		case models.ErrTigerAlreadyMerged:
+			writeErrorResponse(w, http.StatusConflict, "TIGER_MERGED", "One of the tigers has already been merged.")
+			return
+		default:
+			// The parents and cubs of the duplicate may not fit the survivor's lineage.
+			if lineageErr := lineageErrorResponse(err); lineageErr != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(lineageErr)
+				return
+			}
+			http.Error(w, "Error merging tigers", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Merged tiger %d into tiger %d", req.SourceID, req.TargetID)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(survivor)
+	}
+}
+
+// validateParents checks the mother and father of a tiger against the database.
+// Problems with the lineage are returned as an ErrorResponse, failures to check
+// it as an error.
+func validateParents(db *sql.DB, tiger *models.Tiger) (*ErrorResponse, error) {
+	err := models.ValidateParents(db, tiger)
+	if err == nil {
+		return nil, nil
+	}
+	if lineageErr := lineageErrorResponse(err); lineageErr != nil {
+		return lineageErr, nil
+	}
+	return nil, err
+}
+
+// lineageErrorResponse describes an error of models.ValidateParents, or returns
+// nil for other errors.
+func lineageErrorResponse(err error) *ErrorResponse {
+	switch err {
+	case models.ErrParentNotFound:
+		return &ErrorResponse{Code: "PARENT_NOT_FOUND", Message: "The mother or father does not exist."}
+	case models.ErrParentIsSelf:
+		return &ErrorResponse{Code: "INVALID_PARENT", Message: "A tiger can not be its own parent."}
+	case models.ErrLineageCycle:
+		return &ErrorResponse{Code: "LINEAGE_CYCLE", Message: "The mother or father is a descendant of this tiger."}
+	case models.ErrParentTooYoung:
+		return &ErrorResponse{Code: "PARENT_TOO_YOUNG", Message: "A tiger can not be born before its mother or father."}
+	case models.ErrChildTooOld:
+		return &ErrorResponse{Code: "CUB_TOO_OLD", Message: "A tiger must be born before all of its cubs."}
+	case models.ErrParentSex:
+		return &ErrorResponse{Code: "INVALID_PARENT_SEX", Message: "The mother can not be male and the father can not be female."}
+	}
+	return nil
+}
+
+const (
+	defaultFamilyDepth = 3
+	maxFamilyDepth     = 10
+)
+
+// FamilyResponse lists the ancestors and descendants of a tiger.
+type FamilyResponse struct {
+	Tiger       models.Tiger          `json:"tiger"`
+	Depth       int                   `json:"depth"`
+	Ancestors   []models.FamilyMember `json:"ancestors"`
+	Descendants []models.FamilyMember `json:"descendants"`
+}
+
+// GetTigerFamilyHandler returns the ancestors and descendants of the tiger with
+// the ID in the path, as in /tigers/42/family?depth=2.
+func GetTigerFamilyHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r, "/tigers/")
+		if err != nil {
+			writeErrorResponse(w, http.StatusNotFound, "TIGER_NOT_FOUND", "No tiger exists with this ID.")
+			return
+		}
+
+		depth := defaultFamilyDepth
+		if raw := r.URL.Query().Get("depth"); raw != "" {
+			depth, err = strconv.Atoi(raw)
+			if err != nil || depth < 1 || depth > maxFamilyDepth {
+				writeErrorResponse(w, http.StatusBadRequest, "INVALID_DEPTH", fmt.Sprintf("Depth must be between 1 and %d.", maxFamilyDepth))
+				return
+			}
+		}
+
+		tiger, err := models.GetTigerByID(db, id)
+		if err == sql.ErrNoRows {
+			writeErrorResponse(w, http.StatusNotFound, "TIGER_NOT_FOUND", "No tiger exists with this ID.")
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error retrieving tiger from the database", http.StatusInternalServerError)
+			return
+		}
+		if tiger.Merged() {
+			target := fmt.Sprintf("/tigers/%d/family", *tiger.MergedIntoID)
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+
+		ancestors, err := models.GetTigerAncestors(db, id, depth)
+		if err != nil {
+			http.Error(w, "Error retrieving tiger ancestors from the database", http.StatusInternalServerError)
+			return
+		}
+		descendants, err := models.GetTigerDescendants(db, id, depth)
+		if err != nil {
+			http.Error(w, "Error retrieving tiger descendants from the database", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(FamilyResponse{Tiger: *tiger, Depth: depth, Ancestors: ancestors, Descendants: descendants})
+	}
+}
@@ -3,13 +3,16 @@ package handlers
 import (
 	"bytes"
 	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 	"github.com/ravirajdarisi/tigerhall-kittens/models"
 	"github.com/stretchr/testify/assert"
 )
@@ -19,6 +22,7 @@ func TestCreateTigerHandler(t *testing.T) {
 	
 	db, mock := setupMockDB(t) 
 
+	mock.ExpectBegin()
 	mock.ExpectQuery("INSERT INTO tigers").
     WithArgs(
         sqlmock.AnyArg(), // Name
@@ -26,7 +30,17 @@ func TestCreateTigerHandler(t *testing.T) {
         sqlmock.AnyArg(), // LastSeenTimestamp
         sqlmock.AnyArg(), // LastSeenLat
         sqlmock.AnyArg() , // LastSeenLon
+        nil, // MotherID
+        nil, // FatherID
+        models.TigerSexUnknown, // Sex
+        models.TigerSubspecies(""), // Subspecies
+        "", // DistinguishingMarks
+        "", // StripeNotes
+        pq.StringArray{}, // Tags
+        "", // Reserve
+        false, // Sensitive
     ).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1)) 
+	mock.ExpectCommit()
 	handler := CreateTigerHandler(db)
 
 	tests := []struct {
@@ -98,11 +112,14 @@ func TestListAllTigersHandler(t *testing.T) {
 	lastSeenTimestampTwo, _ := time.Parse(layout, "2021-02-02")
 
 	// Mock the GetAllTigers query
-	rows := sqlmock.NewRows([]string{"id", "name", "date_of_birth", "last_seen_timestamp", "last_seen_lat", "last_seen_lon"}).
-		AddRow(1, "TigerOne", dateOfBirthOne, lastSeenTimestampOne, 10.123, 20.123).
-		AddRow(2, "TigerTwo", dateOfBirthTwo, lastSeenTimestampTwo, 30.123, 40.123)
-	mock.ExpectQuery("^SELECT id, name, date_of_birth, last_seen_timestamp, last_seen_lat, last_seen_lon FROM tigers").
+	rows := mockTigerRows(
+		models.Tiger{ID: 1, Name: "TigerOne", DateOfBirth: dateOfBirthOne, LastSeenTimestamp: lastSeenTimestampOne, LastSeenLat: 10.123, LastSeenLon: 20.123},
+		models.Tiger{ID: 2, Name: "TigerTwo", DateOfBirth: dateOfBirthTwo, LastSeenTimestamp: lastSeenTimestampTwo, LastSeenLat: 30.123, LastSeenLon: 40.123})
+	mock.ExpectQuery("^SELECT (.+) FROM tigers").
+		WithArgs(2, 0).
 		WillReturnRows(rows)
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM tigers").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
 
 	handler := ListAllTigersHandler(db)
 
@@ -116,6 +133,628 @@ func TestListAllTigersHandler(t *testing.T) {
 
 	// Check the status code is what we expect.
 	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "5", rr.Header().Get("X-Total-Count"))
+}
+
+func TestListAllTigersHandler_Filters(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery("WHERE merged_into_id IS NULL AND status <> 'deceased' AND sex = \\$3 AND tags @> \\$4").
+		WithArgs(10, 0, models.TigerFemale, pq.StringArray{"collared", "cub"}).
+		WillReturnRows(mockTigerRows(models.Tiger{ID: 1, Name: "TigerOne", Sex: models.TigerFemale, Tags: []string{"collared", "cub"}}))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM tigers").
+		WithArgs(models.TigerFemale, pq.StringArray{"collared", "cub"}).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	rr := httptest.NewRecorder()
+	ListAllTigersHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/tigers/list?sex=Female&tag=collared&tag=CUB", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var got []models.Tiger
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&got))
+	assert.Len(t, got, 1)
+	assert.Equal(t, []string{"collared", "cub"}, got[0].Tags)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListAllTigersHandler_SearchAndSort(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	lastSeenTo := time.Date(2024, 3, 31, 23, 59, 59, 999999999, time.UTC)
+	mock.ExpectQuery("WHERE merged_into_id IS NULL AND status = ANY\\(\\$3\\) AND \\(name ILIKE \\$4 (.+) AND last_seen_timestamp <= \\$5 " +
+		"AND last_seen_lat BETWEEN \\$6 AND \\$7 AND last_seen_lon BETWEEN \\$8 AND \\$9 ORDER BY date_of_birth DESC, id DESC").
+		WithArgs(10, 0, pq.StringArray{"missing"}, "%stripe%", lastSeenTo, 21.0, 22.0, 78.0, 79.5).
+		WillReturnRows(mockTigerRows())
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM tigers").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	rr := httptest.NewRecorder()
+	target := "/tigers/list?q=stripe&status=missing&lastSeenTo=2024-03-31&bbox=78,21,79.5,22&sort=-dateOfBirth"
+	ListAllTigersHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "0", rr.Header().Get("X-Total-Count"))
+	assert.JSONEq(t, "[]", rr.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListAllTigersHandler_Cursor(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	seen := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	cursor := models.TigerSort{}.Cursor(models.Tiger{ID: 9, LastSeenTimestamp: seen}, false)
+	mock.ExpectQuery("WHERE merged_into_id IS NULL AND status <> 'deceased' AND \\(last_seen_timestamp, id\\) < \\(\\$2, \\$3\\) ORDER BY last_seen_timestamp DESC, id DESC LIMIT \\$1").
+		WithArgs(3, seen, 9).
+		WillReturnRows(mockTigerRows(
+			models.Tiger{ID: 8, Name: "TigerEight", LastSeenTimestamp: seen.Add(-time.Hour)},
+			models.Tiger{ID: 7, Name: "TigerSeven", LastSeenTimestamp: seen.Add(-2 * time.Hour)},
+			models.Tiger{ID: 6, Name: "TigerSix", LastSeenTimestamp: seen.Add(-3 * time.Hour)}))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM tigers").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(12))
+
+	rr := httptest.NewRecorder()
+	ListAllTigersHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/tigers/list?limit=2&cursor="+cursor.Encode(), nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "12", rr.Header().Get("X-Total-Count"))
+	var got struct {
+		Data       []models.Tiger `json:"data"`
+		NextCursor string         `json:"next_cursor"`
+		PrevCursor string         `json:"prev_cursor"`
+	}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&got))
+	assert.Len(t, got.Data, 2)
+
+	next, err := models.DecodeCursor(got.NextCursor)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, next.ID)
+	assert.False(t, next.Backward)
+	prev, err := models.DecodeCursor(got.PrevCursor)
+	assert.NoError(t, err)
+	assert.Equal(t, 8, prev.ID)
+	assert.True(t, prev.Backward)
+
+	link := rr.Header().Get("Link")
+	assert.Contains(t, link, `</tigers/list?cursor=`+got.NextCursor+`&limit=2>; rel="next"`)
+	assert.Contains(t, link, `rel="prev"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListAllTigersHandler_CursorForOtherSort(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	cursor := models.TigerSort{Field: models.SortByName}.Cursor(models.Tiger{ID: 9, Name: "Kaa"}, false)
+	rr := httptest.NewRecorder()
+	ListAllTigersHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/tigers/list?sort=-lastSeen&cursor="+cursor.Encode(), nil))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	var errResp ErrorResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&errResp))
+	assert.Equal(t, "INVALID_CURSOR", errResp.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListAllTigersHandler_InvalidFilter(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		expectedCode string
+	}{
+		{"Unknown subspecies", "subspecies=caspian", "INVALID_SUBSPECIES"},
+		{"Unknown status", "status=sleeping", "INVALID_STATUS"},
+		{"Bad date", "lastSeenFrom=yesterday", "INVALID_DATE_RANGE"},
+		{"Reversed date range", "lastSeenFrom=2024-02-01&lastSeenTo=2024-01-01", "INVALID_DATE_RANGE"},
+		{"Incomplete bounding box", "bbox=78,21,79", "INVALID_BBOX"},
+		{"Latitude out of range", "bbox=78,21,79,95", "INVALID_BBOX"},
+		{"Unknown sort key", "sort=-weight", "INVALID_SORT"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock := setupMockDB(t)
+			defer db.Close()
+
+			rr := httptest.NewRecorder()
+			ListAllTigersHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/tigers/list?"+tc.query, nil))
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			var errResp ErrorResponse
+			assert.NoError(t, json.NewDecoder(rr.Body).Decode(&errResp))
+			assert.Equal(t, tc.expectedCode, errResp.Code)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestNearbyTigersHandler(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	rows := sqlmock.NewRows(append(append([]string{}, tigerColumns...), "distance_km")).
+		AddRow(append(tigerRowValues(models.Tiger{ID: 3, Name: "TigerThree", Sex: models.TigerFemale}), 4.2)...)
+	mock.ExpectQuery("SELECT \\* FROM (.+) AND sex = \\$6 AND last_seen_lat BETWEEN \\$7 (.+) ORDER BY distance_km, id LIMIT \\$4").
+		WithArgs(21.0, 79.0, 15.0, 5, sqlmock.AnyArg(), models.TigerFemale, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(rows)
+
+	rr := httptest.NewRecorder()
+	NearbyTigersHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/tigers/nearby?lat=21&lon=79&radiusKm=15&limit=5&sex=female", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var got []models.NearbyTiger
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&got))
+	assert.Len(t, got, 1)
+	assert.Equal(t, 4.2, got[0].DistanceKm)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNearbyTigersHandler_Validation(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		expectedCode string
+	}{
+		{"Missing location", "radiusKm=20", "INVALID_LOCATION"},
+		{"Latitude out of range", "lat=91&lon=79", "INVALID_LOCATION"},
+		{"Negative radius", "lat=21&lon=79&radiusKm=-1", "INVALID_RADIUS"},
+		{"Radius too large", "lat=21&lon=79&radiusKm=5000", "INVALID_RADIUS"},
+		{"Limit too large", "lat=21&lon=79&limit=1000", "INVALID_LIMIT"},
+		{"Unknown sex", "lat=21&lon=79&sex=cub", "INVALID_SEX"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock := setupMockDB(t)
+			defer db.Close()
+
+			rr := httptest.NewRecorder()
+			NearbyTigersHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/tigers/nearby?"+tc.query, nil))
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			var errResp ErrorResponse
+			assert.NoError(t, json.NewDecoder(rr.Body).Decode(&errResp))
+			assert.Equal(t, tc.expectedCode, errResp.Code)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetTigerHandler(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	first := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	last := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id =").
+		WithArgs(1).
+		WillReturnRows(mockTigerRows(models.Tiger{ID: 1, Name: "TigerOne", DateOfBirth: first, LastSeenTimestamp: last, LastSeenLat: 10.123, LastSeenLon: 20.123, Aliases: []string{"Tiger1"}}))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\), MIN\\(timestamp\\), MAX\\(timestamp\\), COUNT\\(DISTINCT user_id\\) FROM sightings").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "min", "max", "reporters"}).AddRow(4, first, last, 2))
+
+	rr := httptest.NewRecorder()
+	GetTigerHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/tigers/1", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var got TigerDetailResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&got))
+	assert.Equal(t, "TigerOne", got.Name)
+	assert.Equal(t, []string{"Tiger1"}, got.Aliases)
+	assert.Equal(t, 4, got.Summary.SightingCount)
+	assert.Equal(t, 2, got.Summary.DistinctReporters)
+	assert.True(t, last.Equal(*got.Summary.LastSightingAt))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetTigerHandler_NotFound(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id =").
+		WithArgs(99).
+		WillReturnError(sql.ErrNoRows)
+
+	for _, path := range []string{"/tigers/99", "/tigers/abc"} {
+		rr := httptest.NewRecorder()
+		GetTigerHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+
+		assert.Equal(t, http.StatusNotFound, rr.Code, path)
+		var errResp ErrorResponse
+		assert.NoError(t, json.NewDecoder(rr.Body).Decode(&errResp))
+		assert.Equal(t, "TIGER_NOT_FOUND", errResp.Code)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateTigerHandler(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	dateOfBirth := time.Date(2015, 3, 1, 0, 0, 0, 0, time.UTC)
+	tiger := models.Tiger{ID: 1, Name: "Tigr One", DateOfBirth: dateOfBirth, LastSeenTimestamp: time.Now(), LastSeenLat: 10.5, LastSeenLon: 20.5}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id = \\$1 FOR UPDATE").
+		WithArgs(1).
+		WillReturnRows(mockTigerRows(tiger))
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM tigers WHERE \\(mother_id = \\$1 OR father_id = \\$1\\)").
+		WithArgs(1, dateOfBirth).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec("UPDATE tigers SET name = \\$2").
+		WithArgs(1, "TigerOne", dateOfBirth, sqlmock.AnyArg(), 10.5, 20.5, models.TigerDeceased, "Found dead near the river", sqlmock.AnyArg(), nil, nil,
+			models.TigerSexUnknown, models.TigerSubspecies(""), "", "", pq.StringArray{"collared"}, "", false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM tiger_identification_codes").
+		WithArgs(1, pq.StringArray{}).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM tiger_aliases").
+		WithArgs(1, pq.StringArray{}).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	body := `{"name": "TigerOne", "status": "deceased", "status_reason": "Found dead near the river", "tags": ["Collared", " collared "]}`
+	rr := httptest.NewRecorder()
+	UpdateTigerHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodPatch, "/tigers/1", bytes.NewBufferString(body)))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var got models.Tiger
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&got))
+	assert.Equal(t, models.TigerDeceased, got.Status)
+	assert.NotNil(t, got.StatusEffectiveAt)
+	assert.Equal(t, []string{"collared"}, got.Tags)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateTigerHandler_Validation(t *testing.T) {
+	dateOfBirth := time.Date(2015, 3, 1, 0, 0, 0, 0, time.UTC)
+	tiger := models.Tiger{ID: 1, Name: "TigerOne", DateOfBirth: dateOfBirth, LastSeenTimestamp: time.Now(), LastSeenLat: 10.5, LastSeenLon: 20.5}
+
+	tests := []struct {
+		name         string
+		body         string
+		expectedCode string
+	}{
+		{"Missing reason", `{"status": "missing"}`, "MISSING_STATUS_REASON"},
+		{"Unknown status", `{"status": "sleeping", "status_reason": "zzz"}`, "INVALID_STATUS"},
+		{"Effective before birth", `{"status": "relocated", "status_reason": "Moved", "status_effective_at": "2010-01-01T00:00:00Z"}`, "INVALID_STATUS_DATE"},
+		{"Empty name", `{"name": " "}`, "INVALID_NAME"},
+		{"Bad latitude", `{"last_seen_lat": 91}`, "INVALID_LATITUDE"},
+		{"Unknown sex", `{"sex": "cub"}`, "INVALID_SEX"},
+		{"Unknown subspecies", `{"subspecies": "caspian"}`, "INVALID_SUBSPECIES"},
+		{"Bad identification code", `{"identification_codes": ["CT 42"]}`, "INVALID_IDENTIFICATION_CODE"},
+		{"Alias equal to name", `{"aliases": ["tigerone"]}`, "INVALID_ALIAS"},
+		{"Long tag", `{"tags": ["` + strings.Repeat("x", 33) + `"]}`, "INVALID_TAG"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock := setupMockDB(t)
+			defer db.Close()
+
+			mock.ExpectBegin()
+			mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id = \\$1 FOR UPDATE").
+				WithArgs(1).
+				WillReturnRows(mockTigerRows(tiger))
+			mock.ExpectRollback()
+
+			rr := httptest.NewRecorder()
+			UpdateTigerHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodPatch, "/tigers/1", bytes.NewBufferString(tc.body)))
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			var errResp ErrorResponse
+			assert.NoError(t, json.NewDecoder(rr.Body).Decode(&errResp))
+			assert.Equal(t, tc.expectedCode, errResp.Code)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUpdateTigerHandler_DuplicateName(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	tiger := models.Tiger{ID: 1, Name: "TigerOne", DateOfBirth: time.Date(2015, 3, 1, 0, 0, 0, 0, time.UTC), LastSeenTimestamp: time.Now(), LastSeenLat: 10.5, LastSeenLon: 20.5}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id = \\$1 FOR UPDATE").
+		WithArgs(1).
+		WillReturnRows(mockTigerRows(tiger))
+	mock.ExpectQuery("SELECT EXISTS").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec("UPDATE tigers").
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "tigers_name_key"})
+	mock.ExpectRollback()
+
+	rr := httptest.NewRecorder()
+	UpdateTigerHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodPatch, "/tigers/1", bytes.NewBufferString(`{"name": "TigerTwo"}`)))
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateTigerHandler_Merged(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	survivorID := 1
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id = \\$1 FOR UPDATE").
+		WithArgs(2).
+		WillReturnRows(mockTigerRows(models.Tiger{ID: 2, Name: "Tiger1", DateOfBirth: time.Now(), LastSeenTimestamp: time.Now(), LastSeenLat: 10, LastSeenLon: 20, MergedIntoID: &survivorID}))
+	mock.ExpectRollback()
+
+	rr := httptest.NewRecorder()
+	UpdateTigerHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodPatch, "/tigers/2", bytes.NewBufferString(`{"aliases": ["T1"]}`)))
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	var errResp ErrorResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&errResp))
+	assert.Equal(t, "TIGER_MERGED", errResp.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetTigerHandler_Merged(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	survivorID := 1
+	mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id =").
+		WithArgs(2).
+		WillReturnRows(mockTigerRows(models.Tiger{ID: 2, Name: "Tiger1", DateOfBirth: time.Now(), LastSeenTimestamp: time.Now(), LastSeenLat: 10, LastSeenLon: 20, MergedIntoID: &survivorID}))
+
+	rr := httptest.NewRecorder()
+	GetTigerHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/tigers/2", nil))
+
+	assert.Equal(t, http.StatusMovedPermanently, rr.Code)
+	assert.Equal(t, "/tigers/1", rr.Header().Get("Location"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMergeTigersHandler(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	older := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	survivor := models.Tiger{ID: 1, Name: "TigerOne", DateOfBirth: older, LastSeenTimestamp: older, LastSeenLat: 10, LastSeenLon: 20}
+	duplicate := models.Tiger{ID: 2, Name: "Tiger1", DateOfBirth: older, LastSeenTimestamp: newer, LastSeenLat: 11, LastSeenLon: 21}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id IN \\(\\$1, \\$2\\) ORDER BY id FOR UPDATE").
+		WithArgs(2, 1).
+		WillReturnRows(mockTigerRows(survivor, duplicate))
+	mock.ExpectQuery("SELECT EXISTS (.+) AND date_of_birth").WithArgs(1, older).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery("SELECT EXISTS (.+) AND id <> \\$2").WithArgs(2, 1, older).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec("UPDATE sightings SET tiger_id = \\$2 WHERE tiger_id = \\$1").WithArgs(2, 1).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("DELETE FROM tiger_aliases").WithArgs(2, 1, "TigerOne").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE tiger_aliases SET tiger_id").WithArgs(2, 1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO tiger_aliases").WithArgs(1, "Tiger1", "TigerOne").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE tiger_identification_codes SET tiger_id").WithArgs(2, 1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE tigers SET tags = '{}'").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE tigers SET tags = \\$2").WithArgs(1, pq.StringArray{}, nil, nil).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE tigers SET mother_id").WithArgs(2, 1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE tigers SET father_id").WithArgs(2, 1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE sighting_rules SET tiger_id").WithArgs(2, 1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM sighting_rules").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE tigers SET merged_into_id").WithArgs(2, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE tigers SET last_seen_timestamp").WithArgs(1, newer, 11.0, 21.0).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	rr := httptest.NewRecorder()
+	MergeTigersHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/tigers/merge", bytes.NewBufferString(`{"source_id": 2, "target_id": 1}`)))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var got models.Tiger
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&got))
+	assert.Equal(t, 1, got.ID)
+	assert.True(t, newer.Equal(got.LastSeenTimestamp))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMergeTigersHandler_CubTooOld(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	born := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id IN").
+		WithArgs(2, 1).
+		WillReturnRows(mockTigerRows(
+			models.Tiger{ID: 1, Name: "TigerOne", DateOfBirth: born, LastSeenTimestamp: born},
+			models.Tiger{ID: 2, Name: "Tiger1", DateOfBirth: born, LastSeenTimestamp: born}))
+	mock.ExpectQuery("SELECT EXISTS (.+) AND date_of_birth").WithArgs(1, born).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	// A cub of the duplicate is born before the survivor.
+	mock.ExpectQuery("SELECT EXISTS (.+) AND id <> \\$2").WithArgs(2, 1, born).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	rr := httptest.NewRecorder()
+	MergeTigersHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/tigers/merge", bytes.NewBufferString(`{"source_id": 2, "target_id": 1}`)))
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	var errResp ErrorResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&errResp))
+	assert.Equal(t, "CUB_TOO_OLD", errResp.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMergeTigersHandler_AlreadyMerged(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	survivorID := 3
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id IN").
+		WithArgs(2, 1).
+		WillReturnRows(mockTigerRows(
+			models.Tiger{ID: 1, Name: "TigerOne", DateOfBirth: time.Now(), LastSeenTimestamp: time.Now()},
+			models.Tiger{ID: 2, Name: "Tiger1", DateOfBirth: time.Now(), LastSeenTimestamp: time.Now(), MergedIntoID: &survivorID}))
+	mock.ExpectRollback()
+
+	rr := httptest.NewRecorder()
+	MergeTigersHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/tigers/merge", bytes.NewBufferString(`{"source_id": 2, "target_id": 1}`)))
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	rr = httptest.NewRecorder()
+	MergeTigersHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/tigers/merge", bytes.NewBufferString(`{"source_id": 1, "target_id": 1}`)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestCreateTigerHandler_ParentTooYoung(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	motherID := 1
+	mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id =").
+		WithArgs(1).
+		WillReturnRows(mockTigerRows(models.Tiger{ID: 1, Name: "Mother", DateOfBirth: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), LastSeenTimestamp: time.Now()}))
+
+	body, _ := json.Marshal(models.Tiger{
+		Name:              "Cub",
+		DateOfBirth:       time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		LastSeenTimestamp: time.Now(),
+		LastSeenLat:       45.0,
+		LastSeenLon:       90.0,
+		MotherID:          &motherID,
+	})
+	rr := httptest.NewRecorder()
+	CreateTigerHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/tigers/create", bytes.NewBuffer(body)))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	var errResp ErrorResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&errResp))
+	assert.Equal(t, "PARENT_TOO_YOUNG", errResp.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateTigerHandler_DuplicateIdentificationCode(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO tigers").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectExec("INSERT INTO tiger_identification_codes").
+		WithArgs(5, pq.StringArray{"CT-0042"}).
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "tiger_identification_codes_code_key"})
+	mock.ExpectRollback()
+
+	body, _ := json.Marshal(models.Tiger{
+		Name:                "Stripey",
+		DateOfBirth:         time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		LastSeenTimestamp:   time.Now(),
+		LastSeenLat:         45.0,
+		LastSeenLon:         90.0,
+		IdentificationCodes: []string{" CT-0042 ", "CT-0042"},
+	})
+	rr := httptest.NewRecorder()
+	CreateTigerHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/tigers/create", bytes.NewBuffer(body)))
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	var errResp ErrorResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&errResp))
+	assert.Equal(t, "DUPLICATE_IDENTIFICATION_CODE", errResp.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetTigerFamilyHandler(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	motherID := 1
+	born := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id =").
+		WithArgs(2).
+		WillReturnRows(mockTigerRows(models.Tiger{ID: 2, Name: "Cub", DateOfBirth: born, LastSeenTimestamp: time.Now(), MotherID: &motherID}))
+
+	mock.ExpectQuery("WITH RECURSIVE relatives").
+		WithArgs(2, 2).
+		WillReturnRows(mockFamilyRows(1, models.Tiger{ID: 1, Name: "Mother", DateOfBirth: born.AddDate(-5, 0, 0), LastSeenTimestamp: time.Now()}))
+	mock.ExpectQuery("WITH RECURSIVE relatives").
+		WithArgs(2, 2).
+		WillReturnRows(mockFamilyRows(1))
+
+	rr := httptest.NewRecorder()
+	GetTigerFamilyHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/tigers/2/family?depth=2", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var got FamilyResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&got))
+	assert.Equal(t, 2, got.Depth)
+	assert.Len(t, got.Ancestors, 1)
+	assert.Equal(t, "Mother", got.Ancestors[0].Name)
+	assert.Empty(t, got.Descendants)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+var tigerColumns = []string{"id", "name", "date_of_birth", "last_seen_timestamp", "last_seen_lat", "last_seen_lon", "status", "status_reason", "status_effective_at", "merged_into_id", "mother_id", "father_id", "sex", "subspecies", "distinguishing_marks", "stripe_notes", "reserve", "sensitive", "identification_codes", "tags", "aliases"}
+
+// mockTigerRows returns the rows a SELECT of all tiger columns yields for the given tigers.
+func mockTigerRows(tigers ...models.Tiger) *sqlmock.Rows {
+	rows := sqlmock.NewRows(tigerColumns)
+	for _, t := range tigers {
+		rows.AddRow(tigerRowValues(t)...)
+	}
+	return rows
+}
+
+// mockFamilyRows returns the rows of a family query, where every tiger is preceded by its generation.
+func mockFamilyRows(generation int, tigers ...models.Tiger) *sqlmock.Rows {
+	rows := sqlmock.NewRows(append([]string{"generation"}, tigerColumns...))
+	for _, t := range tigers {
+		rows.AddRow(append([]driver.Value{generation}, tigerRowValues(t)...)...)
+	}
+	return rows
+}
+
+func tigerRowValues(t models.Tiger) []driver.Value {
+	status := t.Status
+	if status == "" {
+		status = models.TigerActive
+	}
+	var effectiveAt, mergedIntoID, motherID, fatherID driver.Value
+	if t.StatusEffectiveAt != nil {
+		effectiveAt = *t.StatusEffectiveAt
+	}
+	if t.MergedIntoID != nil {
+		mergedIntoID = *t.MergedIntoID
+	}
+	if t.MotherID != nil {
+		motherID = *t.MotherID
+	}
+	if t.FatherID != nil {
+		fatherID = *t.FatherID
+	}
+	sex := t.Sex
+	if sex == "" {
+		sex = models.TigerSexUnknown
+	}
+	return []driver.Value{t.ID, t.Name, t.DateOfBirth, t.LastSeenTimestamp, t.LastSeenLat, t.LastSeenLon, string(status), t.StatusReason, effectiveAt, mergedIntoID, motherID, fatherID,
+		string(sex), string(t.Subspecies), t.DistinguishingMarks, t.StripeNotes, t.Reserve, t.Sensitive, arrayValue(t.IdentificationCodes), arrayValue(t.Tags), arrayValue(t.Aliases)}
+}
+
+func arrayValue(values []string) driver.Value {
+	v, _ := pq.StringArray(values).Value()
+	if v == nil {
+		return "{}"
+	}
+	return v
+}
+
+func TestGetTigerFamilyHandler_InvalidDepth(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	rr := httptest.NewRecorder()
+	GetTigerFamilyHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/tigers/2/family?depth=50", nil))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
 func setupMockDB(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ravirajdarisi/tigerhall-kittens/auth"
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+)
+
+// totpIssuer is the account issuer shown in authenticator apps.
+const totpIssuer = "Tigerhall Kittens"
+
+// recoveryCodeCount is how many recovery codes are issued when 2FA is enabled.
+const recoveryCodeCount = 10
+
+// MFAChallengeResponse is returned by LoginHandler instead of a session when
+// the user has two-factor authentication enabled, or has to set it up first.
+type MFAChallengeResponse struct {
+	Status             string `json:"Status"`
+	MFARequired        bool   `json:"mfa_required"`
+	EnrollmentRequired bool   `json:"mfa_enrollment_required,omitempty"`
+	MFAToken           string `json:"mfa_token"`
+	ExpiresIn          int    `json:"expires_in"`
+}
+
+type secondFactorRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// verifySecondFactor checks a TOTP code or, failing that, a recovery code of the user.
+// Both are consumed on success so neither can be replayed.
+func verifySecondFactor(db *sql.DB, user *models.User, req secondFactorRequest) (bool, error) {
+	if req.Code != "" {
+		step, ok := auth.ValidateTOTP(user.TOTPSecret.String, req.Code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		return user.UseTOTPStep(db, step)
+	}
+	if req.RecoveryCode != "" {
+		return models.UseRecoveryCode(db, user.ID, auth.HashToken(auth.NormalizeRecoveryCode(req.RecoveryCode)))
+	}
+	return false, nil
+}
+
+// LoginTwoFactorHandler completes a login started by LoginHandler for a user with
+// two-factor authentication, using either a TOTP code or a recovery code.
+func LoginTwoFactorHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			MFAToken string `json:"mfa_token"`
+			secondFactorRequest
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		claims, err := auth.ParseToken(req.MFAToken, auth.PurposeMFA)
+		if err != nil {
+			http.Error(w, "Invalid or expired login attempt, please log in again", http.StatusUnauthorized)
+			return
+		}
+
+		user, err := models.GetUserByID(db, claims.Subject)
+		if err != nil || !user.Active() || !user.TOTPEnabled() {
+			http.Error(w, "Invalid or expired login attempt, please log in again", http.StatusUnauthorized)
+			return
+		}
+
+		// Wrong codes count towards the same throttle as wrong passwords.
+		userKey, ipKey := loginFailureKeys(r, user.Username)
+		wait, err := claimLoginAttempt(db, userKey, ipKey)
+		if err != nil {
+			http.Error(w, "Error checking login attempts", http.StatusInternalServerError)
+			return
+		}
+		if wait > 0 {
+			writeLoginThrottled(w, wait)
+			return
+		}
+
+		ok, err := verifySecondFactor(db, user, req.secondFactorRequest)
+		if err != nil {
+			http.Error(w, "Error verifying two-factor code", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+			return
+		}
+		releaseLoginAttempt(db, ipKey)
+
+		if err := models.ClearLoginFailures(db, userKey); err != nil {
+			log.Printf("Failed to clear login failures for %s: %v", userKey, err)
+		}
+
+		session, err := issueSession(db, user)
+		if err != nil {
+			http.Error(w, "Error creating session", http.StatusInternalServerError)
+			return
+		}
+		session.Status = "Logged in successfully"
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(session)
+	}
+}
+
+// EnrollTOTPHandler generates a new TOTP secret for the authenticated user. It
+// only takes effect once confirmed through ConfirmTOTPHandler.
+func EnrollTOTPHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			writeErrorResponse(w, http.StatusUnauthorized, "UNAUTHORIZED", "A valid access token is required.")
+			return
+		}
+
+		if user.TOTPEnabled() {
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+
+		secret, err := auth.GenerateTOTPSecret()
+		if err != nil {
+			http.Error(w, "Error generating two-factor secret", http.StatusInternalServerError)
+			return
+		}
+		if err := user.SetTOTPSecret(db, secret); err != nil {
+			http.Error(w, "Error saving two-factor secret", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Secret          string `json:"secret"`
+			ProvisioningURI string `json:"provisioning_uri"`
+		}{secret, auth.TOTPProvisioningURI(totpIssuer, user.Username, secret)})
+	}
+}
+
+// ConfirmTOTPHandler enables two-factor authentication once the user proves their
+// authenticator app produces valid codes, and returns a fresh set of recovery codes.
+// Users who confirm with the enrolment token from LoginHandler also get a session.
+func ConfirmTOTPHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			writeErrorResponse(w, http.StatusUnauthorized, "UNAUTHORIZED", "A valid access token is required.")
+			return
+		}
+
+		var req struct {
+			Code string `json:"code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if user.TOTPEnabled() {
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+		if !user.TOTPSecret.Valid {
+			http.Error(w, "Start two-factor enrolment first", http.StatusConflict)
+			return
+		}
+
+		ok, err := verifySecondFactor(db, user, secondFactorRequest{Code: req.Code})
+		if err != nil {
+			http.Error(w, "Error verifying two-factor code", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Invalid two-factor code", http.StatusBadRequest)
+			return
+		}
+
+		codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+		if err != nil {
+			http.Error(w, "Error generating recovery codes", http.StatusInternalServerError)
+			return
+		}
+		hashes := make([]string, len(codes))
+		for i, code := range codes {
+			hashes[i] = auth.HashToken(auth.NormalizeRecoveryCode(code))
+		}
+		if err := models.ReplaceRecoveryCodes(db, user.ID, hashes); err != nil {
+			http.Error(w, "Error saving recovery codes", http.StatusInternalServerError)
+			return
+		}
+
+		if err := user.EnableTOTP(db); err != nil {
+			http.Error(w, "Error enabling two-factor authentication", http.StatusInternalServerError)
+			return
+		}
+
+		var session *TokenResponse
+		if enrolling(r.Context()) {
+			session, err = issueSession(db, user)
+			if err != nil {
+				http.Error(w, "Error creating session", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Status        string         `json:"Status"`
+			RecoveryCodes []string       `json:"recovery_codes"`
+			Session       *TokenResponse `json:"session,omitempty"`
+		}{"Two-factor authentication enabled", codes, session})
+	}
+}
+
+// DisableTOTPHandler turns off two-factor authentication. The current password
+// and a valid code are both required. Rangers and admins can not turn it off.
+func DisableTOTPHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			writeErrorResponse(w, http.StatusUnauthorized, "UNAUTHORIZED", "A valid access token is required.")
+			return
+		}
+
+		var req struct {
+			Password string `json:"password"`
+			secondFactorRequest
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if !user.TOTPEnabled() {
+			http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+			return
+		}
+		if user.Role.RequiresTwoFactor() {
+			writeErrorResponse(w, http.StatusForbidden, "TWO_FACTOR_REQUIRED", "Two-factor authentication is required for your role.")
+			return
+		}
+		if !user.Authenticate(db, req.Password) {
+			http.Error(w, "Invalid password", http.StatusUnauthorized)
+			return
+		}
+
+		ok, err := verifySecondFactor(db, user, req.secondFactorRequest)
+		if err != nil {
+			http.Error(w, "Error verifying two-factor code", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+			return
+		}
+
+		if err := user.DisableTOTP(db); err != nil {
+			http.Error(w, "Error disabling two-factor authentication", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(struct{ Status string }{"Two-factor authentication disabled"})
+	}
+}
@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ravirajdarisi/tigerhall-kittens/auth"
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTOTPUser returns a ranger with two-factor authentication enabled.
+func newTOTPUser(t *testing.T) models.User {
+	secret, err := auth.GenerateTOTPSecret()
+	require.NoError(t, err)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	enabledAt := time.Now()
+	return models.User{
+		ID:            2,
+		Username:      "ranger",
+		PasswordHash:  string(hashedPassword),
+		Email:         "ranger@example.com",
+		Role:          models.RoleRanger,
+		TOTPSecret:    sql.NullString{String: secret, Valid: true},
+		TOTPEnabledAt: &enabledAt,
+	}
+}
+
+func TestLoginHandler_RequiresSecondFactor(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	user := newTOTPUser(t)
+	expectLoginAttempt(mock, "user:ranger", 0, nil)
+	expectLoginAttempt(mock, "ip:192.0.2.1", 0, nil)
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE username =").
+		WithArgs("ranger").
+		WillReturnRows(mockUserRows(user))
+	expectLoginRelease(mock, "user:ranger")
+	expectLoginRelease(mock, "ip:192.0.2.1")
+
+	body, _ := json.Marshal(map[string]string{"username": "ranger", "password": "password"})
+	rr := httptest.NewRecorder()
+	LoginHandler(db).ServeHTTP(rr, httptest.NewRequest("POST", "/users/login", bytes.NewBuffer(body)))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var challenge MFAChallengeResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&challenge))
+	assert.True(t, challenge.MFARequired)
+
+	// The challenge token can not be used as an access token.
+	_, err := auth.ParseToken(challenge.MFAToken, auth.PurposeAccess)
+	assert.Error(t, err)
+	claims, err := auth.ParseToken(challenge.MFAToken, auth.PurposeMFA)
+	require.NoError(t, err)
+	assert.Equal(t, 2, claims.Subject)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoginTwoFactorHandler(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	user := newTOTPUser(t)
+	mfaToken, _, err := auth.IssueToken(user.ID, auth.PurposeMFA, time.Minute)
+	require.NoError(t, err)
+	code, err := auth.TOTPCode(user.TOTPSecret.String, auth.TOTPStep(time.Now()))
+	require.NoError(t, err)
+
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id =").
+		WithArgs(2).
+		WillReturnRows(mockUserRows(user))
+	expectLoginAttempt(mock, "user:ranger", 0, nil)
+	expectLoginAttempt(mock, "ip:192.0.2.1", 0, nil)
+	mock.ExpectExec("UPDATE users SET totp_last_step").
+		WithArgs(2, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectLoginRelease(mock, "ip:192.0.2.1")
+	mock.ExpectExec("DELETE FROM login_failures").
+		WithArgs("user:ranger").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("INSERT INTO refresh_tokens").
+		WithArgs(2, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	body, _ := json.Marshal(map[string]string{"mfa_token": mfaToken, "code": code})
+	rr := httptest.NewRecorder()
+	LoginTwoFactorHandler(db).ServeHTTP(rr, httptest.NewRequest("POST", "/users/login/2fa", bytes.NewBuffer(body)))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var session TokenResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&session))
+	assert.NotEmpty(t, session.AccessToken)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoginTwoFactorHandler_RecoveryCode(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	user := newTOTPUser(t)
+	mfaToken, _, err := auth.IssueToken(user.ID, auth.PurposeMFA, time.Minute)
+	require.NoError(t, err)
+
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id =").
+		WithArgs(2).
+		WillReturnRows(mockUserRows(user))
+	expectLoginAttempt(mock, "user:ranger", 0, nil)
+	expectLoginAttempt(mock, "ip:192.0.2.1", 0, nil)
+	mock.ExpectExec("UPDATE recovery_codes SET used_at").
+		WithArgs(2, auth.HashToken("abcdefghij"), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectLoginRelease(mock, "ip:192.0.2.1")
+	mock.ExpectExec("DELETE FROM login_failures").
+		WithArgs("user:ranger").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("INSERT INTO refresh_tokens").
+		WithArgs(2, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	body, _ := json.Marshal(map[string]string{"mfa_token": mfaToken, "recovery_code": "ABCDE-FGHIJ"})
+	rr := httptest.NewRecorder()
+	LoginTwoFactorHandler(db).ServeHTTP(rr, httptest.NewRequest("POST", "/users/login/2fa", bytes.NewBuffer(body)))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoginTwoFactorHandler_WrongCode(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	user := newTOTPUser(t)
+	mfaToken, _, err := auth.IssueToken(user.ID, auth.PurposeMFA, time.Minute)
+	require.NoError(t, err)
+
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id =").
+		WithArgs(2).
+		WillReturnRows(mockUserRows(user))
+	expectLoginAttempt(mock, "user:ranger", 0, nil)
+	expectLoginAttempt(mock, "ip:192.0.2.1", 0, nil)
+
+	body, _ := json.Marshal(map[string]string{"mfa_token": mfaToken, "code": "abcdef"})
+	rr := httptest.NewRecorder()
+	LoginTwoFactorHandler(db).ServeHTTP(rr, httptest.NewRequest("POST", "/users/login/2fa", bytes.NewBuffer(body)))
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEnrollAndConfirmTOTP(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	user := &models.User{ID: 2, Username: "ranger", Role: models.RoleRanger}
+
+	// Enrolment hands out a secret without enabling anything yet.
+	mock.ExpectExec("UPDATE users SET totp_secret = \\$2").
+		WithArgs(2, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req := httptest.NewRequest("POST", "/users/2fa/enroll", nil)
+	req = req.WithContext(ContextWithUser(req.Context(), user))
+	rr := httptest.NewRecorder()
+	EnrollTOTPHandler(db).ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	var enrolment struct {
+		Secret          string `json:"secret"`
+		ProvisioningURI string `json:"provisioning_uri"`
+	}
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&enrolment))
+	assert.True(t, strings.HasPrefix(enrolment.ProvisioningURI, "otpauth://totp/"))
+	assert.False(t, user.TOTPEnabled())
+
+	// Confirming with a valid code enables 2FA and returns recovery codes.
+	code, err := auth.TOTPCode(enrolment.Secret, auth.TOTPStep(time.Now()))
+	require.NoError(t, err)
+
+	mock.ExpectExec("UPDATE users SET totp_last_step").
+		WithArgs(2, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM recovery_codes").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 0))
+	for i := 0; i < recoveryCodeCount; i++ {
+		mock.ExpectExec("INSERT INTO recovery_codes").WithArgs(2, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	mock.ExpectCommit()
+	mock.ExpectExec("UPDATE users SET totp_enabled_at").
+		WithArgs(2, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	body, _ := json.Marshal(map[string]string{"code": code})
+	req = httptest.NewRequest("POST", "/users/2fa/confirm", bytes.NewBuffer(body))
+	req = req.WithContext(ContextWithUser(req.Context(), user))
+	rr = httptest.NewRecorder()
+	ConfirmTOTPHandler(db).ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	var confirmation struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&confirmation))
+	assert.Len(t, confirmation.RecoveryCodes, recoveryCodeCount)
+	assert.True(t, user.TOTPEnabled())
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoginHandler_RequiresEnrollment(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	user := newTOTPUser(t)
+	user.TOTPSecret = sql.NullString{}
+	user.TOTPEnabledAt = nil
+	expectLoginAttempt(mock, "user:ranger", 0, nil)
+	expectLoginAttempt(mock, "ip:192.0.2.1", 0, nil)
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE username =").
+		WithArgs("ranger").
+		WillReturnRows(mockUserRows(user))
+	expectLoginRelease(mock, "user:ranger")
+	expectLoginRelease(mock, "ip:192.0.2.1")
+
+	body, _ := json.Marshal(map[string]string{"username": "ranger", "password": "password"})
+	rr := httptest.NewRecorder()
+	LoginHandler(db).ServeHTTP(rr, httptest.NewRequest("POST", "/users/login", bytes.NewBuffer(body)))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var challenge MFAChallengeResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&challenge))
+	assert.True(t, challenge.EnrollmentRequired)
+
+	// Rangers without two-factor authentication get no session.
+	_, err := auth.ParseToken(challenge.MFAToken, auth.PurposeAccess)
+	assert.Error(t, err)
+	claims, err := auth.ParseToken(challenge.MFAToken, auth.PurposeMFAEnroll)
+	require.NoError(t, err)
+	assert.Equal(t, 2, claims.Subject)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestConfirmTOTPHandler_EnrollmentToken(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	user := newTOTPUser(t)
+	user.TOTPEnabledAt = nil
+	enrollToken, _, err := auth.IssueToken(user.ID, auth.PurposeMFAEnroll, time.Minute)
+	require.NoError(t, err)
+	code, err := auth.TOTPCode(user.TOTPSecret.String, auth.TOTPStep(time.Now()))
+	require.NoError(t, err)
+
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id =").
+		WithArgs(2).
+		WillReturnRows(mockUserRows(user))
+	mock.ExpectExec("UPDATE users SET totp_last_step").
+		WithArgs(2, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM recovery_codes").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 0))
+	for i := 0; i < recoveryCodeCount; i++ {
+		mock.ExpectExec("INSERT INTO recovery_codes").WithArgs(2, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	mock.ExpectCommit()
+	mock.ExpectExec("UPDATE users SET totp_enabled_at").
+		WithArgs(2, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("INSERT INTO refresh_tokens").
+		WithArgs(2, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	body, _ := json.Marshal(map[string]string{"code": code})
+	req := httptest.NewRequest("POST", "/users/2fa/confirm", bytes.NewBuffer(body))
+	req.Header.Set("Authorization", "Bearer "+enrollToken)
+	rr := httptest.NewRecorder()
+	RequireAuthOrEnrollment(db, ConfirmTOTPHandler(db)).ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	var confirmation struct {
+		Session *TokenResponse `json:"session"`
+	}
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&confirmation))
+	require.NotNil(t, confirmation.Session)
+	assert.NotEmpty(t, confirmation.Session.AccessToken)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRequireAuthOrEnrollment_AlreadyEnrolled(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	// Enrolment tokens stop working once two-factor authentication is on.
+	user := newTOTPUser(t)
+	enrollToken, _, err := auth.IssueToken(user.ID, auth.PurposeMFAEnroll, time.Minute)
+	require.NoError(t, err)
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id =").
+		WithArgs(2).
+		WillReturnRows(mockUserRows(user))
+
+	req := httptest.NewRequest("POST", "/users/2fa/enroll", nil)
+	req.Header.Set("Authorization", "Bearer "+enrollToken)
+	rr := httptest.NewRecorder()
+	RequireAuthOrEnrollment(db, EnrollTOTPHandler(db)).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDisableTOTPHandler_RequiredForRole(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	user := newTOTPUser(t)
+	body, _ := json.Marshal(map[string]string{"password": "password", "code": "123456"})
+	req := httptest.NewRequest("POST", "/users/2fa/disable", bytes.NewBuffer(body))
+	req = req.WithContext(ContextWithUser(req.Context(), &user))
+	rr := httptest.NewRecorder()
+	DisableTOTPHandler(db).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "TWO_FACTOR_REQUIRED")
+	assert.True(t, user.TOTPEnabled())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
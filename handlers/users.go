@@ -3,8 +3,12 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"log"
 	"net/http"
+	"net/mail"
+	"strings"
 
+	"github.com/ravirajdarisi/tigerhall-kittens/auth"
 	"github.com/ravirajdarisi/tigerhall-kittens/models"
 )
 
@@ -17,8 +21,8 @@ type UserRegistrationRequest struct {
 
 
 
-// CreateUserHandler handles the creation of a new user.
-func CreateUserHandler(db *sql.DB) http.HandlerFunc {
+// CreateUserHandler handles the creation of a new user and emails them a verification link.
+func CreateUserHandler(db *sql.DB, emailQueue chan EmailMessage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		// Decode the request body into a User struct.
@@ -36,6 +40,11 @@ func CreateUserHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		if address, err := mail.ParseAddress(req.Email); err != nil || address.Address != req.Email {
+			http.Error(w, "Email address is invalid", http.StatusBadRequest)
+			return
+		}
+
 		// Check if the username or email already exists.
 		existingUser, _ := models.GetUserByUsername(db, req.Username)
 		if existingUser != nil {
@@ -52,11 +61,24 @@ func CreateUserHandler(db *sql.DB) http.HandlerFunc {
 
 		// Insert the new user record into the database.
 		err = newUser.Save(db)
+		if err == models.ErrDuplicateUsername {
+			http.Error(w, "Username already exists", http.StatusConflict)
+			return
+		}
+		if err == models.ErrDuplicateEmail {
+			http.Error(w, "Email already exists", http.StatusConflict)
+			return
+		}
 		if err != nil {
 			http.Error(w, "Error saving user to the database", http.StatusInternalServerError)
 			return
 		}
 
+		// The account stays unverified until the emailed link is opened.
+		if err := sendVerificationEmail(emailQueue, newUser); err != nil {
+			log.Printf("Failed to send verification email to user %d: %v", newUser.ID, err)
+		}
+
 		// Respond to the request indicating the user was created.
 		w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode(newUser)
@@ -78,26 +100,156 @@ func LoginHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		// Count the attempt, and refuse it while the username or client address is throttled.
+		userKey, ipKey := loginFailureKeys(r, creds.Username)
+		wait, err := claimLoginAttempt(db, userKey, ipKey)
+		if err != nil {
+			http.Error(w, "Error checking login attempts", http.StatusInternalServerError)
+			return
+		}
+		if wait > 0 {
+			writeLoginThrottled(w, wait)
+			return
+		}
+
 		// Fetch the user from the database.
 		user, err := models.GetUserByUsername(db, creds.Username)
-		if err != nil {
-			http.Error(w, "User not found", http.StatusUnauthorized)
+		if err != nil && err != sql.ErrNoRows {
+			http.Error(w, "Error fetching user", http.StatusInternalServerError)
 			return
 		}
 
-		// Authenticate the user.
-		if !user.Authenticate(db, creds.Password) {
-			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		// Authenticate the user. Unknown users and wrong passwords get the same answer.
+		authenticated := false
+		if user != nil {
+			authenticated = user.Authenticate(db, creds.Password)
+		} else {
+			compareDummyPassword(creds.Password)
+		}
+		if !authenticated {
+			http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+			return
+		}
+		releaseLoginAttempt(db, userKey, ipKey)
+
+		// Deactivated accounts are only told so once the password has been proven.
+		if !user.Active() {
+			writeErrorResponse(w, http.StatusForbidden, "ACCOUNT_DEACTIVATED", "This account has been deactivated.")
+			return
+		}
+
+		// Users with two-factor authentication continue at /users/login/2fa. The
+		// failure counter is only cleared once the second step succeeds.
+		if user.TOTPEnabled() {
+			mfaToken, _, err := auth.IssueToken(user.ID, auth.PurposeMFA, auth.MFATokenTTL)
+			if err != nil {
+				http.Error(w, "Error creating session", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(MFAChallengeResponse{
+				Status:      "Two-factor authentication required",
+				MFARequired: true,
+				MFAToken:    mfaToken,
+				ExpiresIn:   int(auth.MFATokenTTL.Seconds()),
+			})
+			return
+		}
+
+		// Rangers and admins without two-factor authentication get no session,
+		// only a token to set it up with at /users/2fa/enroll and /users/2fa/confirm.
+		if user.NeedsTOTPEnrollment() {
+			enrollToken, _, err := auth.IssueToken(user.ID, auth.PurposeMFAEnroll, auth.MFAEnrollTokenTTL)
+			if err != nil {
+				http.Error(w, "Error creating session", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(MFAChallengeResponse{
+				Status:             "Two-factor authentication must be set up",
+				EnrollmentRequired: true,
+				MFAToken:           enrollToken,
+				ExpiresIn:          int(auth.MFAEnrollTokenTTL.Seconds()),
+			})
+			return
+		}
+
+		if err := models.ClearLoginFailures(db, userKey); err != nil {
+			log.Printf("Failed to clear login failures for %s: %v", userKey, err)
+		}
+
+		// Issue an access token and a refresh token for the new session.
+		session, err := issueSession(db, user)
+		if err != nil {
+			http.Error(w, "Error creating session", http.StatusInternalServerError)
 			return
 		}
+		session.Status = "Logged in successfully"
 
 		// Respond to the request indicating the user was authenticated.
+		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(struct{ Status string }{"Logged in successfully"})
+		json.NewEncoder(w).Encode(session)
 	}
 }
 
 
+// UpdateUserRoleHandler lets an admin change the role of another user.
+func UpdateUserRoleHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Username string      `json:"username"`
+			Role     models.Role `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if !req.Role.Valid() {
+			http.Error(w, "Unknown role", http.StatusBadRequest)
+			return
+		}
+
+		user, err := models.GetUserByUsername(db, req.Username)
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error fetching user", http.StatusInternalServerError)
+			return
+		}
+
+		if err := user.UpdateRole(db, req.Role); err != nil {
+			http.Error(w, "Error updating user role", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(user)
+	}
+}
 
 
+// UnlockUserHandler lets an admin clear the failed login attempts of a user.
+func UnlockUserHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Username string `json:"username"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		userKey := models.UserLoginFailureKey(strings.ToLower(req.Username))
+		if err := models.ClearLoginFailures(db, userKey); err != nil {
+			http.Error(w, "Error unlocking user", http.StatusInternalServerError)
+			return
+		}
 
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(struct{ Status string }{"User unlocked"})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -23,16 +24,17 @@ func TestCreateUserHandler(t *testing.T) {
 	}
 	defer db.Close()
 
-	mock.ExpectQuery("SELECT id, username, password_hash, email, created_at FROM users WHERE username =").
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE username =").
 		WithArgs("testuser").
 		WillReturnError(sql.ErrNoRows)
 
 	
-	mock.ExpectExec("INSERT INTO users").
-		WithArgs("testuser", sqlmock.AnyArg(), "test@example.com", sqlmock.AnyArg()).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("INSERT INTO users").
+		WithArgs("testuser", sqlmock.AnyArg(), "test@example.com", models.RoleReporter, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 
-	handler := CreateUserHandler(db)
+	emailQueue := make(chan EmailMessage, 1)
+	handler := CreateUserHandler(db, emailQueue)
 
 	
 	userData := map[string]string{
@@ -65,12 +67,53 @@ func TestCreateUserHandler(t *testing.T) {
 		t.Errorf("Handler returned unexpected body: got username %v, email %v", u.Username, u.Email)
 	}
 
+	if u.VerifiedAt != nil {
+		t.Errorf("New users must start unverified")
+	}
+
+	// A verification link is emailed to the new user
+	select {
+	case message := <-emailQueue:
+		if message.To != "test@example.com" || !strings.Contains(message.Body, "/users/verify?token=") {
+			t.Errorf("Unexpected verification email: %+v", message)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected a verification email to be queued")
+	}
+
 	// Ensure all expectations were met
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("There were unfulfilled expectations: %s", err)
 	}
 }
 
+func TestCreateUserHandler_InvalidEmail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	handler := CreateUserHandler(db, make(chan EmailMessage, 1))
+
+	userDataJSON, _ := json.Marshal(map[string]string{
+		"username": "testuser",
+		"password": "password",
+		"email":    "not-an-email",
+	})
+	req, _ := http.NewRequest("POST", "/create", bytes.NewBuffer(userDataJSON))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if status := w.Code; status != http.StatusBadRequest {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
 
 
 func TestLoginHandler(t *testing.T) {
@@ -82,13 +125,22 @@ func TestLoginHandler(t *testing.T) {
 
     // Mock user data
     hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
-    rows := sqlmock.NewRows([]string{"id", "username", "password_hash", "email", "created_at"}).
-        AddRow(1, "testuser", string(hashedPassword), "test@example.com", time.Now())
+    rows := mockUserRows(models.User{ID: 1, Username: "testuser", PasswordHash: string(hashedPassword), Email: "test@example.com", Role: models.RoleReporter})
 
     // Scenario 1: Successful login
-    mock.ExpectQuery("SELECT id, username, password_hash, email, created_at FROM users WHERE username =").
+    expectLoginAttempt(mock, "user:testuser", 0, nil)
+    expectLoginAttempt(mock, sqlmock.AnyArg(), 0, nil)
+    mock.ExpectQuery("SELECT (.+) FROM users WHERE username =").
         WithArgs("testuser").
         WillReturnRows(rows)
+    expectLoginRelease(mock, "user:testuser")
+    expectLoginRelease(mock, sqlmock.AnyArg())
+    mock.ExpectExec("DELETE FROM login_failures").
+        WithArgs("user:testuser").
+        WillReturnResult(sqlmock.NewResult(0, 0))
+    mock.ExpectQuery("INSERT INTO refresh_tokens").
+        WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+        WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 
     // Create the handler
     handler := LoginHandler(db)
@@ -110,8 +162,20 @@ func TestLoginHandler(t *testing.T) {
         t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
     }
 
+    // The response must carry a usable token pair
+    var session TokenResponse
+    if err := json.NewDecoder(w.Body).Decode(&session); err != nil {
+        t.Fatalf("Could not decode response body: %v", err)
+    }
+    if session.AccessToken == "" || session.RefreshToken == "" || session.TokenType != "Bearer" {
+        t.Errorf("Handler returned an incomplete token response: %+v", session)
+    }
+
     // Scenario 2: Invalid credentials 
-    mock.ExpectQuery("SELECT id, username, password_hash, email, created_at FROM users WHERE username =").
+    // The attempt is counted before the password is checked and stays counted.
+    expectLoginAttempt(mock, "user:testuser", 0, nil)
+    expectLoginAttempt(mock, sqlmock.AnyArg(), 0, nil)
+    mock.ExpectQuery("SELECT (.+) FROM users WHERE username =").
         WithArgs("testuser").
         WillReturnRows(rows) // Assuming the password provided doesn't match
 
@@ -139,3 +203,128 @@ func TestLoginHandler(t *testing.T) {
 
 
 
+func TestLoginHandler_UnknownUser(t *testing.T) {
+    db, mock, err := sqlmock.New()
+    if err != nil {
+        t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+    }
+    defer db.Close()
+
+    expectLoginAttempt(mock, "user:nobody", 0, nil)
+    expectLoginAttempt(mock, "ip:192.0.2.1", 0, nil)
+    mock.ExpectQuery("SELECT (.+) FROM users WHERE username =").
+        WithArgs("nobody").
+        WillReturnError(sql.ErrNoRows)
+
+    credentialsJSON, _ := json.Marshal(map[string]string{"username": "nobody", "password": "password"})
+    w := httptest.NewRecorder()
+    LoginHandler(db).ServeHTTP(w, httptest.NewRequest("POST", "/login", bytes.NewBuffer(credentialsJSON)))
+
+    // Unknown users get exactly the same answer as wrong passwords
+    if status := w.Code; status != http.StatusUnauthorized {
+        t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusUnauthorized)
+    }
+    if body := strings.TrimSpace(w.Body.String()); body != "Invalid username or password" {
+        t.Errorf("Handler returned unexpected body: %q", body)
+    }
+
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("There were unfulfilled expectations: %s", err)
+    }
+}
+
+func TestLoginHandler_Throttled(t *testing.T) {
+    db, mock, err := sqlmock.New()
+    if err != nil {
+        t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+    }
+    defer db.Close()
+
+    // Ten failures lock the account, the password is never checked
+    expectLoginAttempt(mock, "user:testuser", 10, time.Now())
+    expectLoginAttempt(mock, "ip:192.0.2.1", 0, nil)
+
+    credentialsJSON, _ := json.Marshal(map[string]string{"username": "TestUser", "password": "password"})
+    w := httptest.NewRecorder()
+    LoginHandler(db).ServeHTTP(w, httptest.NewRequest("POST", "/login", bytes.NewBuffer(credentialsJSON)))
+
+    if status := w.Code; status != http.StatusTooManyRequests {
+        t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusTooManyRequests)
+    }
+    if retryAfter := w.Header().Get("Retry-After"); retryAfter != "900" {
+        t.Errorf("Expected a 15 minute Retry-After, got %q", retryAfter)
+    }
+
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("There were unfulfilled expectations: %s", err)
+    }
+}
+
+func TestUnlockUserHandler(t *testing.T) {
+    db, mock, err := sqlmock.New()
+    if err != nil {
+        t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+    }
+    defer db.Close()
+
+    mock.ExpectExec("DELETE FROM login_failures WHERE key =").
+        WithArgs("user:testuser").
+        WillReturnResult(sqlmock.NewResult(0, 1))
+
+    body, _ := json.Marshal(map[string]string{"username": "TestUser"})
+    w := httptest.NewRecorder()
+    UnlockUserHandler(db).ServeHTTP(w, httptest.NewRequest("POST", "/users/unlock", bytes.NewBuffer(body)))
+
+    if status := w.Code; status != http.StatusOK {
+        t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+    }
+
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("There were unfulfilled expectations: %s", err)
+    }
+}
+
+func TestUpdateUserRoleHandler(t *testing.T) {
+    db, mock, err := sqlmock.New()
+    if err != nil {
+        t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+    }
+    defer db.Close()
+
+    mock.ExpectQuery("SELECT (.+) FROM users WHERE username =").
+        WithArgs("volunteer").
+        WillReturnRows(mockUserRows(models.User{ID: 5, Username: "volunteer", Role: models.RoleReporter}))
+    mock.ExpectExec("UPDATE users SET role").
+        WithArgs(5, models.RoleRanger).
+        WillReturnResult(sqlmock.NewResult(0, 1))
+
+    handler := UpdateUserRoleHandler(db)
+
+    body, _ := json.Marshal(map[string]string{"username": "volunteer", "role": "ranger"})
+    req, _ := http.NewRequest("POST", "/users/role", bytes.NewBuffer(body))
+    w := httptest.NewRecorder()
+    handler.ServeHTTP(w, req)
+
+    if status := w.Code; status != http.StatusOK {
+        t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+    }
+
+    var u models.User
+    if err := json.NewDecoder(w.Body).Decode(&u); err != nil || u.Role != models.RoleRanger {
+        t.Errorf("Handler returned unexpected body: role %v, err %v", u.Role, err)
+    }
+
+    // Unknown roles are rejected before touching the database
+    body, _ = json.Marshal(map[string]string{"username": "volunteer", "role": "overlord"})
+    req, _ = http.NewRequest("POST", "/users/role", bytes.NewBuffer(body))
+    w = httptest.NewRecorder()
+    handler.ServeHTTP(w, req)
+
+    if status := w.Code; status != http.StatusBadRequest {
+        t.Errorf("Handler returned wrong status code for unknown role: got %v want %v", status, http.StatusBadRequest)
+    }
+
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("There were unfulfilled expectations: %s", err)
+    }
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ravirajdarisi/tigerhall-kittens/auth"
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+)
+
+// emailVerificationTTL is how long an emailed verification link stays valid.
+const emailVerificationTTL = 48 * time.Hour
+
+// sendVerificationEmail queues an email with a signed link that confirms the user's address.
+func sendVerificationEmail(emailQueue chan EmailMessage, user *models.User) error {
+	token, _, err := auth.IssueEmailToken(user.ID, user.Email, auth.PurposeVerifyEmail, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := appBaseURL() + "/users/verify?token=" + url.QueryEscape(token)
+	queueEmail(emailQueue, EmailMessage{
+		UserID:  user.ID,
+		To:      user.Email,
+		Subject: "Confirm your Tigerhall Kittens email address",
+		Body:    fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below. It expires in %v.\n\n%s\n", user.Username, emailVerificationTTL, link),
+	})
+	return nil
+}
+
+// VerifyEmailHandler confirms a user's email address using the signed link from the verification email.
+func VerifyEmailHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.ParseToken(r.URL.Query().Get("token"), auth.PurposeVerifyEmail)
+		if err != nil {
+			http.Error(w, "Invalid or expired verification link", http.StatusBadRequest)
+			return
+		}
+
+		user, err := models.GetUserByID(db, claims.Subject)
+		if err != nil || user.Email != claims.Email {
+			// The address changed since the link was sent
+			http.Error(w, "Invalid or expired verification link", http.StatusBadRequest)
+			return
+		}
+
+		if !user.Verified() {
+			if err := user.MarkVerified(db); err != nil {
+				http.Error(w, "Error verifying email address", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(struct{ Status string }{"Email address verified"})
+	}
+}
+
+// ResendVerificationHandler sends a fresh verification email to the authenticated user.
+func ResendVerificationHandler(emailQueue chan EmailMessage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			writeErrorResponse(w, http.StatusUnauthorized, "UNAUTHORIZED", "A valid access token is required.")
+			return
+		}
+
+		if user.Verified() {
+			http.Error(w, "Email address is already verified", http.StatusConflict)
+			return
+		}
+
+		if err := sendVerificationEmail(emailQueue, user); err != nil {
+			http.Error(w, "Error sending verification email", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(struct{ Status string }{"Verification email sent"})
+	}
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ravirajdarisi/tigerhall-kittens/auth"
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyEmailHandler(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	token, _, err := auth.IssueEmailToken(1, "test@example.com", auth.PurposeVerifyEmail, time.Hour)
+	require.NoError(t, err)
+
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id =").
+		WithArgs(1).
+		WillReturnRows(mockUserRows(models.User{ID: 1, Username: "testuser", Email: "test@example.com", Role: models.RoleReporter}))
+	mock.ExpectExec("UPDATE users SET verified_at").
+		WithArgs(1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rr := httptest.NewRecorder()
+	VerifyEmailHandler(db).ServeHTTP(rr, httptest.NewRequest("GET", "/users/verify?token="+url.QueryEscape(token), nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVerifyEmailHandler_ChangedEmail(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	token, _, err := auth.IssueEmailToken(1, "old@example.com", auth.PurposeVerifyEmail, time.Hour)
+	require.NoError(t, err)
+
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id =").
+		WithArgs(1).
+		WillReturnRows(mockUserRows(models.User{ID: 1, Username: "testuser", Email: "new@example.com", Role: models.RoleReporter}))
+
+	rr := httptest.NewRecorder()
+	VerifyEmailHandler(db).ServeHTTP(rr, httptest.NewRequest("GET", "/users/verify?token="+url.QueryEscape(token), nil))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVerifyEmailHandler_AccessTokenRejected(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	token, _, err := auth.IssueToken(1, auth.PurposeAccess, time.Hour)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	VerifyEmailHandler(db).ServeHTTP(rr, httptest.NewRequest("GET", "/users/verify?token="+url.QueryEscape(token), nil))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"github.com/ravirajdarisi/tigerhall-kittens/db"
 	"github.com/ravirajdarisi/tigerhall-kittens/handlers"
+	"github.com/ravirajdarisi/tigerhall-kittens/models"
+	"github.com/ravirajdarisi/tigerhall-kittens/storage"
 	"log"
 	"net/http"
 	"os"
@@ -15,11 +17,13 @@ import (
 )
 
 var notificationQueue chan handlers.NotificationMessage
+var emailQueue chan handlers.EmailMessage
 var wg sync.WaitGroup
 
 func main() {
 	// Initialize the notificationQueue
 	notificationQueue = make(chan handlers.NotificationMessage, 100)
+	emailQueue = make(chan handlers.EmailMessage, 100)
 
 	// Setup database configuration
 	dbConfig := db.DBConfig{
@@ -42,12 +46,18 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Blob store for sighting images, selected by BLOB_STORE
+	images, err := storage.FromEnv()
+	if err != nil {
+		log.Fatalf("Could not configure the image storage: %v", err)
+	}
+
 	// Initialize HTTP routes
-	setupRoutes(db, ctx)
+	setupRoutes(db, images, ctx)
 
 	// Start the notification processor
 	wg.Add(1)
-	go startNotificationProcessor(ctx)
+	go startNotificationProcessor(ctx, db)
 
 	// Start HTTP server in a goroutine
 	server := &http.Server{Addr: ":8080", Handler: nil}
@@ -63,17 +73,74 @@ func main() {
 	gracefulShutdown(ctx, server)
 }
 
-func setupRoutes(db *sql.DB, ctx context.Context) {
+func setupRoutes(db *sql.DB, images storage.Store, ctx context.Context) {
 
 	sightingRepo := handlers.NewDBSightingRepository(db)
 	// list of all handlers
 	// use the above ctx to handlers for proper graceful shutdowns
-	http.HandleFunc("/users/create", handlers.CreateUserHandler(db))
+	http.HandleFunc("/users/create", handlers.CreateUserHandler(db, emailQueue))
 	http.HandleFunc("/users/login", handlers.LoginHandler(db))
-	http.HandleFunc("/tigers/create", handlers.CreateTigerHandler(db))
+	http.HandleFunc("/users/login/2fa", handlers.LoginTwoFactorHandler(db))
+	http.HandleFunc("/users/2fa/enroll", handlers.RequireAuthOrEnrollment(db, handlers.EnrollTOTPHandler(db)))
+	http.HandleFunc("/users/2fa/confirm", handlers.RequireAuthOrEnrollment(db, handlers.ConfirmTOTPHandler(db)))
+	http.HandleFunc("/users/2fa/disable", handlers.RequireAuth(db, handlers.DisableTOTPHandler(db)))
+	http.HandleFunc("/users/apikeys/create", handlers.RequireAuth(db, handlers.CreateAPIKeyHandler(db)))
+	http.HandleFunc("/users/apikeys/list", handlers.RequireAuth(db, handlers.ListAPIKeysHandler(db)))
+	http.HandleFunc("/users/apikeys/revoke", handlers.RequireAuth(db, handlers.RevokeAPIKeyHandler(db)))
+	http.HandleFunc("/users/refresh", handlers.RefreshHandler(db))
+	http.HandleFunc("/users/logout", handlers.LogoutHandler(db))
+	http.HandleFunc("/users/verify", handlers.VerifyEmailHandler(db))
+	http.HandleFunc("/users/verify/resend", handlers.RequireAuth(db, handlers.ResendVerificationHandler(emailQueue)))
+	http.HandleFunc("/users/password/forgot", handlers.ForgotPasswordHandler(db, emailQueue))
+	http.HandleFunc("/users/password/reset", handlers.ResetPasswordHandler(db))
+	http.Handle("/users/me", handlers.Methods{
+		http.MethodGet:   handlers.RequireAuth(db, handlers.GetProfileHandler()),
+		http.MethodPatch: handlers.RequireAuth(db, handlers.UpdateProfileHandler(db, emailQueue)),
+	})
+	http.HandleFunc("/users/me/export", handlers.RequireAuth(db, handlers.ExportDataHandler(db, images)))
+	http.HandleFunc("/users/me/erase", handlers.RequireAuth(db, handlers.EraseAccountHandler(db)))
+	http.Handle("/users/", handlers.Resource{Prefix: "/users/", Routes: map[string]http.Handler{
+		"": handlers.Methods{
+			http.MethodGet: handlers.RequirePermission(db, models.PermissionManageUsers, handlers.GetUserHandler(db)),
+		},
+	}})
+	http.HandleFunc("/users/list", handlers.RequirePermission(db, models.PermissionManageUsers, handlers.ListUsersHandler(db)))
+	http.HandleFunc("/users/deactivate", handlers.RequirePermission(db, models.PermissionManageUsers, handlers.DeactivateUserHandler(db)))
+	http.HandleFunc("/users/erase", handlers.RequirePermission(db, models.PermissionManageUsers, handlers.EraseUserHandler(db)))
+	http.HandleFunc("/users/unlock", handlers.RequirePermission(db, models.PermissionManageUsers, handlers.UnlockUserHandler(db)))
+	http.HandleFunc("/users/role", handlers.RequirePermission(db, models.PermissionManageUsers, handlers.UpdateUserRoleHandler(db)))
+	http.HandleFunc("/tigers/create", handlers.RequirePermission(db, models.PermissionManageTigers, handlers.CreateTigerHandler(db)))
+	http.HandleFunc("/tigers/merge", handlers.RequirePermission(db, models.PermissionMergeTigers, handlers.MergeTigersHandler(db)))
 	http.HandleFunc("/tigers/list", handlers.ListAllTigersHandler(db))
-	http.HandleFunc("/sightings/create", handlers.CreateSightingHandler(sightingRepo, notificationQueue))
+	http.HandleFunc("/tigers/nearby", handlers.NearbyTigersHandler(db))
+	http.Handle("/tigers/", handlers.Resource{Prefix: "/tigers/", Routes: map[string]http.Handler{
+		"": handlers.Methods{
+			http.MethodGet:   handlers.GetTigerHandler(db),
+			http.MethodPatch: handlers.RequirePermission(db, models.PermissionManageTigers, handlers.UpdateTigerHandler(db)),
+		},
+		"family": handlers.Methods{
+			http.MethodGet: handlers.GetTigerFamilyHandler(db),
+		},
+	}})
+	http.HandleFunc("/sightings/create", handlers.RequirePermission(db, models.PermissionCreateSighting, handlers.RequireVerifiedEmail(handlers.CreateSightingHandler(sightingRepo, images, notificationQueue))))
 	http.HandleFunc("/sightings/list", handlers.ListSightingsHandler(db))
+	http.Handle("/sightings/rules", handlers.Methods{
+		http.MethodGet: handlers.RequirePermission(db, models.PermissionManageSightingRules, handlers.ListSightingRulesHandler(db)),
+		http.MethodPut: handlers.RequirePermission(db, models.PermissionManageSightingRules, handlers.SaveSightingRuleHandler(db)),
+	})
+	http.Handle("/sightings/rules/", handlers.Resource{Prefix: "/sightings/rules/", Routes: map[string]http.Handler{
+		"": handlers.Methods{
+			http.MethodDelete: handlers.RequirePermission(db, models.PermissionManageSightingRules, handlers.DeleteSightingRuleHandler(db)),
+		},
+	}})
+	// Images are served at /images/{sighting id} and resized at /images/{sighting id}/{size}
+	getImage := handlers.GetImageHandler(db, images, "")
+	imageRoutes := map[string]http.Handler{"": handlers.Methods{http.MethodGet: getImage, http.MethodHead: getImage}}
+	for size := range handlers.ImageSizes {
+		getVariant := handlers.GetImageHandler(db, images, size)
+		imageRoutes[size] = handlers.Methods{http.MethodGet: getVariant, http.MethodHead: getVariant}
+	}
+	http.Handle("/images/", handlers.Resource{Prefix: "/images/", Routes: imageRoutes})
 
 }
 
@@ -90,31 +157,46 @@ func gracefulShutdown(ctx context.Context, server *http.Server) {
 	}
 
 	close(notificationQueue) // Close the notification channel
+	close(emailQueue)        // Close the email channel
 	wg.Wait()                // Wait for the notification processor to finish
 
 	fmt.Println("Server shutdown gracefully")
 }
 
-func startNotificationProcessor(ctx context.Context) {
+func startNotificationProcessor(ctx context.Context, db *sql.DB) {
 	defer wg.Done()
 
-	for {
+	// A closed queue is set to nil so the select stops reading from it
+	notifications, emails := notificationQueue, emailQueue
+	for notifications != nil || emails != nil {
 		select {
-		case message, ok := <-notificationQueue:
+		case message, ok := <-notifications:
 			if !ok {
-				fmt.Println("Notification queue closed, stopping processor")
-				return // Exit the loop and goroutine
+				notifications = nil
+				continue
 			}
 			log.Printf("Processing notification for User IDs: %v, for Tiger ID: %d", message.UserIDs, message.TigerID)
 			for _, userID := range message.UserIDs {
 				log.Printf("Sending email to User ID: %d, for Tiger ID: %d", userID, message.TigerID)
 				sendEmailToUser(userID, message.TigerID)
+				tigerID := message.TigerID
+				recordNotification(db, models.NewNotification(userID, models.NotificationSighting, fmt.Sprintf("Tiger %d was sighted again", tigerID), &tigerID))
+			}
+		case email, ok := <-emails:
+			if !ok {
+				emails = nil
+				continue
+			}
+			sendEmail(email)
+			if email.UserID > 0 {
+				recordNotification(db, models.NewNotification(email.UserID, models.NotificationEmail, email.Subject, nil))
 			}
 		case <-ctx.Done():
 			fmt.Println("Shutdown signal received, stopping notification processor")
 			return // Exit the loop and goroutine
 		}
 	}
+	fmt.Println("Notification queues closed, stopping processor")
 }
 
 
@@ -123,3 +205,16 @@ func sendEmailToUser(userID int, tigerID int) {
 	log.Print("inside main notification in the main block")
 	fmt.Printf("Sending email to user %d about tiger %d\n", userID, tigerID)
 }
+
+// recordNotification keeps the notification history that users can export.
+func recordNotification(db *sql.DB, notification *models.Notification) {
+	if err := notification.Save(db); err != nil {
+		log.Printf("Failed to record notification for User ID %d: %v", notification.UserID, err)
+	}
+}
+
+func sendEmail(message handlers.EmailMessage) {
+	// Placeholder for email sending logic. The body holds live reset and
+	// verification tokens, so it is left to a real mail sender and never logged.
+	log.Printf("Sending email %q to %s", message.Subject, message.To)
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// APIKey is a long-lived credential that lets a machine client act on behalf of
+// its owner, limited to the permissions in Scopes. Only the hash of the key is stored.
+type APIKey struct {
+	ID         int          `json:"id"`
+	UserID     int          `json:"user_id"`
+	Name       string       `json:"name"`
+	Prefix     string       `json:"prefix"`
+	KeyHash    string       `json:"-"`
+	Scopes     []Permission `json:"scopes"`
+	LastUsedAt *time.Time   `json:"last_used_at"`
+	ExpiresAt  *time.Time   `json:"expires_at"`
+	RevokedAt  *time.Time   `json:"revoked_at"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// apiKeyColumns is the column list scanned by scanAPIKey.
+const apiKeyColumns = `id, user_id, name, prefix, key_hash, scopes, last_used_at, expires_at, revoked_at, created_at`
+
+// apiKeyTouchInterval limits how often last_used_at is written for a busy key.
+const apiKeyTouchInterval = time.Minute
+
+// NewAPIKey creates a new APIKey instance.
+func NewAPIKey(userID int, name, prefix, keyHash string, scopes []Permission, expiresAt *time.Time) *APIKey {
+	return &APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   keyHash,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+}
+
+// Save inserts the APIKey into the database.
+func (k *APIKey) Save(db *sql.DB) error {
+	query := `INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+	return db.QueryRow(query, k.UserID, k.Name, k.Prefix, k.KeyHash, pq.Array(permissionStrings(k.Scopes)), k.ExpiresAt, k.CreatedAt).Scan(&k.ID)
+}
+
+// Active reports whether the key is neither revoked nor expired.
+func (k *APIKey) Active() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || time.Now().Before(*k.ExpiresAt))
+}
+
+// Allows reports whether the permission is within the scopes of the key.
+func (k *APIKey) Allows(p Permission) bool {
+	for _, scope := range k.Scopes {
+		if scope == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Touch records that the key has just been used.
+func (k *APIKey) Touch(db *sql.DB) error {
+	now := time.Now()
+	query := `UPDATE api_keys SET last_used_at = $2 WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $3)`
+	if _, err := db.Exec(query, k.ID, now, now.Add(-apiKeyTouchInterval)); err != nil {
+		return err
+	}
+	k.LastUsedAt = &now
+	return nil
+}
+
+// GetAPIKeyByHash fetches the API key with the given hash from the database.
+func GetAPIKeyByHash(db *sql.DB, keyHash string) (*APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1`
+	return scanAPIKey(db.QueryRow(query, keyHash))
+}
+
+// GetAPIKeysByUserID retrieves all API keys owned by a user, newest first.
+func GetAPIKeysByUserID(db *sql.DB, userID int) ([]APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC`
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *k)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes the key with the given ID if it belongs to the user. It
+// returns false if there is no such unrevoked key.
+func RevokeAPIKey(db *sql.DB, id, userID int) (bool, error) {
+	query := `UPDATE api_keys SET revoked_at = $3 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	result, err := db.Exec(query, id, userID, time.Now())
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	k := APIKey{}
+	var scopes pq.StringArray
+	err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.KeyHash, &scopes, &k.LastUsedAt, &k.ExpiresAt, &k.RevokedAt, &k.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	for _, scope := range scopes {
+		k.Scopes = append(k.Scopes, Permission(scope))
+	}
+	return &k, nil
+}
+
+func permissionStrings(permissions []Permission) []string {
+	values := make([]string, len(permissions))
+	for i, p := range permissions {
+		values[i] = string(p)
+	}
+	return values
+}
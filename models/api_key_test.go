@@ -0,0 +1,123 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var apiKeyTestColumns = []string{"id", "user_id", "name", "prefix", "key_hash", "scopes", "last_used_at", "expires_at", "revoked_at", "created_at"}
+
+func TestAPIKey_Save(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	key := NewAPIKey(1, "camera relay", "thk_abcd", "hash", []Permission{PermissionCreateSighting}, nil)
+
+	mock.ExpectQuery("INSERT INTO api_keys").
+		WithArgs(1, "camera relay", "thk_abcd", "hash", "{\"sightings:create\"}", nil, key.CreatedAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+
+	require.NoError(t, key.Save(db))
+	assert.Equal(t, 3, key.ID)
+	assert.True(t, key.Active())
+	assert.True(t, key.Allows(PermissionCreateSighting))
+	assert.False(t, key.Allows(PermissionManageTigers))
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIKey_Active(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	assert.True(t, (&APIKey{ExpiresAt: &future}).Active())
+	assert.False(t, (&APIKey{ExpiresAt: &past}).Active())
+	assert.False(t, (&APIKey{RevokedAt: &past}).Active())
+}
+
+func TestGetAPIKeyByHash(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	rows := sqlmock.NewRows(apiKeyTestColumns).
+		AddRow(3, 1, "camera relay", "thk_abcd", "hash", "{sightings:create}", nil, nil, nil, time.Now())
+
+	mock.ExpectQuery("SELECT (.+) FROM api_keys WHERE key_hash =").
+		WithArgs("hash").
+		WillReturnRows(rows)
+
+	key, err := GetAPIKeyByHash(db, "hash")
+	require.NoError(t, err)
+	assert.Equal(t, 1, key.UserID)
+	assert.Equal(t, []Permission{PermissionCreateSighting}, key.Scopes)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetAPIKeysByUserID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	rows := sqlmock.NewRows(apiKeyTestColumns).
+		AddRow(4, 1, "second", "thk_efgh", "hash2", "{sightings:create}", time.Now(), nil, nil, time.Now()).
+		AddRow(3, 1, "first", "thk_abcd", "hash1", "{sightings:create,tigers:manage}", nil, nil, time.Now(), time.Now())
+
+	mock.ExpectQuery("SELECT (.+) FROM api_keys WHERE user_id = \\$1 ORDER BY created_at DESC").
+		WithArgs(1).
+		WillReturnRows(rows)
+
+	keys, err := GetAPIKeysByUserID(db, 1)
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.NotNil(t, keys[0].LastUsedAt)
+	assert.False(t, keys[1].Active())
+	assert.Len(t, keys[1].Scopes, 2)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE api_keys SET revoked_at").
+		WithArgs(3, 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE api_keys SET revoked_at").
+		WithArgs(3, 2, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	revoked, err := RevokeAPIKey(db, 3, 1)
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	// Another user's key can not be revoked.
+	revoked, err = RevokeAPIKey(db, 3, 2)
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIKey_Touch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	key := &APIKey{ID: 3}
+	mock.ExpectExec("UPDATE api_keys SET last_used_at").
+		WithArgs(3, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, key.Touch(db))
+	assert.NotNil(t, key.LastUsedAt)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrDuplicateUsername is returned when a username is already taken.
+	ErrDuplicateUsername = errors.New("username already exists")
+	// ErrDuplicateEmail is returned when an email address is already registered.
+	ErrDuplicateEmail = errors.New("email already exists")
+	// ErrDuplicateTigerName is returned when another tiger already has the name.
+	ErrDuplicateTigerName = errors.New("tiger name already exists")
+)
+
+// uniqueViolation is the PostgreSQL error code for unique constraint violations.
+const uniqueViolation = "23505"
+
+// translateUniqueViolation maps a unique violation on one of the given
+// constraints to its error. Any other error is returned unchanged.
+func translateUniqueViolation(err error, constraints map[string]error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != uniqueViolation {
+		return err
+	}
+	if mapped, ok := constraints[pqErr.Constraint]; ok {
+		return mapped
+	}
+	return err
+}
+
+// translateUserError maps unique violations on the users table to the matching error.
+func translateUserError(err error) error {
+	return translateUniqueViolation(err, map[string]error{
+		"users_email_key":    ErrDuplicateEmail,
+		"users_username_key": ErrDuplicateUsername,
+	})
+}
+
+// translateTigerError maps unique violations on the tigers table and its
+// identification codes to the matching error.
+func translateTigerError(err error) error {
+	return translateUniqueViolation(err, map[string]error{
+		"tigers_name_key":                     ErrDuplicateTigerName,
+		"tiger_identification_codes_code_key": ErrDuplicateIdentificationCode,
+	})
+}
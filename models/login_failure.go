@@ -0,0 +1,60 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// LoginFailure counts consecutive login attempts for a username or a client address
+// that did not succeed.
+type LoginFailure struct {
+	Key          string    `json:"key"`
+	Failures     int       `json:"failures"`
+	LastFailedAt time.Time `json:"last_failed_at"`
+}
+
+// UserLoginFailureKey returns the key failed logins for a username are tracked under.
+func UserLoginFailureKey(username string) string {
+	return "user:" + username
+}
+
+// IPLoginFailureKey returns the key failed logins from a client address are tracked under.
+func IPLoginFailureKey(ip string) string {
+	return "ip:" + ip
+}
+
+// RecordLoginAttempt counts a login attempt for the key before its credentials
+// are checked, in a single statement, so concurrent attempts each see a higher
+// count. A counter whose last attempt is older than resetAfter starts again from
+// one. The counter is returned as it was before this attempt, which is what
+// decides whether the attempt is allowed.
+func RecordLoginAttempt(db *sql.DB, key string, resetAfter time.Duration) (LoginFailure, error) {
+	query := `INSERT INTO login_failures (key, failures, last_failed_at) VALUES ($1, 1, $2)
+	          ON CONFLICT (key) DO UPDATE SET
+	            failures = CASE WHEN login_failures.last_failed_at < $3 THEN 1 ELSE login_failures.failures + 1 END,
+	            previous_failed_at = CASE WHEN login_failures.last_failed_at < $3 THEN NULL ELSE login_failures.last_failed_at END,
+	            last_failed_at = $2
+	          RETURNING failures, previous_failed_at`
+	now := time.Now()
+	var attempts int
+	var previous sql.NullTime
+	if err := db.QueryRow(query, key, now, now.Add(-resetAfter)).Scan(&attempts, &previous); err != nil {
+		return LoginFailure{}, err
+	}
+	return LoginFailure{Key: key, Failures: attempts - 1, LastFailedAt: previous.Time}, nil
+}
+
+// ReleaseLoginAttempt takes back an attempt counted by RecordLoginAttempt once
+// its credentials turned out to be right.
+func ReleaseLoginAttempt(db *sql.DB, key string) error {
+	query := `UPDATE login_failures SET failures = GREATEST(failures - 1, 0) WHERE key = $1`
+	_, err := db.Exec(query, key)
+	return err
+}
+
+// ClearLoginFailures forgets all failed logins recorded for the key.
+func ClearLoginFailures(db *sql.DB, key string) error {
+	query := `DELETE FROM login_failures WHERE key = $1`
+	_, err := db.Exec(query, key)
+	return err
+}
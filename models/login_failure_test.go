@@ -0,0 +1,62 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordLoginAttempt(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	previous := time.Now().Add(-time.Minute)
+	mock.ExpectQuery("INSERT INTO login_failures (.+) ON CONFLICT \\(key\\) DO UPDATE (.+) RETURNING failures, previous_failed_at").
+		WithArgs("user:testuser", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"failures", "previous_failed_at"}).AddRow(5, previous))
+	mock.ExpectQuery("INSERT INTO login_failures").
+		WithArgs("ip:10.0.0.1", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"failures", "previous_failed_at"}).AddRow(1, nil))
+
+	// The counter is returned as it was before the attempt.
+	before, err := RecordLoginAttempt(db, UserLoginFailureKey("testuser"), time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, LoginFailure{Key: "user:testuser", Failures: 4, LastFailedAt: previous}, before)
+
+	before, err = RecordLoginAttempt(db, IPLoginFailureKey("10.0.0.1"), time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 0, before.Failures)
+	assert.True(t, before.LastFailedAt.IsZero())
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReleaseLoginAttempt(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE login_failures SET failures = GREATEST\\(failures - 1, 0\\) WHERE key = \\$1").
+		WithArgs("ip:10.0.0.1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, ReleaseLoginAttempt(db, "ip:10.0.0.1"))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClearLoginFailures(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("DELETE FROM login_failures WHERE key =").
+		WithArgs("user:testuser").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, ClearLoginFailures(db, "user:testuser"))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
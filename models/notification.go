@@ -0,0 +1,64 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Kinds of notifications sent to users.
+const (
+	NotificationSighting = "sighting"
+	NotificationEmail    = "email"
+)
+
+// Notification records a message that was sent to a user.
+type Notification struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Kind      string    `json:"kind"`
+	TigerID   *int      `json:"tiger_id,omitempty"`
+	Subject   string    `json:"subject"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NewNotification creates a new Notification sent now.
+func NewNotification(userID int, kind, subject string, tigerID *int) *Notification {
+	return &Notification{
+		UserID:    userID,
+		Kind:      kind,
+		TigerID:   tigerID,
+		Subject:   subject,
+		CreatedAt: time.Now(),
+	}
+}
+
+// Save inserts the Notification into the database.
+func (n *Notification) Save(db *sql.DB) error {
+	query := `INSERT INTO notifications (user_id, kind, tiger_id, subject, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	return db.QueryRow(query, n.UserID, n.Kind, n.TigerID, n.Subject, n.CreatedAt).Scan(&n.ID)
+}
+
+// GetNotificationsByUserID retrieves every notification sent to the user, newest first.
+func GetNotificationsByUserID(db *sql.DB, userID int) ([]Notification, error) {
+	query := `SELECT id, user_id, kind, tiger_id, subject, created_at FROM notifications WHERE user_id = $1 ORDER BY created_at DESC`
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var n Notification
+		var tigerID sql.NullInt64
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Kind, &tigerID, &n.Subject, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		n.TigerID = nullIntPtr(tigerID)
+		notifications = append(notifications, n)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
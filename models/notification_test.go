@@ -0,0 +1,49 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotification_Save(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	tigerID := 5
+	notification := NewNotification(7, NotificationSighting, "Tiger 5 was sighted again", &tigerID)
+
+	mock.ExpectQuery("INSERT INTO notifications").
+		WithArgs(7, NotificationSighting, &tigerID, "Tiger 5 was sighted again", notification.CreatedAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+
+	require.NoError(t, notification.Save(db))
+	assert.Equal(t, 9, notification.ID)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetNotificationsByUserID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT id, user_id, kind, tiger_id, subject, created_at FROM notifications WHERE user_id = \\$1").
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "kind", "tiger_id", "subject", "created_at"}).
+			AddRow(2, 7, NotificationSighting, 5, "Tiger 5 was sighted again", time.Now()).
+			AddRow(1, 7, NotificationEmail, nil, "Confirm your Tigerhall Kittens email address", time.Now()))
+
+	notifications, err := GetNotificationsByUserID(db, 7)
+	require.NoError(t, err)
+	require.Len(t, notifications, 2)
+	require.NotNil(t, notifications[0].TigerID)
+	assert.Equal(t, 5, *notifications[0].TigerID)
+	assert.Nil(t, notifications[1].TigerID)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
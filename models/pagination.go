@@ -0,0 +1,69 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// MaxPageSize is the largest number of rows a list returns at once.
+const MaxPageSize = 100
+
+// ErrInvalidCursor is returned for a cursor that was not issued by this API.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks the edge of a page in keyset pagination: the sort key and ID of
+// the first or last row on it. A backward cursor asks for the rows before it,
+// any other cursor for the rows after it. Sort records the order the cursor was
+// issued for, as the key means nothing in another order.
+type Cursor struct {
+	Sort     string `json:"s"`
+	Key      string `json:"k,omitempty"`
+	ID       int    `json:"id"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+// Encode returns the cursor as an opaque string for clients to send back.
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a cursor returned by Encode.
+func DecodeCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID <= 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// keyset returns the condition selecting the rows beyond the cursor and the
+// ORDER BY clause to read them in. column and key are compared as a row with
+// the id column and the cursor's ID, placed at idArg. A backward cursor reads
+// in the reverse order, so the caller must reverse the rows it gets.
+func keyset(column, key, idArg string, descending bool, cursor *Cursor) (condition, orderBy string) {
+	if cursor != nil && cursor.Backward {
+		descending = !descending
+	}
+	direction, comparison := "ASC", ">"
+	if descending {
+		direction, comparison = "DESC", "<"
+	}
+	if column == "id" {
+		orderBy = "id " + direction
+		if cursor != nil {
+			condition = "id " + comparison + " " + idArg
+		}
+		return condition, orderBy
+	}
+	orderBy = column + " " + direction + ", id " + direction
+	if cursor != nil {
+		condition = "(" + column + ", id) " + comparison + " (" + key + ", " + idArg + ")"
+	}
+	return condition, orderBy
+}
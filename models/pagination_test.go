@@ -0,0 +1,39 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursor_EncodeDecode(t *testing.T) {
+	cursor := Cursor{Sort: "-lastSeen", Key: "2024-03-01T10:00:00Z", ID: 42, Backward: true}
+
+	decoded, err := DecodeCursor(cursor.Encode())
+	require.NoError(t, err)
+	assert.Equal(t, cursor, *decoded)
+
+	for _, raw := range []string{"not a cursor!", "e30", ""} {
+		_, err := DecodeCursor(raw)
+		assert.Equal(t, ErrInvalidCursor, err, raw)
+	}
+}
+
+func TestKeyset(t *testing.T) {
+	condition, orderBy := keyset("last_seen_timestamp", "$3", "$4", true, nil)
+	assert.Empty(t, condition)
+	assert.Equal(t, "last_seen_timestamp DESC, id DESC", orderBy)
+
+	condition, orderBy = keyset("last_seen_timestamp", "$3", "$4", true, &Cursor{ID: 1})
+	assert.Equal(t, "(last_seen_timestamp, id) < ($3, $4)", condition)
+	assert.Equal(t, "last_seen_timestamp DESC, id DESC", orderBy)
+
+	condition, orderBy = keyset("last_seen_timestamp", "$3", "$4", true, &Cursor{ID: 1, Backward: true})
+	assert.Equal(t, "(last_seen_timestamp, id) > ($3, $4)", condition)
+	assert.Equal(t, "last_seen_timestamp ASC, id ASC", orderBy)
+
+	condition, orderBy = keyset("id", "", "$2", false, &Cursor{ID: 1})
+	assert.Equal(t, "id > $2", condition)
+	assert.Equal(t, "id ASC", orderBy)
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordResetToken represents a single-use password reset token. Only the hash of the token is stored.
+type PasswordResetToken struct {
+	ID        int          `json:"id"`
+	UserID    int          `json:"user_id"`
+	TokenHash string       `json:"-"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	UsedAt    sql.NullTime `json:"-"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// NewPasswordResetToken creates a new PasswordResetToken instance for the given user.
+func NewPasswordResetToken(userID int, tokenHash string, ttl time.Duration) *PasswordResetToken {
+	now := time.Now()
+	return &PasswordResetToken{
+		UserID:    userID,
+		TokenHash: tokenHash,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+}
+
+// Save inserts the PasswordResetToken into the database.
+func (t *PasswordResetToken) Save(db *sql.DB) error {
+	query := `INSERT INTO password_reset_tokens (user_id, token_hash, expires_at, created_at) VALUES ($1, $2, $3, $4) RETURNING id`
+	return db.QueryRow(query, t.UserID, t.TokenHash, t.ExpiresAt, t.CreatedAt).Scan(&t.ID)
+}
+
+// Usable reports whether the token is neither used nor expired.
+func (t *PasswordResetToken) Usable() bool {
+	return !t.UsedAt.Valid && time.Now().Before(t.ExpiresAt)
+}
+
+// ErrInvalidResetToken is returned by ResetPassword for a token that is unknown,
+// expired or already used.
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+// ResetPassword consumes the password reset token with the given hash and sets
+// the new password of its user within one transaction, so the token is only
+// used up when the password is changed. Concurrent resets with the same token
+// can not both succeed.
+func ResetPassword(db *sql.DB, tokenHash, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var userID int
+	query := `UPDATE password_reset_tokens SET used_at = $2 WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2 RETURNING user_id`
+	err = tx.QueryRow(query, tokenHash, now).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+	if err := setPasswordHash(tx, userID, string(hashedPassword), now); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetPasswordResetTokenByHash fetches the password reset token with the given hash from the database.
+func GetPasswordResetTokenByHash(db *sql.DB, tokenHash string) (*PasswordResetToken, error) {
+	query := `SELECT id, user_id, token_hash, expires_at, used_at, created_at FROM password_reset_tokens WHERE token_hash = $1`
+	t := PasswordResetToken{}
+	err := db.QueryRow(query, tokenHash).Scan(&t.ID, &t.UserID, &t.TokenHash, &t.ExpiresAt, &t.UsedAt, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// InvalidatePasswordResetTokensByUserID marks every outstanding reset token of a user as used.
+func InvalidatePasswordResetTokensByUserID(db *sql.DB, userID int) error {
+	query := `UPDATE password_reset_tokens SET used_at = $2 WHERE user_id = $1 AND used_at IS NULL`
+	_, err := db.Exec(query, userID, time.Now())
+	return err
+}
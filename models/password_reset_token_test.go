@@ -0,0 +1,93 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordResetToken_Save(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	token := NewPasswordResetToken(1, "hash", time.Hour)
+
+	mock.ExpectQuery("INSERT INTO password_reset_tokens").
+		WithArgs(1, "hash", token.ExpiresAt, token.CreatedAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+
+	require.NoError(t, token.Save(db))
+	assert.Equal(t, 9, token.ID)
+	assert.True(t, token.Usable())
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResetPassword(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	// The token is consumed in the transaction that changes the password.
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE password_reset_tokens SET used_at = \\$2 WHERE token_hash = \\$1 AND used_at IS NULL AND expires_at > \\$2 RETURNING user_id").
+		WithArgs("token-hash", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(3))
+	mock.ExpectExec("UPDATE users SET password_hash").WithArgs(3, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE password_reset_tokens SET used_at").WithArgs(3, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE refresh_tokens SET revoked_at").WithArgs(3, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	require.NoError(t, ResetPassword(db, "token-hash", "new-password"))
+
+	// A token used by a concurrent reset is refused.
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE password_reset_tokens SET used_at").
+		WithArgs("token-hash", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+	mock.ExpectRollback()
+	assert.Equal(t, ErrInvalidResetToken, ResetPassword(db, "token-hash", "new-password"))
+
+	// A failure to change the password leaves the token unused.
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE password_reset_tokens SET used_at").
+		WithArgs("token-hash", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(3))
+	mock.ExpectExec("UPDATE users SET password_hash").WillReturnError(fmt.Errorf("connection reset"))
+	mock.ExpectRollback()
+	assert.EqualError(t, ResetPassword(db, "token-hash", "new-password"), "connection reset")
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPasswordResetTokenByHash(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"id", "user_id", "token_hash", "expires_at", "used_at", "created_at"}).
+		AddRow(9, 1, "hash", time.Now().Add(-time.Minute), nil, time.Now().Add(-time.Hour))
+
+	mock.ExpectQuery("SELECT id, user_id, token_hash, expires_at, used_at, created_at FROM password_reset_tokens WHERE token_hash =").
+		WithArgs("hash").
+		WillReturnRows(rows)
+
+	token, err := GetPasswordResetTokenByHash(db, "hash")
+	require.NoError(t, err)
+	assert.Equal(t, 1, token.UserID)
+	assert.False(t, token.Usable(), "an expired token must not be usable")
+
+	mock.ExpectQuery("SELECT (.+) FROM password_reset_tokens WHERE token_hash =").
+		WithArgs("missing").
+		WillReturnError(sql.ErrNoRows)
+
+	_, err = GetPasswordResetTokenByHash(db, "missing")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
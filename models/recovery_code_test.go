@@ -0,0 +1,54 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplaceRecoveryCodes(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM recovery_codes WHERE user_id =").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectExec("INSERT INTO recovery_codes").
+		WithArgs(1, "hash-a").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO recovery_codes").
+		WithArgs(1, "hash-b").
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, ReplaceRecoveryCodes(db, 1, []string{"hash-a", "hash-b"}))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUseRecoveryCode(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE recovery_codes SET used_at").
+		WithArgs(1, "hash-a", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE recovery_codes SET used_at").
+		WithArgs(1, "hash-a", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	used, err := UseRecoveryCode(db, 1, "hash-a")
+	require.NoError(t, err)
+	assert.True(t, used)
+
+	// The same code can not be used twice.
+	used, err = UseRecoveryCode(db, 1, "hash-a")
+	require.NoError(t, err)
+	assert.False(t, used)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
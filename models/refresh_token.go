@@ -0,0 +1,76 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// RefreshToken represents a persisted refresh token. Only the hash of the token is stored.
+type RefreshToken struct {
+	ID        int          `json:"id"`
+	UserID    int          `json:"user_id"`
+	TokenHash string       `json:"-"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	RevokedAt sql.NullTime `json:"-"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// NewRefreshToken creates a new RefreshToken instance for the given user.
+func NewRefreshToken(userID int, tokenHash string, ttl time.Duration) *RefreshToken {
+	now := time.Now()
+	return &RefreshToken{
+		UserID:    userID,
+		TokenHash: tokenHash,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+}
+
+// Save inserts the RefreshToken into the database.
+func (t *RefreshToken) Save(db *sql.DB) error {
+	query := `INSERT INTO refresh_tokens (user_id, token_hash, expires_at, created_at) VALUES ($1, $2, $3, $4) RETURNING id`
+	return db.QueryRow(query, t.UserID, t.TokenHash, t.ExpiresAt, t.CreatedAt).Scan(&t.ID)
+}
+
+// Active reports whether the token is neither revoked nor expired.
+func (t *RefreshToken) Active() bool {
+	return !t.RevokedAt.Valid && time.Now().Before(t.ExpiresAt)
+}
+
+// Revoke marks the token as revoked. It returns false if the token was already
+// revoked, so a token can only ever be exchanged once.
+func (t *RefreshToken) Revoke(db *sql.DB) (bool, error) {
+	query := `UPDATE refresh_tokens SET revoked_at = $2 WHERE id = $1 AND revoked_at IS NULL`
+	now := time.Now()
+	result, err := db.Exec(query, t.ID, now)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected == 0 {
+		return false, nil
+	}
+	t.RevokedAt = sql.NullTime{Time: now, Valid: true}
+	return true, nil
+}
+
+// GetRefreshTokenByHash fetches the refresh token with the given hash from the database.
+func GetRefreshTokenByHash(db *sql.DB, tokenHash string) (*RefreshToken, error) {
+	query := `SELECT id, user_id, token_hash, expires_at, revoked_at, created_at FROM refresh_tokens WHERE token_hash = $1`
+	t := RefreshToken{}
+	err := db.QueryRow(query, tokenHash).Scan(&t.ID, &t.UserID, &t.TokenHash, &t.ExpiresAt, &t.RevokedAt, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// RevokeRefreshTokensByUserID revokes every outstanding refresh token of a user.
+func RevokeRefreshTokensByUserID(db *sql.DB, userID int) error {
+	query := `UPDATE refresh_tokens SET revoked_at = $2 WHERE user_id = $1 AND revoked_at IS NULL`
+	_, err := db.Exec(query, userID, time.Now())
+	return err
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshToken_Save(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	token := NewRefreshToken(1, "hash", time.Hour)
+
+	mock.ExpectQuery("INSERT INTO refresh_tokens").
+		WithArgs(1, "hash", token.ExpiresAt, token.CreatedAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+
+	err = token.Save(db)
+	require.NoError(t, err)
+	assert.Equal(t, 5, token.ID)
+	assert.True(t, token.Active())
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefreshToken_Revoke(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	token := &RefreshToken{ID: 5, ExpiresAt: time.Now().Add(time.Hour)}
+
+	mock.ExpectExec("UPDATE refresh_tokens SET revoked_at").
+		WithArgs(5, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE refresh_tokens SET revoked_at").
+		WithArgs(5, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	revoked, err := token.Revoke(db)
+	require.NoError(t, err)
+	assert.True(t, revoked)
+	assert.False(t, token.Active())
+
+	// A second revoke must report that the token was already used.
+	revoked, err = token.Revoke(db)
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetRefreshTokenByHash(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	expiresAt := time.Now().Add(time.Hour)
+	rows := sqlmock.NewRows([]string{"id", "user_id", "token_hash", "expires_at", "revoked_at", "created_at"}).
+		AddRow(5, 1, "hash", expiresAt, nil, time.Now())
+
+	mock.ExpectQuery("SELECT id, user_id, token_hash, expires_at, revoked_at, created_at FROM refresh_tokens WHERE token_hash =").
+		WithArgs("hash").
+		WillReturnRows(rows)
+
+	token, err := GetRefreshTokenByHash(db, "hash")
+	require.NoError(t, err)
+	assert.Equal(t, 1, token.UserID)
+	assert.True(t, token.Active())
+
+	mock.ExpectQuery("SELECT id, user_id, token_hash, expires_at, revoked_at, created_at FROM refresh_tokens WHERE token_hash =").
+		WithArgs("missing").
+		WillReturnError(sql.ErrNoRows)
+
+	_, err = GetRefreshTokenByHash(db, "missing")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRevokeRefreshTokensByUserID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE refresh_tokens SET revoked_at = \\$2 WHERE user_id = \\$1").
+		WithArgs(1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	require.NoError(t, RevokeRefreshTokensByUserID(db, 1))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,55 @@
+package models
+
+// Role is the access level of a user.
+type Role string
+
+const (
+	// RoleReporter is the default role of volunteers, who may only report sightings.
+	RoleReporter Role = "reporter"
+	// RoleRanger is held by park rangers, who also maintain tiger records.
+	RoleRanger Role = "ranger"
+	// RoleAdmin may do everything, including managing users.
+	RoleAdmin Role = "admin"
+)
+
+// Permission is a single action that can be granted to a role.
+type Permission string
+
+const (
+	PermissionViewSensitiveImages Permission = "images:sensitive"
+	PermissionCreateSighting      Permission = "sightings:create"
+	PermissionManageSightingRules Permission = "sightings:rules"
+	PermissionManageTigers        Permission = "tigers:manage"
+	PermissionMergeTigers         Permission = "tigers:merge"
+	PermissionManageUsers         Permission = "users:manage"
+)
+
+// rolePermissions lists what each role is allowed to do.
+var rolePermissions = map[Role][]Permission{
+	RoleReporter: {PermissionCreateSighting},
+	RoleRanger:   {PermissionViewSensitiveImages, PermissionCreateSighting, PermissionManageTigers},
+	RoleAdmin:    {PermissionViewSensitiveImages, PermissionCreateSighting, PermissionManageSightingRules, PermissionManageTigers, PermissionMergeTigers, PermissionManageUsers},
+}
+
+// Valid reports whether r is one of the known roles.
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// RequiresTwoFactor reports whether users with the role must log in with
+// two-factor authentication. Rangers and admins can change tiger records, so a
+// password alone is not enough for them.
+func (r Role) RequiresTwoFactor() bool {
+	return r == RoleRanger || r == RoleAdmin
+}
+
+// Can reports whether the role has been granted the permission.
+func (r Role) Can(p Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
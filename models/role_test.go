@@ -0,0 +1,51 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRole_Valid(t *testing.T) {
+	assert.True(t, RoleReporter.Valid())
+	assert.True(t, RoleRanger.Valid())
+	assert.True(t, RoleAdmin.Valid())
+	assert.False(t, Role("superuser").Valid())
+	assert.False(t, Role("").Valid())
+}
+
+func TestRole_RequiresTwoFactor(t *testing.T) {
+	assert.False(t, RoleReporter.RequiresTwoFactor())
+	assert.True(t, RoleRanger.RequiresTwoFactor())
+	assert.True(t, RoleAdmin.RequiresTwoFactor())
+}
+
+func TestRole_Can(t *testing.T) {
+	tests := []struct {
+		role       Role
+		permission Permission
+		expected   bool
+	}{
+		{RoleReporter, PermissionCreateSighting, true},
+		{RoleReporter, PermissionManageTigers, false},
+		{RoleReporter, PermissionManageUsers, false},
+		{RoleReporter, PermissionViewSensitiveImages, false},
+		{RoleRanger, PermissionCreateSighting, true},
+		{RoleRanger, PermissionManageTigers, true},
+		{RoleRanger, PermissionManageUsers, false},
+		{RoleRanger, PermissionMergeTigers, false},
+		{RoleRanger, PermissionManageSightingRules, false},
+		{RoleRanger, PermissionViewSensitiveImages, true},
+		{RoleAdmin, PermissionCreateSighting, true},
+		{RoleAdmin, PermissionManageTigers, true},
+		{RoleAdmin, PermissionManageUsers, true},
+		{RoleAdmin, PermissionMergeTigers, true},
+		{RoleAdmin, PermissionManageSightingRules, true},
+		{RoleAdmin, PermissionViewSensitiveImages, true},
+		{Role("unknown"), PermissionCreateSighting, false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, tt.role.Can(tt.permission), "%s can %s", tt.role, tt.permission)
+	}
+}
@@ -15,6 +15,10 @@ type Sighting struct {
     Lon        float64   	`json:"lon"`
     Timestamp  time.Time 	`json:"timestamp"`
     ImagePath  string   	`json:"image_path"` 
+	// ReviewReason explains why the sighting was flagged for review, it is empty for other sightings.
+	ReviewReason string `json:"review_reason,omitempty"`
+	// ImageURL is where the API serves the image, it is not stored.
+	ImageURL string `json:"image_url,omitempty"`
 }
 
 
@@ -56,10 +60,10 @@ func GetLastSightingByTigerID(db *sql.DB, tigerID int) (*Sighting, error) {
 }
 
 
-// GetUsersByTigerID retrieves all unique user IDs who have reported a sighting of the given tiger.
+// GetUsersByTigerID retrieves all unique verified user IDs who have reported a sighting of the given tiger.
 func GetUsersByTigerID(db *sql.DB, tigerID int) ([]int, error) {
     // Prepare the SQL query to select distinct user IDs where the tiger_id matches.
-    query := `SELECT DISTINCT user_id FROM sightings WHERE tiger_id = $1`
+    query := `SELECT DISTINCT s.user_id FROM sightings s JOIN users u ON u.id = s.user_id WHERE s.tiger_id = $1 AND u.verified_at IS NOT NULL`
     
     // Execute the query.
     rows, err := db.Query(query, tigerID)
@@ -92,7 +96,7 @@ func GetUsersByTigerID(db *sql.DB, tigerID int) ([]int, error) {
 
 // GetAllSightingsByTigerID retrieves all sightings of a given tiger from the database with pagination.
 func GetAllSightingsByTigerID(db *sql.DB, tigerID, limit, offset int) ([]Sighting, error) {
-	query := `SELECT id, tiger_id, lat, lon, timestamp, image_path FROM sightings WHERE tiger_id = $1 ORDER BY timestamp DESC LIMIT $2 OFFSET $3`
+	query := `SELECT id, tiger_id, lat, lon, timestamp, image_path, review_reason FROM sightings WHERE tiger_id = $1 ORDER BY timestamp DESC LIMIT $2 OFFSET $3`
 	rows, err := db.Query(query, tigerID, limit, offset)
 	if err != nil {
 		return nil, err
@@ -102,7 +106,7 @@ func GetAllSightingsByTigerID(db *sql.DB, tigerID, limit, offset int) ([]Sightin
 	var sightings []Sighting
 	for rows.Next() {
 		var sighting Sighting
-		if err := rows.Scan(&sighting.ID, &sighting.TigerID, &sighting.Lat, &sighting.Lon, &sighting.Timestamp, &sighting.ImagePath); err != nil {
+		if err := rows.Scan(&sighting.ID, &sighting.TigerID, &sighting.Lat, &sighting.Lon, &sighting.Timestamp, &sighting.ImagePath, &sighting.ReviewReason); err != nil {
 			return nil, err
 		}
 		sightings = append(sightings, sighting)
@@ -112,3 +116,113 @@ func GetAllSightingsByTigerID(db *sql.DB, tigerID, limit, offset int) ([]Sightin
 	}
 	return sightings, nil
 }
+
+
+// sightingsSort is the order sightings of a tiger are listed in, newest first.
+const sightingsSort = "-timestamp"
+
+// SightingCursor returns the cursor pointing past the sighting in the list of
+// sightings of its tiger. With backward set it points to the sightings before it.
+func SightingCursor(s Sighting, backward bool) Cursor {
+	return Cursor{Sort: sightingsSort, Key: s.Timestamp.Format(time.RFC3339Nano), ID: s.ID, Backward: backward}
+}
+
+// GetSightingsPageByTigerID retrieves up to limit sightings of a given tiger,
+// newest first, that follow the cursor, or precede it for a backward cursor.
+// A nil cursor starts at the newest sighting. more reports whether there are
+// further sightings beyond the page in the direction of the cursor.
+func GetSightingsPageByTigerID(db *sql.DB, tigerID, limit int, cursor *Cursor) (sightings []Sighting, more bool, err error) {
+	args := []interface{}{tigerID, limit + 1}
+	var key, idArg string
+	if cursor != nil {
+		if cursor.Sort != sightingsSort {
+			return nil, false, ErrInvalidCursor
+		}
+		timestamp, err := time.Parse(time.RFC3339Nano, cursor.Key)
+		if err != nil {
+			return nil, false, ErrInvalidCursor
+		}
+		args = append(args, timestamp, cursor.ID)
+		key, idArg = "$3", "$4"
+	}
+	condition, orderBy := keyset("timestamp", key, idArg, true, cursor)
+	if condition != "" {
+		condition = " AND " + condition
+	}
+
+	query := `SELECT id, tiger_id, lat, lon, timestamp, image_path, review_reason FROM sightings WHERE tiger_id = $1` + condition + ` ORDER BY ` + orderBy + ` LIMIT $2`
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	sightings = []Sighting{}
+	for rows.Next() {
+		var sighting Sighting
+		if err := rows.Scan(&sighting.ID, &sighting.TigerID, &sighting.Lat, &sighting.Lon, &sighting.Timestamp, &sighting.ImagePath, &sighting.ReviewReason); err != nil {
+			return nil, false, err
+		}
+		sightings = append(sightings, sighting)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	if len(sightings) > limit {
+		sightings, more = sightings[:limit], true
+	}
+	if cursor != nil && cursor.Backward {
+		for i, j := 0, len(sightings)-1; i < j; i, j = i+1, j-1 {
+			sightings[i], sightings[j] = sightings[j], sightings[i]
+		}
+	}
+	return sightings, more, nil
+}
+
+// GetSightingsByUserID retrieves every sighting reported by the given user, newest first.
+func GetSightingsByUserID(db *sql.DB, userID int) ([]Sighting, error) {
+	query := `SELECT id, user_id, tiger_id, lat, lon, timestamp, image_path, review_reason FROM sightings WHERE user_id = $1 ORDER BY timestamp DESC`
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sightings := []Sighting{}
+	for rows.Next() {
+		var sighting Sighting
+		if err := rows.Scan(&sighting.ID, &sighting.UserID, &sighting.TigerID, &sighting.Lat, &sighting.Lon, &sighting.Timestamp, &sighting.ImagePath, &sighting.ReviewReason); err != nil {
+			return nil, err
+		}
+		sightings = append(sightings, sighting)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sightings, nil
+}
+
+// SightingImage is the image of a sighting together with what is needed to
+// decide who may see it.
+type SightingImage struct {
+	SightingID int
+	ImagePath  string
+	// Sensitive is set when the sighted tiger is sensitive.
+	Sensitive bool
+}
+
+// GetSightingImage retrieves the image of the given sighting. It returns nil
+// when the sighting does not exist or has no image.
+func GetSightingImage(db *sql.DB, sightingID int) (*SightingImage, error) {
+	query := `SELECT s.id, s.image_path, t.sensitive FROM sightings s JOIN tigers t ON t.id = s.tiger_id WHERE s.id = $1`
+	image := SightingImage{}
+	err := db.QueryRow(query, sightingID).Scan(&image.SightingID, &image.ImagePath, &image.Sensitive)
+	if err == sql.ErrNoRows || (err == nil && image.ImagePath == "") {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
@@ -0,0 +1,160 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// SightingRuleScope is what a sighting rule applies to.
+type SightingRuleScope string
+
+const (
+	RuleScopeGlobal  SightingRuleScope = "global"
+	RuleScopeReserve SightingRuleScope = "reserve"
+	RuleScopeTiger   SightingRuleScope = "tiger"
+)
+
+// Valid reports whether s is one of the known scopes.
+func (s SightingRuleScope) Valid() bool {
+	switch s {
+	case RuleScopeGlobal, RuleScopeReserve, RuleScopeTiger:
+		return true
+	}
+	return false
+}
+
+// SightingRule sets how far a new sighting must be from the sightings of the
+// same tiger taken right before and after it. A sighting is too close when it
+// is less than MinDistanceKm away from one of them, or was taken less than
+// MinGapMinutes apart from it. Zero disables either limit.
+//
+// The rule for a tiger takes precedence over the rule for its reserve, which
+// takes precedence over the global rule.
+type SightingRule struct {
+	ID            int               `json:"id,omitempty"`
+	Scope         SightingRuleScope `json:"scope"`
+	Reserve       string            `json:"reserve,omitempty"`
+	TigerID       *int              `json:"tiger_id,omitempty"`
+	MinDistanceKm float64           `json:"min_distance_km"`
+	MinGapMinutes int               `json:"min_gap_minutes"`
+	UpdatedAt     *time.Time        `json:"updated_at,omitempty"`
+}
+
+// DefaultSightingRule applies when no global rule is configured.
+var DefaultSightingRule = SightingRule{Scope: RuleScopeGlobal, MinDistanceKm: 5}
+
+// MinGap returns the minimum time between sightings as a duration.
+func (r SightingRule) MinGap() time.Duration {
+	return time.Duration(r.MinGapMinutes) * time.Minute
+}
+
+const sightingRuleColumns = `id, scope, reserve, tiger_id, min_distance_km, min_gap_minutes, updated_at`
+
+// sightingRuleConflicts names the unique index a rule of each scope is stored under.
+var sightingRuleConflicts = map[SightingRuleScope]string{
+	RuleScopeGlobal:  `(scope) WHERE scope = 'global'`,
+	RuleScopeReserve: `(reserve) WHERE scope = 'reserve'`,
+	RuleScopeTiger:   `(tiger_id) WHERE scope = 'tiger'`,
+}
+
+// Save stores the rule, replacing any rule configured before for the same
+// global scope, reserve or tiger. Fields of other scopes are cleared.
+func (r *SightingRule) Save(db *sql.DB) error {
+	var reserve sql.NullString
+	switch r.Scope {
+	case RuleScopeReserve:
+		reserve = sql.NullString{String: r.Reserve, Valid: true}
+		r.TigerID = nil
+	case RuleScopeTiger:
+		r.Reserve = ""
+	default:
+		r.Reserve, r.TigerID = "", nil
+	}
+
+	query := `INSERT INTO sighting_rules (scope, reserve, tiger_id, min_distance_km, min_gap_minutes)
+	          VALUES ($1, $2, $3, $4, $5)
+	          ON CONFLICT ` + sightingRuleConflicts[r.Scope] + `
+	          DO UPDATE SET min_distance_km = EXCLUDED.min_distance_km, min_gap_minutes = EXCLUDED.min_gap_minutes, updated_at = CURRENT_TIMESTAMP
+	          RETURNING id, updated_at`
+	var updatedAt time.Time
+	if err := db.QueryRow(query, r.Scope, reserve, r.TigerID, r.MinDistanceKm, r.MinGapMinutes).Scan(&r.ID, &updatedAt); err != nil {
+		return err
+	}
+	r.UpdatedAt = &updatedAt
+	return nil
+}
+
+// GetSightingRules retrieves all configured rules, the global rule first, then
+// the rules for reserves and tigers.
+func GetSightingRules(db *sql.DB) ([]SightingRule, error) {
+	query := `SELECT ` + sightingRuleColumns + ` FROM sighting_rules
+	          ORDER BY CASE scope WHEN 'global' THEN 0 WHEN 'reserve' THEN 1 ELSE 2 END, reserve, tiger_id`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []SightingRule{}
+	for rows.Next() {
+		rule, err := scanSightingRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, *rule)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// DeleteSightingRule removes the rule with the given ID. It returns false if
+// there is no such rule. Without a global rule DefaultSightingRule applies.
+func DeleteSightingRule(db *sql.DB, id int) (bool, error) {
+	result, err := db.Exec(`DELETE FROM sighting_rules WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// queryRower is implemented by both *sql.DB and *sql.Tx.
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// GetSightingRuleForTiger retrieves the rule that applies to sightings of the
+// tiger: its own rule, the rule for its reserve or the global rule, in that
+// order. DefaultSightingRule is returned when none of them is configured.
+func GetSightingRuleForTiger(db queryRower, tiger *Tiger) (SightingRule, error) {
+	query := `SELECT ` + sightingRuleColumns + ` FROM sighting_rules
+	          WHERE (scope = 'tiger' AND tiger_id = $1) OR (scope = 'reserve' AND reserve = $2) OR scope = 'global'
+	          ORDER BY CASE scope WHEN 'tiger' THEN 0 WHEN 'reserve' THEN 1 ELSE 2 END LIMIT 1`
+	rule, err := scanSightingRule(db.QueryRow(query, tiger.ID, tiger.Reserve))
+	if err == sql.ErrNoRows {
+		return DefaultSightingRule, nil
+	}
+	if err != nil {
+		return SightingRule{}, err
+	}
+	return *rule, nil
+}
+
+func scanSightingRule(row rowScanner) (*SightingRule, error) {
+	var r SightingRule
+	var reserve sql.NullString
+	var tigerID sql.NullInt64
+	var updatedAt time.Time
+	if err := row.Scan(&r.ID, &r.Scope, &reserve, &tigerID, &r.MinDistanceKm, &r.MinGapMinutes, &updatedAt); err != nil {
+		return nil, err
+	}
+	r.Reserve = reserve.String
+	r.TigerID = nullIntPtr(tigerID)
+	r.UpdatedAt = &updatedAt
+	return &r, nil
+}
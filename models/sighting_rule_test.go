@@ -0,0 +1,77 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+var sightingRuleTestColumns = []string{"id", "scope", "reserve", "tiger_id", "min_distance_km", "min_gap_minutes", "updated_at"}
+
+func TestGetSightingRuleForTiger(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	tiger := &Tiger{ID: 3, Reserve: "Ranthambore"}
+
+	// The most specific rule is read first.
+	mock.ExpectQuery("FROM sighting_rules WHERE \\(scope = 'tiger' AND tiger_id = \\$1\\) OR \\(scope = 'reserve' AND reserve = \\$2\\) OR scope = 'global' (.+) LIMIT 1").
+		WithArgs(3, "Ranthambore").
+		WillReturnRows(sqlmock.NewRows(sightingRuleTestColumns).AddRow(2, "reserve", "Ranthambore", nil, 2.0, 15, time.Now()))
+
+	rule, err := GetSightingRuleForTiger(db, tiger)
+	require.NoError(t, err)
+	require.Equal(t, RuleScopeReserve, rule.Scope)
+	require.Equal(t, "Ranthambore", rule.Reserve)
+	require.Nil(t, rule.TigerID)
+	require.Equal(t, 15*time.Minute, rule.MinGap())
+
+	// Without any rule the default applies.
+	mock.ExpectQuery("FROM sighting_rules").
+		WithArgs(3, "Ranthambore").
+		WillReturnRows(sqlmock.NewRows(sightingRuleTestColumns))
+
+	rule, err = GetSightingRuleForTiger(db, tiger)
+	require.NoError(t, err)
+	require.Equal(t, DefaultSightingRule, rule)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSightingRule_Save(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	tigerID := 3
+	rule := SightingRule{Scope: RuleScopeReserve, Reserve: "Ranthambore", TigerID: &tigerID, MinDistanceKm: 2}
+	mock.ExpectQuery("INSERT INTO sighting_rules (.+) ON CONFLICT \\(reserve\\) WHERE scope = 'reserve' DO UPDATE").
+		WithArgs(RuleScopeReserve, "Ranthambore", nil, 2.0, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "updated_at"}).AddRow(2, time.Now()))
+
+	require.NoError(t, rule.Save(db))
+	require.Equal(t, 2, rule.ID)
+	require.Nil(t, rule.TigerID)
+	require.NotNil(t, rule.UpdatedAt)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetSightingRules(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM sighting_rules ORDER BY").
+		WillReturnRows(sqlmock.NewRows(sightingRuleTestColumns).
+			AddRow(1, "global", nil, nil, 5.0, 0, time.Now()).
+			AddRow(3, "tiger", nil, 3, 0.5, 60, time.Now()))
+
+	rules, err := GetSightingRules(db)
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	require.Equal(t, 3, *rules[1].TigerID)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -75,13 +75,13 @@ func TestGetAllSightingsByTigerID(t *testing.T) {
     defer db.Close()
 
     // Mock data
-    rows := sqlmock.NewRows([]string{"id", "tiger_id", "lat", "lon", "timestamp", "image_path"}).
-        AddRow(1, 1, 10.1234, 20.5678, time.Now(), "/images/image1.jpg").
-        AddRow(2, 1, 11.1234, 21.5678, time.Now(), "/images/image2.jpg")
+    rows := sqlmock.NewRows([]string{"id", "tiger_id", "lat", "lon", "timestamp", "image_path", "review_reason"}).
+        AddRow(1, 1, 10.1234, 20.5678, time.Now(), "/images/image1.jpg", "").
+        AddRow(2, 1, 11.1234, 21.5678, time.Now(), "/images/image2.jpg", "")
 
     // Setting up the expectation
     tigerID, limit, offset := 1, 2, 0
-    mock.ExpectQuery("SELECT id, tiger_id, lat, lon, timestamp, image_path FROM sightings WHERE tiger_id = \\$1 ORDER BY timestamp DESC LIMIT \\$2 OFFSET \\$3").
+    mock.ExpectQuery("SELECT id, tiger_id, lat, lon, timestamp, image_path, review_reason FROM sightings WHERE tiger_id = \\$1 ORDER BY timestamp DESC LIMIT \\$2 OFFSET \\$3").
         WithArgs(tigerID, limit, offset).
         WillReturnRows(rows)
 
@@ -112,7 +112,7 @@ func TestGetUsersByTigerID(t *testing.T) {
         AddRow(103)
 
     // Setting up the expectation
-    mock.ExpectQuery("SELECT DISTINCT user_id FROM sightings WHERE tiger_id = \\$1").
+    mock.ExpectQuery("SELECT DISTINCT s.user_id FROM sightings s JOIN users u ON u.id = s.user_id WHERE s.tiger_id = \\$1 AND u.verified_at IS NOT NULL").
         WithArgs(tigerID).
         WillReturnRows(rows)
 
@@ -128,4 +128,96 @@ func TestGetUsersByTigerID(t *testing.T) {
     // Ensure all expectations were met
     err = mock.ExpectationsWereMet()
     require.NoError(t, err)
-}
\ No newline at end of file
+}
+func TestGetSightingsByUserID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"id", "user_id", "tiger_id", "lat", "lon", "timestamp", "image_path", "review_reason"}).
+		AddRow(4, 7, 1, 10.1234, 20.5678, time.Now(), "/images/image4.jpg", "")
+
+	mock.ExpectQuery("SELECT id, user_id, tiger_id, lat, lon, timestamp, image_path, review_reason FROM sightings WHERE user_id = \\$1").
+		WithArgs(7).
+		WillReturnRows(rows)
+
+	sightings, err := GetSightingsByUserID(db, 7)
+	require.NoError(t, err)
+	require.Len(t, sightings, 1)
+	require.Equal(t, 7, sightings[0].UserID)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetSightingsPageByTigerID(t *testing.T) {
+    db, mock, err := sqlmock.New()
+    require.NoError(t, err)
+    defer db.Close()
+
+    newest := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+    columns := []string{"id", "tiger_id", "lat", "lon", "timestamp", "image_path", "review_reason"}
+
+    // The first page reads one row more than requested to tell whether there is a next page.
+    mock.ExpectQuery("SELECT (.+) FROM sightings WHERE tiger_id = \\$1 ORDER BY timestamp DESC, id DESC LIMIT \\$2").
+        WithArgs(1, 3).
+        WillReturnRows(sqlmock.NewRows(columns).
+            AddRow(9, 1, 10.0, 20.0, newest, "", "").
+            AddRow(8, 1, 10.0, 20.0, newest.Add(-time.Hour), "", "").
+            AddRow(7, 1, 10.0, 20.0, newest.Add(-2*time.Hour), "", ""))
+
+    sightings, more, err := GetSightingsPageByTigerID(db, 1, 2, nil)
+    require.NoError(t, err)
+    require.Len(t, sightings, 2)
+    require.True(t, more)
+
+    // Going back from sighting 7 reads in ascending order and returns the rows newest first.
+    cursor := SightingCursor(Sighting{ID: 7, Timestamp: newest.Add(-2 * time.Hour)}, true)
+    mock.ExpectQuery("WHERE tiger_id = \\$1 AND \\(timestamp, id\\) > \\(\\$3, \\$4\\) ORDER BY timestamp ASC, id ASC LIMIT \\$2").
+        WithArgs(1, 3, newest.Add(-2*time.Hour), 7).
+        WillReturnRows(sqlmock.NewRows(columns).
+            AddRow(8, 1, 10.0, 20.0, newest.Add(-time.Hour), "", "").
+            AddRow(9, 1, 10.0, 20.0, newest, "", ""))
+
+    sightings, more, err = GetSightingsPageByTigerID(db, 1, 2, &cursor)
+    require.NoError(t, err)
+    require.False(t, more)
+    require.Equal(t, 9, sightings[0].ID)
+    require.Equal(t, 8, sightings[1].ID)
+
+    // A cursor issued for another list is rejected.
+    _, _, err = GetSightingsPageByTigerID(db, 1, 2, &Cursor{Sort: "name", ID: 3})
+    require.Equal(t, ErrInvalidCursor, err)
+
+    require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetSightingImage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	columns := []string{"id", "image_path", "sensitive"}
+	mock.ExpectQuery("SELECT s.id, s.image_path, t.sensitive FROM sightings s JOIN tigers t").
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(4, "ab/cd/abcd.png", true))
+	mock.ExpectQuery("SELECT s.id, s.image_path, t.sensitive FROM sightings s JOIN tigers t").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(5, "", false))
+	mock.ExpectQuery("SELECT s.id, s.image_path, t.sensitive FROM sightings s JOIN tigers t").
+		WithArgs(6).
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	image, err := GetSightingImage(db, 4)
+	require.NoError(t, err)
+	require.Equal(t, &SightingImage{SightingID: 4, ImagePath: "ab/cd/abcd.png", Sensitive: true}, image)
+
+	// Sightings without an image and missing sightings have no image.
+	image, err = GetSightingImage(db, 5)
+	require.NoError(t, err)
+	require.Nil(t, image)
+	image, err = GetSightingImage(db, 6)
+	require.NoError(t, err)
+	require.Nil(t, image)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -2,19 +2,115 @@ package models
 
 import (
 	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/lib/pq"
+)
+
+// TigerStatus is where a tiger is in its lifecycle.
+type TigerStatus string
+
+const (
+	TigerActive    TigerStatus = "active"
+	TigerMissing   TigerStatus = "missing"
+	TigerDeceased  TigerStatus = "deceased"
+	TigerRelocated TigerStatus = "relocated"
+)
+
+// Valid reports whether s is one of the known statuses.
+func (s TigerStatus) Valid() bool {
+	switch s {
+	case TigerActive, TigerMissing, TigerDeceased, TigerRelocated:
+		return true
+	}
+	return false
+}
+
+// TigerSex is the sex of a tiger. It stays unknown until a ranger has determined it.
+type TigerSex string
+
+const (
+	TigerSexUnknown TigerSex = "unknown"
+	TigerFemale     TigerSex = "female"
+	TigerMale       TigerSex = "male"
 )
 
+// Valid reports whether s is one of the known sexes.
+func (s TigerSex) Valid() bool {
+	switch s {
+	case TigerSexUnknown, TigerFemale, TigerMale:
+		return true
+	}
+	return false
+}
+
+// TigerSubspecies is the subspecies of a tiger. The empty subspecies means it is not known.
+type TigerSubspecies string
+
+const (
+	SubspeciesBengal      TigerSubspecies = "bengal"
+	SubspeciesAmur        TigerSubspecies = "amur"
+	SubspeciesIndochinese TigerSubspecies = "indochinese"
+	SubspeciesMalayan     TigerSubspecies = "malayan"
+	SubspeciesSouthChina  TigerSubspecies = "south_china"
+	SubspeciesSumatran    TigerSubspecies = "sumatran"
+)
+
+// Valid reports whether s is empty or one of the known subspecies.
+func (s TigerSubspecies) Valid() bool {
+	switch s {
+	case "", SubspeciesBengal, SubspeciesAmur, SubspeciesIndochinese, SubspeciesMalayan, SubspeciesSouthChina, SubspeciesSumatran:
+		return true
+	}
+	return false
+}
+
+// ErrDuplicateIdentificationCode is returned when an identification code is already used by another tiger.
+var ErrDuplicateIdentificationCode = errors.New("identification code already belongs to another tiger")
+
 // Tiger represents the tiger structure.
 type Tiger struct {
-	ID                int       `json:"id"`
-	Name              string    `json:"name"`
-	DateOfBirth       time.Time `json:"date_of_birth"`
-	LastSeenTimestamp time.Time `json:"last_seen_timestamp"`
-	LastSeenLat       float64   `json:"last_seen_lat"`
-	LastSeenLon       float64   `json:"last_seen_lon"`
+	ID                int         `json:"id"`
+	Name              string      `json:"name"`
+	DateOfBirth       time.Time   `json:"date_of_birth"`
+	LastSeenTimestamp time.Time   `json:"last_seen_timestamp"`
+	LastSeenLat       float64     `json:"last_seen_lat"`
+	LastSeenLon       float64     `json:"last_seen_lon"`
+	Status            TigerStatus `json:"status"`
+	StatusReason      string      `json:"status_reason"`
+	StatusEffectiveAt *time.Time  `json:"status_effective_at"`
+	MergedIntoID      *int        `json:"merged_into_id,omitempty"`
+	MotherID          *int        `json:"mother_id"`
+	FatherID          *int        `json:"father_id"`
+
+	Sex                 TigerSex        `json:"sex"`
+	Subspecies          TigerSubspecies `json:"subspecies"`
+	DistinguishingMarks string          `json:"distinguishing_marks"`
+	StripeNotes         string          `json:"stripe_notes"`
+	// Reserve is the name of the reserve the tiger lives in, empty when it is not known.
+	Reserve string `json:"reserve"`
+	// Sensitive tigers, such as those targeted by poachers, have their photos
+	// shown only to users allowed to view sensitive images. Their other
+	// details, the places they were sighted included, stay public.
+	Sensitive bool `json:"sensitive"`
+	// IdentificationCodes are external identifiers of the tiger, such as camera-trap IDs.
+	// A code belongs to at most one tiger.
+	IdentificationCodes []string `json:"identification_codes"`
+	Aliases             []string `json:"aliases"`
+	Tags                []string `json:"tags"`
 }
 
+// tigerColumns selects a tiger from the tigers table. The identification codes
+// and aliases are kept in tables of their own, so the query must not give the
+// tigers table another name.
+const tigerColumns = `id, name, date_of_birth, last_seen_timestamp, last_seen_lat, last_seen_lon, status, status_reason, status_effective_at, merged_into_id, mother_id, father_id,
+	sex, subspecies, distinguishing_marks, stripe_notes, reserve, sensitive,
+	ARRAY(SELECT tiger_identification_codes.code FROM tiger_identification_codes WHERE tiger_identification_codes.tiger_id = tigers.id ORDER BY tiger_identification_codes.id) AS identification_codes, tags,
+	ARRAY(SELECT tiger_aliases.name FROM tiger_aliases WHERE tiger_aliases.tiger_id = tigers.id ORDER BY tiger_aliases.id) AS aliases`
+
 // NewTiger creates a new Tiger instance.
 func NewTiger(name string, dateOfBirth, lastSeenTimestamp time.Time, lastSeenLat, lastSeenLon float64) *Tiger {
 	return &Tiger{
@@ -23,14 +119,139 @@ func NewTiger(name string, dateOfBirth, lastSeenTimestamp time.Time, lastSeenLat
 		LastSeenTimestamp: lastSeenTimestamp,
 		LastSeenLat:       lastSeenLat,
 		LastSeenLon:       lastSeenLon,
+		Status:            TigerActive,
+		Sex:               TigerSexUnknown,
 	}
 }
 
-// Save inserts the Tiger into the database.
+// Save inserts the Tiger and its aliases into the database. New tigers always start out active.
 func (t *Tiger) Save(db *sql.DB) error {
-	query := `INSERT INTO tigers (name, date_of_birth, last_seen_timestamp, last_seen_lat, last_seen_lon) 
-	          VALUES ($1, $2, $3, $4, $5) RETURNING id`
-	return db.QueryRow(query, t.Name, t.DateOfBirth, t.LastSeenTimestamp, t.LastSeenLat, t.LastSeenLon).Scan(&t.ID)
+	if t.Sex == "" {
+		t.Sex = TigerSexUnknown
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO tigers (name, date_of_birth, last_seen_timestamp, last_seen_lat, last_seen_lon, mother_id, father_id,
+	          sex, subspecies, distinguishing_marks, stripe_notes, tags, reserve, sensitive)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) RETURNING id`
+	err = tx.QueryRow(query, t.Name, t.DateOfBirth, t.LastSeenTimestamp, t.LastSeenLat, t.LastSeenLon, t.MotherID, t.FatherID,
+		t.Sex, t.Subspecies, t.DistinguishingMarks, t.StripeNotes, stringArray(t.Tags), t.Reserve, t.Sensitive).Scan(&t.ID)
+	if err != nil {
+		return translateTigerError(err)
+	}
+	if err := setIdentificationCodes(tx, t.ID, t.IdentificationCodes); err != nil {
+		return err
+	}
+	if err := setTigerAliases(tx, t.ID, t.Aliases); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	t.Status = TigerActive
+	return nil
+}
+
+// UpdateTiger locks the tiger with the ID, lets edit change it and stores all
+// its editable fields, including its aliases, within one transaction. Sightings
+// and merges of the tiger wait until it is done, so edit always starts from the
+// latest row. An error from edit is returned as is and nothing is stored. A
+// merged tiger is returned with ErrTigerAlreadyMerged, and a name that is
+// already taken by another tiger is reported as ErrDuplicateTigerName.
+func UpdateTiger(db *sql.DB, id int, edit func(*Tiger) error) (*Tiger, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	t, err := LockTigerByID(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if t.Merged() {
+		return t, ErrTigerAlreadyMerged
+	}
+	if err := edit(t); err != nil {
+		return nil, err
+	}
+
+	query := `UPDATE tigers SET name = $2, date_of_birth = $3, last_seen_timestamp = $4, last_seen_lat = $5, last_seen_lon = $6,
+	          status = $7, status_reason = $8, status_effective_at = $9, mother_id = $10, father_id = $11,
+	          sex = $12, subspecies = $13, distinguishing_marks = $14, stripe_notes = $15, tags = $16, reserve = $17, sensitive = $18 WHERE id = $1`
+	_, err = tx.Exec(query, t.ID, t.Name, t.DateOfBirth, t.LastSeenTimestamp, t.LastSeenLat, t.LastSeenLon,
+		t.Status, t.StatusReason, t.StatusEffectiveAt, t.MotherID, t.FatherID,
+		t.Sex, t.Subspecies, t.DistinguishingMarks, t.StripeNotes, stringArray(t.Tags), t.Reserve, t.Sensitive)
+	if err != nil {
+		return nil, translateTigerError(err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM tiger_identification_codes WHERE tiger_id = $1 AND NOT (code = ANY($2))`, t.ID, stringArray(t.IdentificationCodes)); err != nil {
+		return nil, err
+	}
+	if err := setIdentificationCodes(tx, t.ID, t.IdentificationCodes); err != nil {
+		return nil, err
+	}
+
+	// Aliases that are kept retain their row, so they stay in the order they were added.
+	if _, err := tx.Exec(`DELETE FROM tiger_aliases WHERE tiger_id = $1 AND NOT (name = ANY($2))`, t.ID, stringArray(t.Aliases)); err != nil {
+		return nil, err
+	}
+	if err := setTigerAliases(tx, t.ID, t.Aliases); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// setIdentificationCodes claims the identification codes the tiger does not
+// have yet, in the order given. A code that belongs to another tiger violates the unique constraint
+// of tiger_identification_codes and is reported as ErrDuplicateIdentificationCode.
+func setIdentificationCodes(tx *sql.Tx, tigerID int, codes []string) error {
+	if len(codes) == 0 {
+		return nil
+	}
+	query := `INSERT INTO tiger_identification_codes (tiger_id, code)
+	          SELECT $1, c FROM unnest($2::TEXT[]) WITH ORDINALITY AS a(c, position)
+	          WHERE NOT EXISTS (SELECT 1 FROM tiger_identification_codes WHERE tiger_id = $1 AND code = c)
+	          ORDER BY position`
+	_, err := tx.Exec(query, tigerID, stringArray(codes))
+	return translateTigerError(err)
+}
+
+// setTigerAliases adds the aliases the tiger does not have yet.
+func setTigerAliases(tx *sql.Tx, tigerID int, aliases []string) error {
+	if len(aliases) == 0 {
+		return nil
+	}
+	query := `INSERT INTO tiger_aliases (tiger_id, name)
+	          SELECT $1, alias FROM unnest($2::TEXT[]) WITH ORDINALITY AS a(alias, position)
+	          WHERE NOT EXISTS (SELECT 1 FROM tiger_aliases WHERE tiger_id = $1 AND name = alias)
+	          ORDER BY position`
+	_, err := tx.Exec(query, tigerID, stringArray(aliases))
+	return err
+}
+
+// stringArray converts a list to a PostgreSQL array. A nil list is stored as an
+// empty array, as the array columns are not nullable.
+func stringArray(values []string) pq.StringArray {
+	if values == nil {
+		return pq.StringArray{}
+	}
+	return pq.StringArray(values)
+}
+
+// AcceptsSightings reports whether new sightings may be recorded for the tiger.
+func (t *Tiger) AcceptsSightings() bool {
+	return t.Status != TigerDeceased
 }
 
 // UpdateLastSeen updates the last seen details of the tiger in the database.
@@ -43,10 +264,238 @@ func (t *Tiger) UpdateLastSeen(db *sql.DB, timestamp time.Time, lat, lon float64
 	return err
 }
 
-// GetAllTigers retrieves all tigers from the database with pagination.
-func GetAllTigers(db *sql.DB, limit, offset int) ([]Tiger, error) {
-	query := `SELECT id, name, date_of_birth, last_seen_timestamp, last_seen_lat, last_seen_lon FROM tigers ORDER BY last_seen_timestamp DESC LIMIT $1 OFFSET $2`
-	rows, err := db.Query(query, limit, offset)
+// Merged reports whether the tiger has been merged into another one.
+func (t *Tiger) Merged() bool {
+	return t.MergedIntoID != nil
+}
+
+// BoundingBox is an area between two latitudes and two longitudes. A box with
+// MinLon greater than MaxLon crosses the antimeridian.
+type BoundingBox struct {
+	MinLat, MinLon, MaxLat, MaxLon float64
+}
+
+// TigerFilter narrows down the tigers listed by GetAllTigers. Fields left at
+// their zero value do not filter.
+type TigerFilter struct {
+	// IncludeDeceased lists deceased tigers too. It has no effect when Statuses is set.
+	IncludeDeceased bool
+	// Search matches part of the name or of one of the aliases, ignoring case.
+	Search             string
+	Statuses           []TigerStatus
+	Sex                TigerSex
+	Subspecies         TigerSubspecies
+	IdentificationCode string
+	// Alias matches the former names of a tiger, ignoring case.
+	Alias string
+	// Tags lists tags the tiger must all carry.
+	Tags []string
+	// LastSeenFrom and LastSeenTo bound the last seen timestamp, both inclusive.
+	LastSeenFrom *time.Time
+	LastSeenTo   *time.Time
+	// Area only keeps tigers last seen within the bounding box.
+	Area *BoundingBox
+}
+
+// where returns the conditions of the filter and appends their arguments to args.
+func (f TigerFilter) where(args *[]interface{}) string {
+	arg := func(v interface{}) string {
+		*args = append(*args, v)
+		return "$" + strconv.Itoa(len(*args))
+	}
+
+	conditions := []string{"merged_into_id IS NULL"}
+	if len(f.Statuses) > 0 {
+		statuses := make([]string, len(f.Statuses))
+		for i, status := range f.Statuses {
+			statuses[i] = string(status)
+		}
+		conditions = append(conditions, "status = ANY("+arg(stringArray(statuses))+")")
+	} else if !f.IncludeDeceased {
+		conditions = append(conditions, "status <> 'deceased'")
+	}
+	if f.Search != "" {
+		pattern := arg("%" + escapeLike(f.Search) + "%")
+		conditions = append(conditions, "(name ILIKE "+pattern+" OR EXISTS (SELECT 1 FROM tiger_aliases WHERE tiger_aliases.tiger_id = tigers.id AND tiger_aliases.name ILIKE "+pattern+"))")
+	}
+	if f.Sex != "" {
+		conditions = append(conditions, "sex = "+arg(f.Sex))
+	}
+	if f.Subspecies != "" {
+		conditions = append(conditions, "subspecies = "+arg(f.Subspecies))
+	}
+	if f.IdentificationCode != "" {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM tiger_identification_codes WHERE tiger_identification_codes.tiger_id = tigers.id AND tiger_identification_codes.code = "+arg(f.IdentificationCode)+")")
+	}
+	if f.Alias != "" {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM tiger_aliases WHERE tiger_aliases.tiger_id = tigers.id AND LOWER(tiger_aliases.name) = LOWER("+arg(f.Alias)+"))")
+	}
+	if len(f.Tags) > 0 {
+		conditions = append(conditions, "tags @> "+arg(stringArray(f.Tags)))
+	}
+	if f.LastSeenFrom != nil {
+		conditions = append(conditions, "last_seen_timestamp >= "+arg(*f.LastSeenFrom))
+	}
+	if f.LastSeenTo != nil {
+		conditions = append(conditions, "last_seen_timestamp <= "+arg(*f.LastSeenTo))
+	}
+	if a := f.Area; a != nil {
+		conditions = append(conditions, "last_seen_lat BETWEEN "+arg(a.MinLat)+" AND "+arg(a.MaxLat))
+		if a.MinLon <= a.MaxLon {
+			conditions = append(conditions, "last_seen_lon BETWEEN "+arg(a.MinLon)+" AND "+arg(a.MaxLon))
+		} else {
+			conditions = append(conditions, "(last_seen_lon >= "+arg(a.MinLon)+" OR last_seen_lon <= "+arg(a.MaxLon)+")")
+		}
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, so s is matched literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// TigerSortField is a field tigers can be listed by.
+type TigerSortField string
+
+const (
+	SortByLastSeen    TigerSortField = "lastSeen"
+	SortByName        TigerSortField = "name"
+	SortByDateOfBirth TigerSortField = "dateOfBirth"
+	SortByID          TigerSortField = "id"
+)
+
+var tigerSortColumns = map[TigerSortField]string{
+	SortByLastSeen:    "last_seen_timestamp",
+	SortByName:        "LOWER(name)",
+	SortByDateOfBirth: "date_of_birth",
+	SortByID:          "id",
+}
+
+// TigerSort orders the tigers listed by GetAllTigers. The zero TigerSort lists
+// the most recently seen tigers first.
+type TigerSort struct {
+	Field      TigerSortField
+	Descending bool
+}
+
+// Valid reports whether the field is one tigers can be sorted by.
+func (s TigerSort) Valid() bool {
+	_, ok := tigerSortColumns[s.Field]
+	return ok || s.Field == ""
+}
+
+func (s TigerSort) normalized() TigerSort {
+	if _, ok := tigerSortColumns[s.Field]; !ok {
+		return TigerSort{Field: SortByLastSeen, Descending: true}
+	}
+	return s
+}
+
+// String returns the sort as in the sort parameter of /tigers/list, such as "-lastSeen".
+func (s TigerSort) String() string {
+	s = s.normalized()
+	if s.Descending {
+		return "-" + string(s.Field)
+	}
+	return string(s.Field)
+}
+
+// orderBy returns the ORDER BY clause of the sort. Ties are broken by ID, so
+// pages do not overlap.
+func (s TigerSort) orderBy() string {
+	s = s.normalized()
+	_, orderBy := keyset(tigerSortColumns[s.Field], "", "", s.Descending, nil)
+	return orderBy
+}
+
+// Cursor returns the cursor pointing past the tiger in this order. With
+// backward set it points to the tigers before it.
+func (s TigerSort) Cursor(t Tiger, backward bool) Cursor {
+	s = s.normalized()
+	c := Cursor{Sort: s.String(), ID: t.ID, Backward: backward}
+	switch s.Field {
+	case SortByLastSeen:
+		c.Key = t.LastSeenTimestamp.Format(time.RFC3339Nano)
+	case SortByDateOfBirth:
+		c.Key = t.DateOfBirth.Format(time.RFC3339Nano)
+	case SortByName:
+		c.Key = t.Name
+	}
+	return c
+}
+
+// cursorKey converts the key of a cursor back to the type of the sort column,
+// and returns the expression to compare the column against.
+func (s TigerSort) cursorKey(c *Cursor, arg func(interface{}) string) (string, error) {
+	switch s.normalized().Field {
+	case SortByLastSeen, SortByDateOfBirth:
+		key, err := time.Parse(time.RFC3339Nano, c.Key)
+		if err != nil {
+			return "", ErrInvalidCursor
+		}
+		return arg(key), nil
+	case SortByName:
+		return "LOWER(" + arg(c.Key) + ")", nil
+	}
+	return "", nil
+}
+
+// GetAllTigers retrieves the tigers matching the filter from the database in
+// the given order with pagination. Merged tigers are always left out.
+func GetAllTigers(db *sql.DB, limit, offset int, filter TigerFilter, sort TigerSort) ([]Tiger, error) {
+	args := []interface{}{limit, offset}
+	query := `SELECT ` + tigerColumns + ` FROM tigers WHERE ` + filter.where(&args) + ` ORDER BY ` + sort.orderBy() + ` LIMIT $1 OFFSET $2`
+	return queryTigers(db, query, args...)
+}
+
+// GetTigersPage retrieves up to limit tigers matching the filter that follow
+// the cursor in the given order, or precede it for a backward cursor. A nil
+// cursor starts at the first tiger. more reports whether there are further
+// tigers beyond the page in the direction of the cursor. The cursor must have
+// been issued for the same order.
+func GetTigersPage(db *sql.DB, limit int, filter TigerFilter, sort TigerSort, cursor *Cursor) (tigers []Tiger, more bool, err error) {
+	sort = sort.normalized()
+	if cursor != nil && cursor.Sort != sort.String() {
+		return nil, false, ErrInvalidCursor
+	}
+
+	args := []interface{}{limit + 1}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	where := filter.where(&args)
+
+	var key, idArg string
+	if cursor != nil {
+		if key, err = sort.cursorKey(cursor, arg); err != nil {
+			return nil, false, err
+		}
+		idArg = arg(cursor.ID)
+	}
+	condition, orderBy := keyset(tigerSortColumns[sort.Field], key, idArg, sort.Descending, cursor)
+	if condition != "" {
+		where += " AND " + condition
+	}
+
+	query := `SELECT ` + tigerColumns + ` FROM tigers WHERE ` + where + ` ORDER BY ` + orderBy + ` LIMIT $1`
+	if tigers, err = queryTigers(db, query, args...); err != nil {
+		return nil, false, err
+	}
+	if len(tigers) > limit {
+		tigers, more = tigers[:limit], true
+	}
+	if cursor != nil && cursor.Backward {
+		for i, j := 0, len(tigers)-1; i < j; i, j = i+1, j-1 {
+			tigers[i], tigers[j] = tigers[j], tigers[i]
+		}
+	}
+	return tigers, more, nil
+}
+
+func queryTigers(db *sql.DB, query string, args ...interface{}) ([]Tiger, error) {
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -54,11 +503,11 @@ func GetAllTigers(db *sql.DB, limit, offset int) ([]Tiger, error) {
 
 	var tigers []Tiger
 	for rows.Next() {
-		var t Tiger
-		if err := rows.Scan(&t.ID, &t.Name, &t.DateOfBirth, &t.LastSeenTimestamp, &t.LastSeenLat, &t.LastSeenLon); err != nil {
+		t, err := scanTiger(rows)
+		if err != nil {
 			return nil, err
 		}
-		tigers = append(tigers, t)
+		tigers = append(tigers, *t)
 	}
 	if err = rows.Err(); err != nil {
 		return nil, err
@@ -66,13 +515,74 @@ func GetAllTigers(db *sql.DB, limit, offset int) ([]Tiger, error) {
 	return tigers, nil
 }
 
+// CountTigers returns how many tigers match the filter.
+func CountTigers(db *sql.DB, filter TigerFilter) (int, error) {
+	var args []interface{}
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM tigers WHERE `+filter.where(&args), args...).Scan(&count)
+	return count, err
+}
+
 // GetTigerByID retrieves a single tiger record by its ID from the database.
 func GetTigerByID(db *sql.DB, id int) (*Tiger, error) {
-	query := `SELECT id, name, date_of_birth, last_seen_timestamp, last_seen_lat, last_seen_lon FROM tigers WHERE id = $1`
+	query := `SELECT ` + tigerColumns + ` FROM tigers WHERE id = $1`
+	return scanTiger(db.QueryRow(query, id))
+}
+
+// LockTigerByID retrieves a tiger within a transaction and locks its row until
+// the transaction ends, so concurrent changes to the tiger wait for it.
+func LockTigerByID(tx *sql.Tx, id int) (*Tiger, error) {
+	query := `SELECT ` + tigerColumns + ` FROM tigers WHERE id = $1 FOR UPDATE`
+	return scanTiger(tx.QueryRow(query, id))
+}
+
+func scanTiger(row rowScanner) (*Tiger, error) {
 	t := Tiger{}
-	err := db.QueryRow(query, id).Scan(&t.ID, &t.Name, &t.DateOfBirth, &t.LastSeenTimestamp, &t.LastSeenLat, &t.LastSeenLon)
+	var mergedIntoID, motherID, fatherID sql.NullInt64
+	err := row.Scan(&t.ID, &t.Name, &t.DateOfBirth, &t.LastSeenTimestamp, &t.LastSeenLat, &t.LastSeenLon,
+		&t.Status, &t.StatusReason, &t.StatusEffectiveAt, &mergedIntoID, &motherID, &fatherID,
+		&t.Sex, &t.Subspecies, &t.DistinguishingMarks, &t.StripeNotes, &t.Reserve, &t.Sensitive,
+		pq.Array(&t.IdentificationCodes), pq.Array(&t.Tags), pq.Array(&t.Aliases))
 	if err != nil {
 		return nil, err
 	}
+	t.MergedIntoID = nullIntPtr(mergedIntoID)
+	t.MotherID = nullIntPtr(motherID)
+	t.FatherID = nullIntPtr(fatherID)
 	return &t, nil
 }
+
+// nullIntPtr converts a nullable integer column to a pointer that is nil for NULL.
+func nullIntPtr(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	id := int(n.Int64)
+	return &id
+}
+
+// TigerSummary holds statistics about the sightings of a tiger.
+type TigerSummary struct {
+	SightingCount     int        `json:"sighting_count"`
+	FirstSightingAt   *time.Time `json:"first_sighting_at"`
+	LastSightingAt    *time.Time `json:"last_sighting_at"`
+	DistinctReporters int        `json:"distinct_reporters"`
+}
+
+// GetTigerSummary computes the sighting statistics of the given tiger. A tiger
+// without sightings has zero counts and no first or last sighting.
+func GetTigerSummary(db *sql.DB, tigerID int) (*TigerSummary, error) {
+	query := `SELECT COUNT(*), MIN(timestamp), MAX(timestamp), COUNT(DISTINCT user_id) FROM sightings WHERE tiger_id = $1`
+	var summary TigerSummary
+	var first, last sql.NullTime
+	if err := db.QueryRow(query, tigerID).Scan(&summary.SightingCount, &first, &last, &summary.DistinctReporters); err != nil {
+		return nil, err
+	}
+	if first.Valid {
+		summary.FirstSightingAt = &first.Time
+	}
+	if last.Valid {
+		summary.LastSightingAt = &last.Time
+	}
+	return &summary, nil
+}
@@ -0,0 +1,172 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+)
+
+var (
+	// ErrParentNotFound is returned when a mother or father does not exist or has been merged.
+	ErrParentNotFound = errors.New("parent tiger not found")
+	// ErrParentIsSelf is returned when a tiger is set as its own parent.
+	ErrParentIsSelf = errors.New("a tiger can not be its own parent")
+	// ErrLineageCycle is returned when a parent is also a descendant of the tiger.
+	ErrLineageCycle = errors.New("parent is a descendant of the tiger")
+	// ErrParentTooYoung is returned when a tiger would be born before one of its parents.
+	ErrParentTooYoung = errors.New("tiger is born before its parent")
+	// ErrChildTooOld is returned when a tiger's date of birth is not before that of its cubs.
+	ErrChildTooOld = errors.New("tiger is born after one of its cubs")
+	// ErrParentSex is returned when the mother is known to be male or the father known to be female.
+	ErrParentSex = errors.New("parent has the wrong sex")
+)
+
+// FamilyMember is a relative of a tiger. Generation counts the steps from the
+// tiger: 1 for parents or cubs, 2 for grandparents or grandcubs, and so on.
+type FamilyMember struct {
+	Tiger
+	Generation int `json:"generation"`
+}
+
+// ValidateParents checks the mother and father of the tiger before it is saved:
+// both must exist, be born before the tiger and not be descendants of it, and
+// neither may be known to have the other sex. For an existing tiger the cubs
+// already recorded must also be born after it. db can also be a transaction.
+func ValidateParents(db queryRower, t *Tiger) error {
+	parents := []struct {
+		id       *int
+		wrongSex TigerSex
+	}{
+		{t.MotherID, TigerMale},
+		{t.FatherID, TigerFemale},
+	}
+	for _, p := range parents {
+		parentID := p.id
+		if parentID == nil {
+			continue
+		}
+		if t.ID != 0 && *parentID == t.ID {
+			return ErrParentIsSelf
+		}
+
+		parent, err := scanTiger(db.QueryRow(`SELECT `+tigerColumns+` FROM tigers WHERE id = $1`, *parentID))
+		if err == sql.ErrNoRows {
+			return ErrParentNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if parent.Merged() {
+			return ErrParentNotFound
+		}
+		if parent.Sex == p.wrongSex {
+			return ErrParentSex
+		}
+		if !parent.DateOfBirth.Before(t.DateOfBirth) {
+			return ErrParentTooYoung
+		}
+
+		if t.ID != 0 {
+			isDescendant, err := isAncestor(db, t.ID, parent.ID)
+			if err != nil {
+				return err
+			}
+			if isDescendant {
+				return ErrLineageCycle
+			}
+		}
+	}
+
+	if t.ID != 0 {
+		var olderCub bool
+		query := `SELECT EXISTS (SELECT 1 FROM tigers WHERE (mother_id = $1 OR father_id = $1) AND date_of_birth <= $2)`
+		if err := db.QueryRow(query, t.ID, t.DateOfBirth).Scan(&olderCub); err != nil {
+			return err
+		}
+		if olderCub {
+			return ErrChildTooOld
+		}
+	}
+	return nil
+}
+
+// isAncestor reports whether ancestorID appears anywhere in the lineage of tigerID.
+func isAncestor(db queryRower, ancestorID, tigerID int) (bool, error) {
+	query := `WITH RECURSIVE lineage(id) AS (
+	            SELECT $2::INT
+	            UNION
+	            SELECT p.id FROM lineage l JOIN tigers t ON t.id = l.id
+	            CROSS JOIN LATERAL (VALUES (t.mother_id), (t.father_id)) AS p(id)
+	            WHERE p.id IS NOT NULL
+	          )
+	          SELECT EXISTS (SELECT 1 FROM lineage WHERE id = $1)`
+	var found bool
+	err := db.QueryRow(query, ancestorID, tigerID).Scan(&found)
+	return found, err
+}
+
+// GetTigerAncestors returns the parents, grandparents and so on of the tiger, up
+// to maxDepth generations back, nearest generation first.
+func GetTigerAncestors(db *sql.DB, tigerID, maxDepth int) ([]FamilyMember, error) {
+	query := `WITH RECURSIVE relatives(id, generation) AS (
+	            SELECT p.id, 1 FROM tigers t
+	            CROSS JOIN LATERAL (VALUES (t.mother_id), (t.father_id)) AS p(id)
+	            WHERE t.id = $1 AND p.id IS NOT NULL
+	            UNION
+	            SELECT p.id, r.generation + 1 FROM relatives r JOIN tigers t ON t.id = r.id
+	            CROSS JOIN LATERAL (VALUES (t.mother_id), (t.father_id)) AS p(id)
+	            WHERE p.id IS NOT NULL AND r.generation < $2
+	          )` + familyMemberSelect
+	return queryFamilyMembers(db, query, tigerID, maxDepth)
+}
+
+// GetTigerDescendants returns the cubs, grandcubs and so on of the tiger, up to
+// maxDepth generations down, nearest generation first.
+func GetTigerDescendants(db *sql.DB, tigerID, maxDepth int) ([]FamilyMember, error) {
+	query := `WITH RECURSIVE relatives(id, generation) AS (
+	            SELECT id, 1 FROM tigers WHERE mother_id = $1 OR father_id = $1
+	            UNION
+	            SELECT t.id, r.generation + 1 FROM relatives r
+	            JOIN tigers t ON t.mother_id = r.id OR t.father_id = r.id
+	            WHERE r.generation < $2
+	          )` + familyMemberSelect
+	return queryFamilyMembers(db, query, tigerID, maxDepth)
+}
+
+// familyMemberSelect loads the tigers collected in the relatives CTE. A tiger
+// reached through several paths is listed once, at its nearest generation.
+const familyMemberSelect = `
+	          SELECT r.generation, ` + tigerColumns + ` FROM tigers
+	          JOIN (SELECT id AS member_id, MIN(generation) AS generation FROM relatives WHERE id <> $1 GROUP BY id) r ON r.member_id = tigers.id
+	          ORDER BY r.generation, id`
+
+func queryFamilyMembers(db *sql.DB, query string, tigerID, maxDepth int) ([]FamilyMember, error) {
+	rows, err := db.Query(query, tigerID, maxDepth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []FamilyMember{}
+	for rows.Next() {
+		var generation int
+		t, err := scanTiger(generationScanner{rows, &generation})
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, FamilyMember{Tiger: *t, Generation: generation})
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// generationScanner reads the leading generation column before the tiger columns.
+type generationScanner struct {
+	row        rowScanner
+	generation *int
+}
+
+func (s generationScanner) Scan(dest ...interface{}) error {
+	return s.row.Scan(append([]interface{}{s.generation}, dest...)...)
+}
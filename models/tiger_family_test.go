@@ -0,0 +1,153 @@
+package models
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tigerRow(id int, name string, dateOfBirth time.Time, motherID driver.Value) []driver.Value {
+	return []driver.Value{id, name, dateOfBirth, time.Now(), 10.5, 20.5, "active", "", nil, nil, motherID, nil, "female", "", "", "", "", false, "{}", "{}", "{}"}
+}
+
+func TestValidateParents(t *testing.T) {
+	motherBorn := time.Date(2012, 1, 1, 0, 0, 0, 0, time.UTC)
+	cubBorn := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	motherID := 1
+
+	t.Run("Valid new cub", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id =").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(tigerTestColumns).AddRow(tigerRow(1, "Mother", motherBorn, nil)...))
+
+		assert.NoError(t, ValidateParents(db, &Tiger{DateOfBirth: cubBorn, MotherID: &motherID}))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Cub born before its mother", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id =").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(tigerTestColumns).AddRow(tigerRow(1, "Mother", cubBorn, nil)...))
+
+		assert.Equal(t, ErrParentTooYoung, ValidateParents(db, &Tiger{DateOfBirth: motherBorn, MotherID: &motherID}))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Male mother", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		row := tigerRow(1, "Mother", motherBorn, nil)
+		row[12] = "male"
+		mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id =").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(tigerTestColumns).AddRow(row...))
+
+		assert.Equal(t, ErrParentSex, ValidateParents(db, &Tiger{DateOfBirth: cubBorn, MotherID: &motherID}))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Unknown parent", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id =").
+			WithArgs(1).
+			WillReturnError(sql.ErrNoRows)
+
+		assert.Equal(t, ErrParentNotFound, ValidateParents(db, &Tiger{DateOfBirth: cubBorn, MotherID: &motherID}))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Own parent", func(t *testing.T) {
+		db, _, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		assert.Equal(t, ErrParentIsSelf, ValidateParents(db, &Tiger{ID: 1, DateOfBirth: cubBorn, MotherID: &motherID}))
+	})
+
+	t.Run("Parent is a descendant", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id =").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(tigerTestColumns).AddRow(tigerRow(1, "Mother", motherBorn, 5)...))
+		mock.ExpectQuery("WITH RECURSIVE lineage").
+			WithArgs(5, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+		assert.Equal(t, ErrLineageCycle, ValidateParents(db, &Tiger{ID: 5, DateOfBirth: cubBorn, MotherID: &motherID}))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Born after its own cub", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM tigers WHERE \\(mother_id = \\$1 OR father_id = \\$1\\) AND date_of_birth <= \\$2\\)").
+			WithArgs(5, cubBorn).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+		assert.Equal(t, ErrChildTooOld, ValidateParents(db, &Tiger{ID: 5, DateOfBirth: cubBorn}))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestGetTigerAncestors(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	columns := append([]string{"generation"}, tigerTestColumns...)
+	mock.ExpectQuery("WITH RECURSIVE relatives(.+)SELECT r.generation, (.+) FROM tigers").
+		WithArgs(3, 2).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(append([]driver.Value{1}, tigerRow(2, "Mother", time.Now(), 1)...)...).
+			AddRow(append([]driver.Value{2}, tigerRow(1, "Grandmother", time.Now(), nil)...)...))
+
+	ancestors, err := GetTigerAncestors(db, 3, 2)
+	require.NoError(t, err)
+	require.Len(t, ancestors, 2)
+	assert.Equal(t, "Mother", ancestors[0].Name)
+	assert.Equal(t, 1, ancestors[0].Generation)
+	assert.Equal(t, 1, *ancestors[0].MotherID)
+	assert.Equal(t, 2, ancestors[1].Generation)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetTigerDescendants(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	columns := append([]string{"generation"}, tigerTestColumns...)
+	mock.ExpectQuery("WITH RECURSIVE relatives(.+)WHERE mother_id = \\$1 OR father_id = \\$1").
+		WithArgs(1, 3).
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	descendants, err := GetTigerDescendants(db, 1, 3)
+	require.NoError(t, err)
+	assert.Empty(t, descendants)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,194 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrMergeSameTiger is returned when a tiger is merged into itself.
+	ErrMergeSameTiger = errors.New("a tiger can not be merged into itself")
+	// ErrTigerAlreadyMerged is returned when either tiger of a merge, or a tiger
+	// being updated, has already been merged.
+	ErrTigerAlreadyMerged = errors.New("tiger has already been merged")
+)
+
+// MergeTigers folds the duplicate tiger sourceID into targetID within one
+// transaction. The sightings and aliases of the duplicate move to the survivor,
+// its name becomes an alias of the survivor unless it has it already, and the survivor's last seen
+// details are set to the most recent of both. The survivor also takes over the
+// identification codes, tags and cubs of the duplicate, its parents where the
+// survivor has none recorded, and its sighting rule unless the survivor has one
+// of its own. The parents and cubs taken over are checked as in ValidateParents.
+// The duplicate keeps its row with merged_into_id set, so lookups of its ID
+// can be redirected.
+func MergeTigers(db *sql.DB, sourceID, targetID int) (*Tiger, error) {
+	if sourceID == targetID {
+		return nil, ErrMergeSameTiger
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock both tigers so concurrent sightings or merges wait for this one.
+	rows, err := tx.Query(`SELECT `+tigerColumns+` FROM tigers WHERE id IN ($1, $2) ORDER BY id FOR UPDATE`, sourceID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	var source, target *Tiger
+	for rows.Next() {
+		t, err := scanTiger(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if t.ID == sourceID {
+			source = t
+		} else {
+			target = t
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if source == nil || target == nil {
+		return nil, sql.ErrNoRows
+	}
+	if source.Merged() || target.Merged() {
+		return nil, ErrTigerAlreadyMerged
+	}
+
+	target.IdentificationCodes = unionStrings(target.IdentificationCodes, source.IdentificationCodes)
+	target.Tags = unionStrings(target.Tags, source.Tags)
+	if target.MotherID == nil && source.MotherID != nil && *source.MotherID != targetID {
+		target.MotherID = source.MotherID
+	}
+	if target.FatherID == nil && source.FatherID != nil && *source.FatherID != targetID {
+		target.FatherID = source.FatherID
+	}
+	// The duplicate can not stay a parent of the tiger it is merged into.
+	if target.MotherID != nil && *target.MotherID == sourceID {
+		target.MotherID = nil
+	}
+	if target.FatherID != nil && *target.FatherID == sourceID {
+		target.FatherID = nil
+	}
+
+	// Check the lineage the survivor ends up with before anything moves.
+	if err := ValidateParents(tx, target); err != nil {
+		return nil, err
+	}
+	if err := validateMergedCubs(tx, sourceID, target); err != nil {
+		return nil, err
+	}
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`UPDATE sightings SET tiger_id = $2 WHERE tiger_id = $1`, []interface{}{sourceID, targetID}},
+		// Aliases the survivor already has, or its name, are not moved or added again.
+		{`DELETE FROM tiger_aliases WHERE tiger_id = $1
+		  AND (LOWER(name) = LOWER($3) OR LOWER(name) IN (SELECT LOWER(name) FROM tiger_aliases WHERE tiger_id = $2))`,
+			[]interface{}{sourceID, targetID, target.Name}},
+		{`UPDATE tiger_aliases SET tiger_id = $2 WHERE tiger_id = $1`, []interface{}{sourceID, targetID}},
+		{`INSERT INTO tiger_aliases (tiger_id, name) SELECT $1, $2::TEXT WHERE LOWER($2) <> LOWER($3)
+		  AND NOT EXISTS (SELECT 1 FROM tiger_aliases WHERE tiger_id = $1 AND LOWER(name) = LOWER($2))`,
+			[]interface{}{targetID, source.Name, target.Name}},
+		{`UPDATE tiger_identification_codes SET tiger_id = $2 WHERE tiger_id = $1`, []interface{}{sourceID, targetID}},
+		{`UPDATE tigers SET tags = '{}' WHERE id = $1`, []interface{}{sourceID}},
+		{`UPDATE tigers SET tags = $2, mother_id = $3, father_id = $4 WHERE id = $1`,
+			[]interface{}{targetID, stringArray(target.Tags), target.MotherID, target.FatherID}},
+		// A cub of the duplicate becomes a cub of the survivor, unless it is the survivor itself.
+		{`UPDATE tigers SET mother_id = CASE WHEN id = $2 THEN NULL ELSE $2 END WHERE mother_id = $1`, []interface{}{sourceID, targetID}},
+		{`UPDATE tigers SET father_id = CASE WHEN id = $2 THEN NULL ELSE $2 END WHERE father_id = $1`, []interface{}{sourceID, targetID}},
+		// The survivor keeps its own sighting rule; the duplicate's only moves over when it has none.
+		{`UPDATE sighting_rules SET tiger_id = $2 WHERE scope = 'tiger' AND tiger_id = $1
+		  AND NOT EXISTS (SELECT 1 FROM sighting_rules WHERE scope = 'tiger' AND tiger_id = $2)`, []interface{}{sourceID, targetID}},
+		{`DELETE FROM sighting_rules WHERE scope = 'tiger' AND tiger_id = $1`, []interface{}{sourceID}},
+		// Tigers merged into the duplicate earlier now redirect straight to the survivor.
+		{`UPDATE tigers SET merged_into_id = $2 WHERE merged_into_id = $1 OR id = $1`, []interface{}{sourceID, targetID}},
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt.query, stmt.args...); err != nil {
+			return nil, translateTigerError(err)
+		}
+	}
+
+	target.Aliases = mergedAliases(target, source)
+
+	if source.LastSeenTimestamp.After(target.LastSeenTimestamp) {
+		target.LastSeenTimestamp = source.LastSeenTimestamp
+		target.LastSeenLat = source.LastSeenLat
+		target.LastSeenLon = source.LastSeenLon
+		query := `UPDATE tigers SET last_seen_timestamp = $2, last_seen_lat = $3, last_seen_lon = $4 WHERE id = $1`
+		if _, err := tx.Exec(query, target.ID, target.LastSeenTimestamp, target.LastSeenLat, target.LastSeenLon); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// validateMergedCubs checks the cubs of the duplicate sourceID before they
+// become cubs of the survivor: they must be born after it, and the duplicate
+// must not be an ancestor of the survivor's parents, or the lineage would loop.
+func validateMergedCubs(db queryRower, sourceID int, target *Tiger) error {
+	var olderCub bool
+	query := `SELECT EXISTS (SELECT 1 FROM tigers WHERE (mother_id = $1 OR father_id = $1) AND id <> $2 AND date_of_birth <= $3)`
+	if err := db.QueryRow(query, sourceID, target.ID, target.DateOfBirth).Scan(&olderCub); err != nil {
+		return err
+	}
+	if olderCub {
+		return ErrChildTooOld
+	}
+
+	for _, parentID := range []*int{target.MotherID, target.FatherID} {
+		if parentID == nil {
+			continue
+		}
+		isDescendant, err := isAncestor(db, sourceID, *parentID)
+		if err != nil {
+			return err
+		}
+		if isDescendant {
+			return ErrLineageCycle
+		}
+	}
+	return nil
+}
+
+// mergedAliases returns the aliases of the survivor followed by those of the
+// duplicate and its name, leaving out the survivor's name and repeats, ignoring case.
+func mergedAliases(target, source *Tiger) []string {
+	seen := map[string]bool{strings.ToLower(target.Name): true}
+	aliases := []string{}
+	for _, alias := range append(append(append([]string{}, target.Aliases...), source.Aliases...), source.Name) {
+		if key := strings.ToLower(alias); !seen[key] {
+			seen[key] = true
+			aliases = append(aliases, alias)
+		}
+	}
+	return aliases
+}
+
+// unionStrings returns the values of a followed by those of b that are not in a.
+func unionStrings(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	result := []string{}
+	for _, v := range append(append([]string{}, a...), b...) {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeTigers_SameTiger(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = MergeTigers(db, 1, 1)
+	assert.Equal(t, ErrMergeSameTiger, err)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMergeTigers_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id IN").
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows(tigerTestColumns))
+	mock.ExpectRollback()
+
+	_, err = MergeTigers(db, 2, 1)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMergeTigers(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	older := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id IN \\(\\$1, \\$2\\) ORDER BY id FOR UPDATE").
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows(tigerTestColumns).
+			AddRow(1, "TigerOne", older, older, 10.0, 20.0, "active", "", nil, nil, nil, nil, "female", "", "", "", "", false, "{CT-1}", "{collared}", "{}").
+			AddRow(2, "Tiger1", older, newer, 11.0, 21.0, "active", "", nil, nil, 5, 6, "female", "", "", "", "", false, "{CT-2,CT-1}", "{collared,injured}", "{T1}"))
+	expectMergeLineage(mock, older)
+	mock.ExpectExec("UPDATE sightings SET tiger_id = \\$2 WHERE tiger_id = \\$1").WithArgs(2, 1).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("DELETE FROM tiger_aliases WHERE tiger_id = \\$1").WithArgs(2, 1, "TigerOne").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE tiger_aliases SET tiger_id = \\$2 WHERE tiger_id = \\$1").WithArgs(2, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO tiger_aliases (.+) WHERE LOWER\\(\\$2\\) <> LOWER\\(\\$3\\)").WithArgs(1, "Tiger1", "TigerOne").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE tiger_identification_codes SET tiger_id = \\$2 WHERE tiger_id = \\$1").
+		WithArgs(2, 1).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("UPDATE tigers SET tags = '{}' WHERE id = \\$1").
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE tigers SET tags = \\$2, mother_id = \\$3, father_id = \\$4 WHERE id = \\$1").
+		WithArgs(1, pq.StringArray{"collared", "injured"}, 5, 6).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE tigers SET mother_id = CASE WHEN id = \\$2 THEN NULL ELSE \\$2 END WHERE mother_id = \\$1").
+		WithArgs(2, 1).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("UPDATE tigers SET father_id = CASE WHEN id = \\$2 THEN NULL ELSE \\$2 END WHERE father_id = \\$1").
+		WithArgs(2, 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE sighting_rules SET tiger_id = \\$2 WHERE scope = 'tiger' AND tiger_id = \\$1").
+		WithArgs(2, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM sighting_rules WHERE scope = 'tiger' AND tiger_id = \\$1").
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE tigers SET merged_into_id = \\$2 WHERE merged_into_id = \\$1 OR id = \\$1").
+		WithArgs(2, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE tigers SET last_seen_timestamp").
+		WithArgs(1, newer, 11.0, 21.0).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	survivor, err := MergeTigers(db, 2, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, survivor.ID)
+	assert.Equal(t, []string{"CT-1", "CT-2"}, survivor.IdentificationCodes)
+	assert.Equal(t, []string{"collared", "injured"}, survivor.Tags)
+	assert.Equal(t, []string{"T1", "Tiger1"}, survivor.Aliases)
+	require.NotNil(t, survivor.MotherID)
+	assert.Equal(t, 5, *survivor.MotherID)
+	assert.True(t, newer.Equal(survivor.LastSeenTimestamp))
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMergeTigers_LineageCycle(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	// The mother of the duplicate is a cub of the survivor.
+	older := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id IN").
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows(tigerTestColumns).
+			AddRow(tigerRow(1, "TigerOne", older, nil)...).
+			AddRow(tigerRow(2, "Tiger1", older, 5)...))
+	mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id =").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows(tigerTestColumns).AddRow(tigerRow(5, "Mother", older.AddDate(-5, 0, 0), 1)...))
+	mock.ExpectQuery("WITH RECURSIVE lineage").
+		WithArgs(1, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	_, err = MergeTigers(db, 2, 1)
+	assert.Equal(t, ErrLineageCycle, err)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMergeTigers_CubTooOld(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	older := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id IN").
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows(tigerTestColumns).
+			AddRow(tigerRow(1, "TigerOne", older, nil)...).
+			AddRow(tigerRow(2, "Tiger1", older, nil)...))
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM tigers WHERE \\(mother_id = \\$1 OR father_id = \\$1\\) AND date_of_birth").
+		WithArgs(1, older).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	// A cub of the duplicate is born before the survivor.
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM tigers WHERE \\(mother_id = \\$1 OR father_id = \\$1\\) AND id <> \\$2").
+		WithArgs(2, 1, older).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	_, err = MergeTigers(db, 2, 1)
+	assert.Equal(t, ErrChildTooOld, err)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMergedAliases(t *testing.T) {
+	survivor := &Tiger{Name: "Raja", Aliases: []string{"T1", "Machli"}}
+
+	// The duplicate's name is added once, after the aliases of both.
+	assert.Equal(t, []string{"T1", "Machli", "T2", "Stripes"}, mergedAliases(survivor, &Tiger{Name: "Stripes", Aliases: []string{"T2"}}))
+	// Names and aliases the survivor already has are left out, ignoring case.
+	assert.Equal(t, []string{"T1", "Machli"}, mergedAliases(survivor, &Tiger{Name: "machli", Aliases: []string{"RAJA", "t1"}}))
+}
+
+// expectMergeLineage expects the lineage checks of TestMergeTigers, where the
+// survivor 1, born at born, takes over the mother 5 and father 6 of the duplicate 2.
+func expectMergeLineage(mock sqlmock.Sqlmock, born time.Time) {
+	for _, id := range []int{5, 6} {
+		row := tigerRow(id, "Parent", born.AddDate(-5, 0, 0), nil)
+		if id == 6 {
+			row[12] = "male"
+		}
+		mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id =").
+			WithArgs(id).
+			WillReturnRows(sqlmock.NewRows(tigerTestColumns).AddRow(row...))
+		mock.ExpectQuery("WITH RECURSIVE lineage").
+			WithArgs(1, id).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	}
+	mock.ExpectQuery("SELECT EXISTS (.+) AND date_of_birth <= \\$2\\)").
+		WithArgs(1, born).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery("SELECT EXISTS (.+) AND id <> \\$2 AND date_of_birth <= \\$3\\)").
+		WithArgs(2, 1, born).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	for _, id := range []int{5, 6} {
+		mock.ExpectQuery("WITH RECURSIVE lineage").
+			WithArgs(2, id).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	}
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"database/sql"
+	"math"
+
+	"github.com/ravirajdarisi/tigerhall-kittens/utils"
+)
+
+// NearbyTiger is a tiger together with the distance from the searched point to
+// where it was last seen.
+type NearbyTiger struct {
+	Tiger
+	DistanceKm float64 `json:"distance_km"`
+}
+
+// BoundingBoxAround returns the smallest bounding box holding every point
+// within radiusKm of the given point. Near the poles it spans all longitudes.
+func BoundingBoxAround(lat, lon, radiusKm float64) BoundingBox {
+	angle := radiusKm / utils.EarthRadiusKm
+	dLat := angle * 180 / math.Pi
+	box := BoundingBox{MinLat: math.Max(lat-dLat, -90), MaxLat: math.Min(lat+dLat, 90), MinLon: -180, MaxLon: 180}
+
+	// The longitudes of the circle are widest at the latitude where it touches
+	// the meridians, which does not exist once the circle reaches a pole.
+	if box.MinLat > -90 && box.MaxLat < 90 {
+		dLon := math.Asin(math.Sin(angle)/math.Cos(lat*math.Pi/180)) * 180 / math.Pi
+		box.MinLon, box.MaxLon = lon-dLon, lon+dLon
+		if box.MinLon < -180 {
+			box.MinLon += 360
+		}
+		if box.MaxLon > 180 {
+			box.MaxLon -= 360
+		}
+	}
+	return box
+}
+
+// GetTigersNear retrieves up to limit tigers matching the filter that were last
+// seen within radiusKm of the given point, nearest first. The filter's area is
+// replaced by the bounding box of the circle, so the location index narrows
+// down the tigers before the haversine distance of utils.CalculateDistance is
+// computed for the remaining ones.
+func GetTigersNear(db *sql.DB, lat, lon, radiusKm float64, limit int, filter TigerFilter) ([]NearbyTiger, error) {
+	area := BoundingBoxAround(lat, lon, radiusKm)
+	filter.Area = &area
+
+	args := []interface{}{lat, lon, radiusKm, limit, utils.EarthRadiusKm}
+	query := `SELECT * FROM (
+	            SELECT ` + tigerColumns + `, 2 * $5::DOUBLE PRECISION * ATAN2(SQRT(h.a), SQRT(1 - h.a)) AS distance_km
+	            FROM tigers CROSS JOIN LATERAL (
+	              SELECT POWER(SIN(RADIANS(last_seen_lat - $1) / 2), 2) +
+	                     COS(RADIANS($1)) * COS(RADIANS(last_seen_lat)) * POWER(SIN(RADIANS(last_seen_lon - $2) / 2), 2) AS a
+	            ) h
+	            WHERE ` + filter.where(&args) + `
+	          ) nearby
+	          WHERE distance_km <= $3 ORDER BY distance_km, id LIMIT $4`
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tigers := []NearbyTiger{}
+	for rows.Next() {
+		var distance float64
+		t, err := scanTiger(distanceScanner{rows, &distance})
+		if err != nil {
+			return nil, err
+		}
+		tigers = append(tigers, NearbyTiger{Tiger: *t, DistanceKm: distance})
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tigers, nil
+}
+
+// distanceScanner reads the trailing distance column after the tiger columns.
+type distanceScanner struct {
+	row      rowScanner
+	distance *float64
+}
+
+func (s distanceScanner) Scan(dest ...interface{}) error {
+	return s.row.Scan(append(dest, s.distance)...)
+}
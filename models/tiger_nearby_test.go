@@ -0,0 +1,56 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ravirajdarisi/tigerhall-kittens/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoundingBoxAround(t *testing.T) {
+	box := BoundingBoxAround(21.0, 79.0, 20)
+	assert.InDelta(t, 20.82, box.MinLat, 0.01)
+	assert.InDelta(t, 21.18, box.MaxLat, 0.01)
+	assert.InDelta(t, 78.81, box.MinLon, 0.01)
+	assert.InDelta(t, 79.19, box.MaxLon, 0.01)
+
+	// The corners of the box lie beyond the radius, its edges on it.
+	assert.InDelta(t, 20, utils.CalculateDistance(21.0, 79.0, box.MaxLat, 79.0), 0.01)
+	assert.Greater(t, utils.CalculateDistance(21.0, 79.0, box.MaxLat, box.MaxLon), 20.0)
+
+	// Across the antimeridian the box wraps around.
+	box = BoundingBoxAround(-17.0, 179.95, 20)
+	assert.Greater(t, box.MinLon, box.MaxLon)
+	assert.InDelta(t, -179.86, box.MaxLon, 0.01)
+
+	// A circle around a pole spans all longitudes.
+	box = BoundingBoxAround(89.95, 10, 20)
+	assert.Equal(t, 90.0, box.MaxLat)
+	assert.Equal(t, -180.0, box.MinLon)
+	assert.Equal(t, 180.0, box.MaxLon)
+}
+
+func TestGetTigersNear(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	columns := append(append([]string{}, tigerTestColumns...), "distance_km")
+	mock.ExpectQuery("SELECT \\* FROM \\( SELECT (.+) ATAN2(.+) WHERE merged_into_id IS NULL AND status <> 'deceased' "+
+		"AND last_seen_lat BETWEEN \\$6 AND \\$7 AND last_seen_lon BETWEEN \\$8 AND \\$9 \\) nearby "+
+		"WHERE distance_km <= \\$3 ORDER BY distance_km, id LIMIT \\$4").
+		WithArgs(21.0, 79.0, 20.0, 10, utils.EarthRadiusKm, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(3, "TigerThree", time.Now(), time.Now(), 21.05, 79.02, "active", "", nil, nil, nil, nil, "unknown", "", "", "", "", false, "{}", "{}", "{}", 5.9))
+
+	tigers, err := GetTigersNear(db, 21.0, 79.0, 20, 10, TigerFilter{})
+	require.NoError(t, err)
+	require.Len(t, tigers, 1)
+	assert.Equal(t, "TigerThree", tigers[0].Name)
+	assert.Equal(t, 5.9, tigers[0].DistanceKm)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
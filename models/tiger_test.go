@@ -7,8 +7,11 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 )
 
+var tigerTestColumns = []string{"id", "name", "date_of_birth", "last_seen_timestamp", "last_seen_lat", "last_seen_lon", "status", "status_reason", "status_effective_at", "merged_into_id", "mother_id", "father_id", "sex", "subspecies", "distinguishing_marks", "stripe_notes", "reserve", "sensitive", "identification_codes", "tags", "aliases"}
+
 func TestNewTiger(t *testing.T) {
 	name := "TigerName"
 	dateOfBirth := time.Now()
@@ -41,13 +44,17 @@ func TestTiger_Save(t *testing.T) {
 		LastSeenLon:       56.78,
 	}
 
+	mock.ExpectBegin()
 	mock.ExpectQuery("INSERT INTO tigers").
-		WithArgs(tiger.Name, tiger.DateOfBirth, tiger.LastSeenTimestamp, tiger.LastSeenLat, tiger.LastSeenLon).
+		WithArgs(tiger.Name, tiger.DateOfBirth, tiger.LastSeenTimestamp, tiger.LastSeenLat, tiger.LastSeenLon, nil, nil,
+			TigerSexUnknown, TigerSubspecies(""), "", "", pq.StringArray{}, "", false).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
 
 	err = tiger.Save(db)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, tiger.ID, "After saving, tiger ID should be set to 1")
+	assert.Equal(t, TigerSexUnknown, tiger.Sex, "Tigers of unknown sex should be saved as such")
 
 	// Ensure all expectations were met
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -101,11 +108,11 @@ func TestGetTigerByID(t *testing.T) {
 
 	// Example tiger data to be returned
 	tigerID := 1
-	tigerRow := sqlmock.NewRows([]string{"id", "name", "date_of_birth", "last_seen_timestamp", "last_seen_lat", "last_seen_lon"}).
-		AddRow(tigerID, "TigerOne", time.Now(), time.Now(), 10.123, 20.123)
+	tigerRow := sqlmock.NewRows(tigerTestColumns).
+		AddRow(tigerID, "TigerOne", time.Now(), time.Now(), 10.123, 20.123, "active", "", nil, nil, nil, nil, "unknown", "", "", "", "", false, "{}", "{}", "{}")
 
 	// Setting up the expected query for a specific tiger ID
-	mock.ExpectQuery("SELECT id, name, date_of_birth, last_seen_timestamp, last_seen_lat, last_seen_lon FROM tigers WHERE id =").
+	mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id =").
 		WithArgs(tigerID).
 		WillReturnRows(tigerRow)
 
@@ -132,19 +139,19 @@ func TestGetAllTigers(t *testing.T) {
 	defer db.Close()
 
 	// Example data to be returned
-	tigerRows := sqlmock.NewRows([]string{"id", "name", "date_of_birth", "last_seen_timestamp", "last_seen_lat", "last_seen_lon"}).
-		AddRow(1, "TigerOne", time.Now(), time.Now(), 10.123, 20.123).
-		AddRow(2, "TigerTwo", time.Now(), time.Now(), 15.123, 25.123)
+	tigerRows := sqlmock.NewRows(tigerTestColumns).
+		AddRow(1, "TigerOne", time.Now(), time.Now(), 10.123, 20.123, "active", "", nil, nil, nil, nil, "unknown", "", "", "", "", false, "{}", "{}", "{}").
+		AddRow(2, "TigerTwo", time.Now(), time.Now(), 15.123, 25.123, "missing", "Not seen since the monsoon", time.Now(), nil, 1, nil, "female", "bengal", "Torn left ear", "", "Ranthambore", true, "{CT-0042}", "{cub,\"core area\"}", "{T2}")
 
 	// Setting up the expected query with pagination parameters
 	limit := 2
 	offset := 0
-	mock.ExpectQuery("SELECT id, name, date_of_birth, last_seen_timestamp, last_seen_lat, last_seen_lon FROM tigers ORDER BY last_seen_timestamp DESC").
+	mock.ExpectQuery("SELECT (.+) FROM tigers WHERE merged_into_id IS NULL AND status <> 'deceased' ORDER BY last_seen_timestamp DESC, id DESC LIMIT \\$1 OFFSET \\$2").
 		WithArgs(limit, offset).
 		WillReturnRows(tigerRows)
 
 	// Calling the method under test
-	tigers, err := GetAllTigers(db, limit, offset)
+	tigers, err := GetAllTigers(db, limit, offset, TigerFilter{}, TigerSort{})
 	require.NoError(t, err)
 
 	// Asserting the expected outcomes
@@ -153,6 +160,13 @@ func TestGetAllTigers(t *testing.T) {
 	assert.Equal(t, "TigerOne", tigers[0].Name, "The first tiger's name should match")
 	assert.Equal(t, 2, tigers[1].ID, "The second tiger's ID should match")
 	assert.Equal(t, "TigerTwo", tigers[1].Name, "The second tiger's name should match")
+	assert.Equal(t, TigerMissing, tigers[1].Status, "The second tiger's status should match")
+	assert.Equal(t, TigerFemale, tigers[1].Sex, "The second tiger's sex should match")
+	assert.True(t, tigers[1].Sensitive, "The second tiger should be sensitive")
+	assert.Equal(t, []string{"CT-0042"}, tigers[1].IdentificationCodes, "The second tiger's identification codes should match")
+	assert.Equal(t, []string{"cub", "core area"}, tigers[1].Tags, "The second tiger's tags should match")
+	assert.Equal(t, []string{"T2"}, tigers[1].Aliases, "The second tiger's aliases should match")
+	assert.Empty(t, tigers[0].Tags, "The first tiger should have no tags")
 
 	// Ensure all expectations were met
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -160,6 +174,265 @@ func TestGetAllTigers(t *testing.T) {
 	}
 }
 
+func TestGetAllTigers_Filter(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	filter := TigerFilter{
+		IncludeDeceased:    true,
+		Sex:                TigerMale,
+		Subspecies:         SubspeciesAmur,
+		IdentificationCode: "CT-0042",
+		Alias:              "Old Stripe",
+		Tags:               []string{"collared"},
+	}
+	mock.ExpectQuery("WHERE merged_into_id IS NULL AND sex = \\$3 AND subspecies = \\$4 AND EXISTS \\(SELECT 1 FROM tiger_identification_codes (.+) = \\$5\\) " +
+		"AND EXISTS \\(SELECT 1 FROM tiger_aliases (.+) LOWER\\(\\$6\\)\\) AND tags @> \\$7 ORDER BY").
+		WithArgs(10, 0, TigerMale, SubspeciesAmur, "CT-0042", "Old Stripe", pq.StringArray{"collared"}).
+		WillReturnRows(sqlmock.NewRows(tigerTestColumns))
+
+	tigers, err := GetAllTigers(db, 10, 0, filter, TigerSort{})
+	require.NoError(t, err)
+	assert.Empty(t, tigers)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetAllTigers_SearchAreaAndSort(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	from := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	filter := TigerFilter{
+		Search:       "50%_off",
+		Statuses:     []TigerStatus{TigerMissing, TigerDeceased},
+		LastSeenFrom: &from,
+		Area:         &BoundingBox{MinLat: 10, MinLon: 170, MaxLat: 20, MaxLon: -170},
+	}
+	mock.ExpectQuery("WHERE merged_into_id IS NULL AND status = ANY\\(\\$3\\) AND \\(name ILIKE \\$4 OR EXISTS (.+) ILIKE \\$4\\)\\) " +
+		"AND last_seen_timestamp >= \\$5 AND last_seen_lat BETWEEN \\$6 AND \\$7 AND \\(last_seen_lon >= \\$8 OR last_seen_lon <= \\$9\\) " +
+		"ORDER BY LOWER\\(name\\) ASC, id ASC").
+		WithArgs(5, 10, pq.StringArray{"missing", "deceased"}, `%50\%\_off%`, from, 10.0, 20.0, 170.0, -170.0).
+		WillReturnRows(sqlmock.NewRows(tigerTestColumns))
+
+	_, err = GetAllTigers(db, 5, 10, filter, TigerSort{Field: SortByName})
+	require.NoError(t, err)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCountTigers(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM tigers WHERE merged_into_id IS NULL AND sex = \\$1$").
+		WithArgs(TigerFemale).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(42))
+
+	count, err := CountTigers(db, TigerFilter{IncludeDeceased: true, Sex: TigerFemale})
+	require.NoError(t, err)
+	assert.Equal(t, 42, count)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTigerSort_Valid(t *testing.T) {
+	assert.True(t, TigerSort{}.Valid())
+	assert.True(t, TigerSort{Field: SortByDateOfBirth, Descending: true}.Valid())
+	assert.False(t, TigerSort{Field: "name; DROP TABLE tigers"}.Valid())
+}
+
+func TestGetTigersPage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	sort := TigerSort{Field: SortByName}
+	cursor := sort.Cursor(Tiger{ID: 4, Name: "Bagheera"}, false)
+	mock.ExpectQuery("WHERE merged_into_id IS NULL AND status <> 'deceased' AND sex = \\$2 AND \\(LOWER\\(name\\), id\\) > \\(LOWER\\(\\$3\\), \\$4\\) " +
+		"ORDER BY LOWER\\(name\\) ASC, id ASC LIMIT \\$1").
+		WithArgs(3, TigerMale, "Bagheera", 4).
+		WillReturnRows(sqlmock.NewRows(tigerTestColumns).
+			AddRow(5, "Kaa", time.Now(), time.Now(), 10.1, 20.1, "active", "", nil, nil, nil, nil, "male", "", "", "", "", false, "{}", "{}", "{}").
+			AddRow(2, "Shere Khan", time.Now(), time.Now(), 10.1, 20.1, "active", "", nil, nil, nil, nil, "male", "", "", "", "", false, "{}", "{}", "{}"))
+
+	tigers, more, err := GetTigersPage(db, 2, TigerFilter{Sex: TigerMale}, sort, &cursor)
+	require.NoError(t, err)
+	assert.False(t, more)
+	require.Len(t, tigers, 2)
+	assert.Equal(t, "Kaa", tigers[0].Name)
+
+	// A cursor issued for another order is rejected.
+	_, _, err = GetTigersPage(db, 2, TigerFilter{}, TigerSort{}, &cursor)
+	assert.Equal(t, ErrInvalidCursor, err)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTigerSort_Cursor(t *testing.T) {
+	seen := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	cursor := TigerSort{}.Cursor(Tiger{ID: 3, LastSeenTimestamp: seen}, true)
+	assert.Equal(t, Cursor{Sort: "-lastSeen", Key: "2024-03-01T10:00:00Z", ID: 3, Backward: true}, cursor)
+}
+
+func TestGetTigerSummary(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT COUNT(.+) FROM sightings WHERE tiger_id =").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "min", "max", "reporters"}).AddRow(0, nil, nil, 0))
+
+	summary, err := GetTigerSummary(db, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 0, summary.SightingCount)
+	assert.Nil(t, summary.FirstSightingAt)
+	assert.Nil(t, summary.LastSightingAt)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateTiger(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	dateOfBirth := time.Date(2015, 3, 1, 0, 0, 0, 0, time.UTC)
+	lastSeen := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	effective := time.Now()
+	lockedRow := func() *sqlmock.Rows {
+		return sqlmock.NewRows(tigerTestColumns).
+			AddRow(1, "TigerOne", dateOfBirth, lastSeen, 10.0, 20.0, "active", "", nil, nil, nil, nil, "unknown", "", "", "", "", false, "{}", "{}", "{}")
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id = \\$1 FOR UPDATE").
+		WithArgs(1).
+		WillReturnRows(lockedRow())
+	mock.ExpectExec("UPDATE tigers SET name = \\$2").
+		WithArgs(1, "TigerOne", dateOfBirth, lastSeen, 10.0, 20.0, TigerDeceased, "Found dead near the river", &effective, nil, nil,
+			TigerFemale, TigerSubspecies(""), "", "", pq.StringArray{}, "", false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM tiger_identification_codes WHERE tiger_id = \\$1 AND NOT \\(code = ANY\\(\\$2\\)\\)").
+		WithArgs(1, pq.StringArray{"CT-0042"}).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO tiger_identification_codes").
+		WithArgs(1, pq.StringArray{"CT-0042"}).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("DELETE FROM tiger_aliases WHERE tiger_id = \\$1 AND NOT \\(name = ANY\\(\\$2\\)\\)").
+		WithArgs(1, pq.StringArray{"T1"}).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO tiger_aliases").
+		WithArgs(1, pq.StringArray{"T1"}).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id = \\$1 FOR UPDATE").
+		WithArgs(1).
+		WillReturnRows(lockedRow())
+	mock.ExpectExec("UPDATE tigers SET name = \\$2").
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "tigers_name_key"})
+	mock.ExpectRollback()
+
+	// The edit starts from the locked row, so the last seen details stay those in the database.
+	tiger, err := UpdateTiger(db, 1, func(t *Tiger) error {
+		t.Status = TigerDeceased
+		t.StatusReason = "Found dead near the river"
+		t.StatusEffectiveAt = &effective
+		t.Sex = TigerFemale
+		t.IdentificationCodes = []string{"CT-0042"}
+		t.Aliases = []string{"T1"}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.False(t, tiger.AcceptsSightings())
+	assert.True(t, lastSeen.Equal(tiger.LastSeenTimestamp))
+
+	_, err = UpdateTiger(db, 1, func(t *Tiger) error {
+		t.Name = "TigerTwo"
+		return nil
+	})
+	assert.Equal(t, ErrDuplicateTigerName, err)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateTiger_Merged(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id = \\$1 FOR UPDATE").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows(tigerTestColumns).
+			AddRow(2, "Tiger1", time.Now(), time.Now(), 10.0, 20.0, "active", "", nil, 1, nil, nil, "unknown", "", "", "", "", false, "{}", "{}", "{}"))
+	mock.ExpectRollback()
+
+	// A tiger merged while the request was on its way is not written back.
+	tiger, err := UpdateTiger(db, 2, func(t *Tiger) error {
+		t.Aliases = []string{"T1"}
+		return nil
+	})
+	assert.Equal(t, ErrTigerAlreadyMerged, err)
+	require.NotNil(t, tiger.MergedIntoID)
+	assert.Equal(t, 1, *tiger.MergedIntoID)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateTiger_DuplicateIdentificationCode(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM tigers WHERE id = \\$1 FOR UPDATE").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(tigerTestColumns).
+			AddRow(1, "TigerOne", time.Now(), time.Now(), 10.0, 20.0, "active", "", nil, nil, nil, nil, "unknown", "", "", "", "", false, "{}", "{}", "{}"))
+	mock.ExpectExec("UPDATE tigers SET name = \\$2").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM tiger_identification_codes").
+		WithArgs(1, pq.StringArray{"CT-0042"}).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	// Another tiger claimed the code, possibly a moment ago in a concurrent request.
+	mock.ExpectExec("INSERT INTO tiger_identification_codes").
+		WithArgs(1, pq.StringArray{"CT-0042"}).
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "tiger_identification_codes_code_key"})
+	mock.ExpectRollback()
+
+	_, err = UpdateTiger(db, 1, func(t *Tiger) error {
+		t.IdentificationCodes = []string{"CT-0042"}
+		return nil
+	})
+	assert.Equal(t, ErrDuplicateIdentificationCode, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
 
+func TestTigerStatus_Valid(t *testing.T) {
+	for _, status := range []TigerStatus{TigerActive, TigerMissing, TigerDeceased, TigerRelocated} {
+		assert.True(t, status.Valid(), status)
+	}
+	assert.False(t, TigerStatus("sleeping").Valid())
+	assert.False(t, TigerStatus("").Valid())
+}
 
+func TestTigerSex_Valid(t *testing.T) {
+	for _, sex := range []TigerSex{TigerSexUnknown, TigerFemale, TigerMale} {
+		assert.True(t, sex.Valid(), sex)
+	}
+	assert.False(t, TigerSex("").Valid())
+	assert.False(t, TigerSex("cub").Valid())
+}
 
+func TestTigerSubspecies_Valid(t *testing.T) {
+	assert.True(t, TigerSubspecies("").Valid())
+	assert.True(t, SubspeciesSumatran.Valid())
+	assert.False(t, TigerSubspecies("caspian").Valid())
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"database/sql"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -9,13 +10,22 @@ import (
 
 // User represents the user structure.
 type User struct {
-	ID           int       `json:"id"`
-	Username     string    `json:"username"`
-	PasswordHash string    `json:"-"`
-	Email        string    `json:"email"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID            int            `json:"id"`
+	Username      string         `json:"username"`
+	PasswordHash  string         `json:"-"`
+	Email         string         `json:"email"`
+	Role          Role           `json:"role"`
+	CreatedAt     time.Time      `json:"created_at"`
+	VerifiedAt    *time.Time     `json:"verified_at"`
+	TOTPSecret    sql.NullString `json:"-"`
+	TOTPEnabledAt *time.Time     `json:"totp_enabled_at"`
+	DisplayName   string         `json:"display_name"`
+	DeactivatedAt *time.Time     `json:"deactivated_at"`
 }
 
+// userColumns is the column list scanned by scanUser.
+const userColumns = `id, username, password_hash, email, role, created_at, verified_at, totp_secret, totp_enabled_at, display_name, deactivated_at`
+
 // NewUser creates a new User instance and hashes the password.
 func NewUser(username, password, email string) (*User, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -27,15 +37,17 @@ func NewUser(username, password, email string) (*User, error) {
 		Username:     username,
 		PasswordHash: string(hashedPassword),
 		Email:        email,
+		Role:         RoleReporter,
 		CreatedAt:    time.Now(),
 	}, nil
 }
 
-// Save inserts the User into the database.
+// Save inserts the User into the database. A taken username or email address is
+// reported as ErrDuplicateUsername or ErrDuplicateEmail.
 func (u *User) Save(db *sql.DB) error {
-	query := `INSERT INTO users (username, password_hash, email, created_at) VALUES ($1, $2, $3, $4)`
-	_, err := db.Exec(query, u.Username, u.PasswordHash, u.Email, u.CreatedAt)
-	return err
+	query := `INSERT INTO users (username, password_hash, email, role, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	err := db.QueryRow(query, u.Username, u.PasswordHash, u.Email, u.Role, u.CreatedAt).Scan(&u.ID)
+	return translateUserError(err)
 }
 
 // Authenticate checks if the provided password is correct.
@@ -44,11 +56,264 @@ func (u *User) Authenticate(db *sql.DB, password string) bool {
 	return err == nil
 }
 
+// Can reports whether the user's role has been granted the permission.
+func (u *User) Can(p Permission) bool {
+	return u.Role.Can(p)
+}
+
+// Verified reports whether the user has confirmed their email address.
+func (u *User) Verified() bool {
+	return u.VerifiedAt != nil
+}
+
+// MarkVerified records that the user has confirmed their email address.
+func (u *User) MarkVerified(db *sql.DB) error {
+	now := time.Now()
+	query := `UPDATE users SET verified_at = $2 WHERE id = $1`
+	if _, err := db.Exec(query, u.ID, now); err != nil {
+		return err
+	}
+	u.VerifiedAt = &now
+	return nil
+}
+
+// TOTPEnabled reports whether the user has completed two-factor enrolment.
+func (u *User) TOTPEnabled() bool {
+	return u.TOTPEnabledAt != nil && u.TOTPSecret.Valid
+}
+
+// NeedsTOTPEnrollment reports whether the user's role requires two-factor
+// authentication that the user has not turned on yet.
+func (u *User) NeedsTOTPEnrollment() bool {
+	return u.Role.RequiresTwoFactor() && !u.TOTPEnabled()
+}
+
+// SetTOTPSecret stores a new, not yet confirmed, TOTP secret for the user.
+func (u *User) SetTOTPSecret(db *sql.DB, secret string) error {
+	query := `UPDATE users SET totp_secret = $2, totp_enabled_at = NULL, totp_last_step = NULL WHERE id = $1`
+	if _, err := db.Exec(query, u.ID, secret); err != nil {
+		return err
+	}
+	u.TOTPSecret = sql.NullString{String: secret, Valid: true}
+	u.TOTPEnabledAt = nil
+	return nil
+}
+
+// EnableTOTP turns on two-factor authentication with the stored secret.
+func (u *User) EnableTOTP(db *sql.DB) error {
+	now := time.Now()
+	query := `UPDATE users SET totp_enabled_at = $2 WHERE id = $1`
+	if _, err := db.Exec(query, u.ID, now); err != nil {
+		return err
+	}
+	u.TOTPEnabledAt = &now
+	return nil
+}
+
+// DisableTOTP turns off two-factor authentication and discards the secret and recovery codes.
+func (u *User) DisableTOTP(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL WHERE id = $1`, u.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, u.ID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	u.TOTPSecret = sql.NullString{}
+	u.TOTPEnabledAt = nil
+	return nil
+}
+
+// UseTOTPStep records that the code of the given time step has been used. It
+// returns false if that step or a later one was used before, so a code can never
+// be replayed.
+func (u *User) UseTOTPStep(db *sql.DB, step int64) (bool, error) {
+	query := `UPDATE users SET totp_last_step = $2 WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2)`
+	result, err := db.Exec(query, u.ID, step)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// Active reports whether the account has not been deactivated.
+func (u *User) Active() bool {
+	return u.DeactivatedAt == nil
+}
+
+// UpdateProfile stores a new email address and display name for the user. A
+// changed email address has to be verified again.
+func (u *User) UpdateProfile(db *sql.DB, email, displayName string) error {
+	verifiedAt := u.VerifiedAt
+	if email != u.Email {
+		verifiedAt = nil
+	}
+
+	query := `UPDATE users SET email = $2, display_name = $3, verified_at = $4 WHERE id = $1`
+	if _, err := db.Exec(query, u.ID, email, displayName, verifiedAt); err != nil {
+		return translateUserError(err)
+	}
+	u.Email = email
+	u.DisplayName = displayName
+	u.VerifiedAt = verifiedAt
+	return nil
+}
+
+// Deactivate disables the account and ends all of its sessions and API keys.
+func (u *User) Deactivate(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if _, err := tx.Exec(`UPDATE users SET deactivated_at = $2 WHERE id = $1`, u.ID, now); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE refresh_tokens SET revoked_at = $2 WHERE user_id = $1 AND revoked_at IS NULL`, u.ID, now); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE api_keys SET revoked_at = $2 WHERE user_id = $1 AND revoked_at IS NULL`, u.ID, now); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	u.DeactivatedAt = &now
+	return nil
+}
+
+// Erase permanently deletes the account and everything that identifies the
+// user. Sightings are kept for research but no longer point to the user.
+func (u *User) Erase(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"refresh_tokens", "password_reset_tokens", "recovery_codes", "api_keys", "notifications"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE user_id = $1`, u.ID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM login_failures WHERE key = $1`, UserLoginFailureKey(strings.ToLower(u.Username))); err != nil {
+		return err
+	}
+	// The sightings.fk_user constraint sets user_id to NULL on the user's sightings.
+	if _, err := tx.Exec(`DELETE FROM users WHERE id = $1`, u.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateRole changes the role of the user in the database.
+func (u *User) UpdateRole(db *sql.DB, role Role) error {
+	query := `UPDATE users SET role = $2 WHERE id = $1`
+	if _, err := db.Exec(query, u.ID, role); err != nil {
+		return err
+	}
+	u.Role = role
+	return nil
+}
+
+// UpdatePassword hashes and stores a new password for the user. Any outstanding
+// password reset tokens and refresh tokens of the user are invalidated with it.
+func (u *User) UpdatePassword(db *sql.DB, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setPasswordHash(tx, u.ID, string(hashedPassword), time.Now()); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	u.PasswordHash = string(hashedPassword)
+	return nil
+}
+
+// setPasswordHash stores the password hash of a user and invalidates the
+// user's outstanding password reset tokens and refresh tokens.
+func setPasswordHash(tx *sql.Tx, userID int, passwordHash string, now time.Time) error {
+	if _, err := tx.Exec(`UPDATE users SET password_hash = $2 WHERE id = $1`, userID, passwordHash); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE password_reset_tokens SET used_at = $2 WHERE user_id = $1 AND used_at IS NULL`, userID, now); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`UPDATE refresh_tokens SET revoked_at = $2 WHERE user_id = $1 AND revoked_at IS NULL`, userID, now)
+	return err
+}
+
 // GetUserByUsername fetches the user with the given username from the database.
 func GetUserByUsername(db *sql.DB, username string) (*User, error) {
-	query := `SELECT id, username, password_hash, email, created_at FROM users WHERE username = $1`
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = $1`
+	return scanUser(db.QueryRow(query, username))
+}
+
+// GetUserByID fetches the user with the given ID from the database.
+func GetUserByID(db *sql.DB, id int) (*User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+	return scanUser(db.QueryRow(query, id))
+}
+
+// GetUserByEmail fetches the user with the given email address from the database.
+func GetUserByEmail(db *sql.DB, email string) (*User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = $1`
+	return scanUser(db.QueryRow(query, email))
+}
+
+// GetAllUsers retrieves all users from the database with pagination.
+func GetAllUsers(db *sql.DB, limit, offset int) ([]User, error) {
+	query := `SELECT ` + userColumns + ` FROM users ORDER BY id LIMIT $1 OFFSET $2`
+	rows, err := db.Query(query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func scanUser(row rowScanner) (*User, error) {
 	user := User{}
-	err := db.QueryRow(query, username).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Email, &user.CreatedAt)
+	err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Email, &user.Role, &user.CreatedAt, &user.VerifiedAt, &user.TOTPSecret, &user.TOTPEnabledAt, &user.DisplayName, &user.DeactivatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -55,14 +56,22 @@ func TestSave(t *testing.T) {
 	email := "test@example.com"
 	user, _ := NewUser(username, password, email)
 
-	mock.ExpectExec("INSERT INTO users").
-		WithArgs(user.Username, user.PasswordHash, user.Email, user.CreatedAt).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("INSERT INTO users").
+		WithArgs(user.Username, user.PasswordHash, user.Email, RoleReporter, user.CreatedAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 
 	if err := user.Save(db); err != nil {
 		t.Errorf("Expected no error, but got %v", err)
 	}
 
+	if user.ID != 1 {
+		t.Errorf("Expected the new user ID to be set, got %v", user.ID)
+	}
+
+	if user.Verified() {
+		t.Errorf("New users must not be verified")
+	}
+
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("There were unfulfilled expectations: %s", err)
 	}
@@ -100,10 +109,10 @@ func TestGetUserByUsername(t *testing.T) {
 	defer db.Close()
 
 	username := "testuser"
-	rows := sqlmock.NewRows([]string{"id", "username", "password_hash", "email", "created_at"}).
-		AddRow(1, username, "hashedpassword", "test@example.com", time.Now())
+	rows := sqlmock.NewRows([]string{"id", "username", "password_hash", "email", "role", "created_at", "verified_at", "totp_secret", "totp_enabled_at", "display_name", "deactivated_at"}).
+		AddRow(1, username, "hashedpassword", "test@example.com", "reporter", time.Now(), nil, nil, nil, "", nil)
 
-	mock.ExpectQuery("SELECT id, username, password_hash, email, created_at FROM users WHERE username =").
+	mock.ExpectQuery("SELECT id, username, password_hash, email, role, created_at, verified_at, totp_secret, totp_enabled_at, display_name, deactivated_at FROM users WHERE username =").
 		WithArgs(username).
 		WillReturnRows(rows)
 
@@ -129,7 +138,7 @@ func TestGetUserByUsername_NotFound(t *testing.T) {
 	}
 	defer db.Close()
 
-	mock.ExpectQuery("SELECT id, username, password_hash, email, created_at FROM users WHERE username =").
+	mock.ExpectQuery("SELECT id, username, password_hash, email, role, created_at, verified_at, totp_secret, totp_enabled_at, display_name, deactivated_at FROM users WHERE username =").
 		WithArgs("nonexistent").
 		WillReturnError(sql.ErrNoRows)
 
@@ -147,3 +156,374 @@ func TestGetUserByUsername_NotFound(t *testing.T) {
 		t.Errorf("There were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestGetUserByID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"id", "username", "password_hash", "email", "role", "created_at", "verified_at", "totp_secret", "totp_enabled_at", "display_name", "deactivated_at"}).
+		AddRow(7, "testuser", "hashedpassword", "test@example.com", "ranger", time.Now(), time.Now(), "SECRET", time.Now(), "Test User", nil)
+
+	mock.ExpectQuery("SELECT id, username, password_hash, email, role, created_at, verified_at, totp_secret, totp_enabled_at, display_name, deactivated_at FROM users WHERE id =").
+		WithArgs(7).
+		WillReturnRows(rows)
+
+	user, err := GetUserByID(db, 7)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if user.ID != 7 || user.Username != "testuser" || user.Role != RoleRanger || !user.TOTPEnabled() {
+		t.Errorf("Expected ranger 7 testuser, got %v %v %v", user.Role, user.ID, user.Username)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+
+func TestUser_UpdateRole(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	user := User{ID: 3, Role: RoleReporter}
+
+	mock.ExpectExec("UPDATE users SET role").
+		WithArgs(3, RoleRanger).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := user.UpdateRole(db, RoleRanger); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if user.Role != RoleRanger || !user.Can(PermissionManageTigers) {
+		t.Errorf("Expected the user to be promoted to ranger, got %v", user.Role)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUser_UpdatePassword(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	user := User{ID: 3, PasswordHash: "old"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users SET password_hash").
+		WithArgs(3, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE password_reset_tokens SET used_at").
+		WithArgs(3, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("UPDATE refresh_tokens SET revoked_at").
+		WithArgs(3, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := user.UpdatePassword(db, "new-password"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if !user.Authenticate(db, "new-password") {
+		t.Errorf("Expected the new password to authenticate")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetUserByEmail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"id", "username", "password_hash", "email", "role", "created_at", "verified_at", "totp_secret", "totp_enabled_at", "display_name", "deactivated_at"}).
+		AddRow(2, "testuser", "hashedpassword", "test@example.com", "reporter", time.Now(), nil, nil, nil, "", nil)
+
+	mock.ExpectQuery("SELECT id, username, password_hash, email, role, created_at, verified_at, totp_secret, totp_enabled_at, display_name, deactivated_at FROM users WHERE email =").
+		WithArgs("test@example.com").
+		WillReturnRows(rows)
+
+	user, err := GetUserByEmail(db, "test@example.com")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if user.ID != 2 {
+		t.Errorf("Expected user 2, got %v", user.ID)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUser_MarkVerified(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	user := User{ID: 3}
+
+	mock.ExpectExec("UPDATE users SET verified_at").
+		WithArgs(3, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := user.MarkVerified(db); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if !user.Verified() {
+		t.Errorf("Expected the user to be verified")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUser_TOTPLifecycle(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	user := User{ID: 3}
+
+	mock.ExpectExec("UPDATE users SET totp_secret = \\$2").
+		WithArgs(3, "SECRET").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE users SET totp_enabled_at").
+		WithArgs(3, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users SET totp_secret = NULL").
+		WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM recovery_codes").
+		WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectCommit()
+
+	if err := user.SetTOTPSecret(db, "SECRET"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if user.TOTPEnabled() {
+		t.Errorf("A pending secret must not enable two-factor authentication")
+	}
+
+	if err := user.EnableTOTP(db); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !user.TOTPEnabled() {
+		t.Errorf("Expected two-factor authentication to be enabled")
+	}
+
+	if err := user.DisableTOTP(db); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if user.TOTPEnabled() || user.TOTPSecret.Valid {
+		t.Errorf("Expected two-factor authentication to be disabled")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUser_UseTOTPStep(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	user := User{ID: 3}
+
+	mock.ExpectExec("UPDATE users SET totp_last_step").
+		WithArgs(3, int64(100)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE users SET totp_last_step").
+		WithArgs(3, int64(100)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if used, err := user.UseTOTPStep(db, 100); err != nil || !used {
+		t.Errorf("Expected the first use of a step to succeed, got %v %v", used, err)
+	}
+	if used, err := user.UseTOTPStep(db, 100); err != nil || used {
+		t.Errorf("Expected a replayed step to be rejected, got %v %v", used, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSave_DuplicateEmail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	user, _ := NewUser("testuser", "password", "taken@example.com")
+
+	mock.ExpectQuery("INSERT INTO users").
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "users_email_key"})
+
+	if err := user.Save(db); err != ErrDuplicateEmail {
+		t.Errorf("Expected ErrDuplicateEmail, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUser_UpdateProfile(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	verifiedAt := time.Now()
+	user := User{ID: 3, Email: "old@example.com", VerifiedAt: &verifiedAt}
+
+	mock.ExpectExec("UPDATE users SET email = \\$2, display_name = \\$3, verified_at = \\$4").
+		WithArgs(3, "old@example.com", "Stripes", &verifiedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE users SET email = \\$2, display_name = \\$3, verified_at = \\$4").
+		WithArgs(3, "new@example.com", "Stripes", nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := user.UpdateProfile(db, "old@example.com", "Stripes"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !user.Verified() {
+		t.Errorf("Changing only the display name must keep the email verified")
+	}
+
+	if err := user.UpdateProfile(db, "new@example.com", "Stripes"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if user.Verified() || user.Email != "new@example.com" {
+		t.Errorf("Expected the new email address to be unverified, got %+v", user)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUser_Deactivate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	user := User{ID: 3}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users SET deactivated_at").
+		WithArgs(3, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE refresh_tokens SET revoked_at").
+		WithArgs(3, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("UPDATE api_keys SET revoked_at").
+		WithArgs(3, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := user.Deactivate(db); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if user.Active() {
+		t.Errorf("Expected the user to be deactivated")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetAllUsers(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"id", "username", "password_hash", "email", "role", "created_at", "verified_at", "totp_secret", "totp_enabled_at", "display_name", "deactivated_at"}).
+		AddRow(1, "alice", "hash", "alice@example.com", "admin", time.Now(), time.Now(), nil, nil, "Alice", nil).
+		AddRow(2, "bob", "hash", "bob@example.com", "reporter", time.Now(), nil, nil, nil, "", time.Now())
+
+	mock.ExpectQuery("SELECT (.+) FROM users ORDER BY id LIMIT \\$1 OFFSET \\$2").
+		WithArgs(10, 0).
+		WillReturnRows(rows)
+
+	users, err := GetAllUsers(db, 10, 0)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(users) != 2 || users[0].DisplayName != "Alice" || users[1].Active() {
+		t.Errorf("Unexpected users %+v", users)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUser_Erase(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	user := User{ID: 3, Username: "Stripes"}
+
+	mock.ExpectBegin()
+	for _, table := range []string{"refresh_tokens", "password_reset_tokens", "recovery_codes", "api_keys", "notifications"} {
+		mock.ExpectExec("DELETE FROM " + table + " WHERE user_id = \\$1").
+			WithArgs(3).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectExec("DELETE FROM login_failures WHERE key = \\$1").
+		WithArgs("user:stripes").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM users WHERE id = \\$1").
+		WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := user.Erase(db); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
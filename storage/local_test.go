@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalStore(t *testing.T) {
+	dir := t.TempDir()
+	store := NewLocalStore(dir)
+
+	require.NoError(t, store.Put("ab/cd/abcd.png", []byte("png data"), "image/png"))
+	assert.FileExists(t, filepath.Join(dir, "ab", "cd", "abcd.png"))
+
+	body, err := store.Get("ab/cd/abcd.png")
+	require.NoError(t, err)
+	data, err := io.ReadAll(body)
+	body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "png data", string(data))
+
+	info, err := store.Stat("ab/cd/abcd.png")
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), info.Size)
+	assert.Equal(t, "image/png", info.ContentType)
+
+	// No temporary files are left behind.
+	entries, err := os.ReadDir(filepath.Join(dir, "ab", "cd"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	_, err = store.Get("ab/cd/missing.png")
+	assert.Equal(t, ErrNotFound, err)
+	_, err = store.Stat("ab/cd/missing.png")
+	assert.Equal(t, ErrNotFound, err)
+
+	for _, key := range []string{"", "/etc/passwd", "../escape.png", "ab//cd.png", `ab\cd.png`} {
+		assert.Equal(t, ErrInvalidKey, store.Put(key, nil, ""), key)
+	}
+
+	_, err = store.SignedURL("ab/cd/abcd.png", 0)
+	assert.Equal(t, ErrSignedURLUnsupported, err)
+
+	require.NoError(t, store.Delete("ab/cd/abcd.png"))
+	_, err = store.Stat("ab/cd/abcd.png")
+	assert.Equal(t, ErrNotFound, err)
+	assert.NoError(t, store.Delete("ab/cd/abcd.png"))
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("BLOB_STORE", "")
+	t.Setenv("IMAGE_STORAGE_PATH", "/srv/images")
+	store, err := FromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, NewLocalStore("/srv/images"), store)
+
+	t.Setenv("BLOB_STORE", "s3")
+	t.Setenv("S3_ENDPOINT", "http://localhost:9000")
+	t.Setenv("S3_BUCKET", "sightings")
+	t.Setenv("S3_ACCESS_KEY_ID", "minio")
+	t.Setenv("S3_SECRET_ACCESS_KEY", "minio-secret")
+	t.Setenv("S3_FORCE_PATH_STYLE", "true")
+	store, err = FromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:9000/sightings/ab/cd/abcd.png", store.(*S3Store).objectURL("ab/cd/abcd.png").String())
+
+	t.Setenv("BLOB_STORE", "ftp")
+	_, err = FromEnv()
+	assert.Error(t, err)
+}
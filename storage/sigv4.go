@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AWS Signature Version 4, as documented at
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-authenticating-requests.html
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	amzDateFormat   = "20060102T150405Z"
+	// maxPresignExpiry is the longest a presigned URL may be valid for.
+	maxPresignExpiry = 7 * 24 * time.Hour
+)
+
+// signer signs requests to one region and service with an access key.
+type signer struct {
+	accessKey string
+	secretKey string
+	region    string
+	service   string
+}
+
+// sign adds the date, payload hash and Authorization headers to the request.
+// payloadHash is the hex SHA-256 of the body, or unsignedPayload.
+func (s signer) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format(amzDateFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	names := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if req.Header.Get("Content-Type") != "" {
+		names = append(names, "content-type")
+	}
+	sort.Strings(names)
+	var headers strings.Builder
+	for _, name := range names {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := canonicalRequest(req.Method, req.URL, req.URL.Query(), headers.String(), signedHeaders, payloadHash)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, s.accessKey, s.scope(amzDate), signedHeaders, s.signature(amzDate, canonical)))
+}
+
+// presign returns the URL with a signature in its query string, which allows a
+// request with the method to it until the expiry passes.
+func (s signer) presign(method string, u *url.URL, expires time.Duration, now time.Time) string {
+	amzDate := now.UTC().Format(amzDateFormat)
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", sigV4Algorithm)
+	query.Set("X-Amz-Credential", s.accessKey+"/"+s.scope(amzDate))
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonical := canonicalRequest(method, u, query, "host:"+u.Host+"\n", "host", unsignedPayload)
+	return u.Scheme + "://" + u.Host + canonicalURI(u) + "?" + canonicalQuery(query) +
+		"&X-Amz-Signature=" + s.signature(amzDate, canonical)
+}
+
+// scope is the date, region and service the signature is valid for.
+func (s signer) scope(amzDate string) string {
+	return amzDate[:8] + "/" + s.region + "/" + s.service + "/aws4_request"
+}
+
+func (s signer) signature(amzDate, canonicalRequest string) string {
+	stringToSign := sigV4Algorithm + "\n" + amzDate + "\n" + s.scope(amzDate) + "\n" + hashHex([]byte(canonicalRequest))
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), amzDate[:8])
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s.service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func canonicalRequest(method string, u *url.URL, query url.Values, headers, signedHeaders, payloadHash string) string {
+	return strings.Join([]string{method, canonicalURI(u), canonicalQuery(query), headers, signedHeaders, payloadHash}, "\n")
+}
+
+// canonicalURI is the path of the URL, with every segment encoded once.
+func canonicalURI(u *url.URL) string {
+	if u.Path == "" {
+		return "/"
+	}
+	return uriEncode(u.Path, false)
+}
+
+// canonicalQuery encodes the parameters sorted by encoded name, and by encoded
+// value for repeated names. Sorting the joined "name=value" strings instead
+// would put "a-b=1" before "a=1".
+func canonicalQuery(query url.Values) string {
+	type pair struct{ name, value string }
+	pairs := make([]pair, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, pair{uriEncode(name, true), uriEncode(value, true)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].name != pairs[j].name {
+			return pairs[i].name < pairs[j].name
+		}
+		return pairs[i].value < pairs[j].value
+	})
+	encoded := make([]string, len(pairs))
+	for i, p := range pairs {
+		encoded[i] = p.name + "=" + p.value
+	}
+	return strings.Join(encoded, "&")
+}
+
+// uriEncode percent-encodes every byte except the unreserved characters of
+// RFC 3986, and the slash unless encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
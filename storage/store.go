@@ -0,0 +1,77 @@
+// Package storage keeps blobs, such as the photos of sightings, on the local
+// disk or in an S3-compatible object store.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned for a key nothing is stored under.
+	ErrNotFound = errors.New("blob not found")
+	// ErrInvalidKey is returned for a key that is empty or could escape the store.
+	ErrInvalidKey = errors.New("invalid blob key")
+	// ErrSignedURLUnsupported is returned by stores that can not hand out URLs
+	// to their blobs. Their blobs have to be served by the API itself.
+	ErrSignedURLUnsupported = errors.New("signed URLs are not supported by this store")
+)
+
+// Store keeps blobs under keys such as "ab/cd/abcd.png". Keys use forward
+// slashes on every platform.
+type Store interface {
+	// Put stores data under key, replacing any blob stored under it before.
+	Put(key string, data []byte, contentType string) error
+	// Get opens the blob stored under key. The caller must close it.
+	Get(key string) (io.ReadCloser, error)
+	// Stat describes the blob stored under key.
+	Stat(key string) (Info, error)
+	// Delete removes the blob stored under key. Deleting a key nothing is
+	// stored under is not an error.
+	Delete(key string) error
+	// SignedURL returns a URL anyone can read the blob from until it expires.
+	SignedURL(key string, expires time.Duration) (string, error)
+}
+
+// Info describes a stored blob.
+type Info struct {
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+}
+
+// validKey reports whether key is a relative path without empty, "." or ".."
+// segments, so it always stays within the store.
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, `\`) {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// FromEnv returns the store selected by BLOB_STORE: "local" (the default)
+// stores blobs in IMAGE_STORAGE_PATH, "s3" in the bucket configured by the
+// S3_* variables, see S3ConfigFromEnv.
+func FromEnv() (Store, error) {
+	switch kind := os.Getenv("BLOB_STORE"); kind {
+	case "", "local":
+		dir := os.Getenv("IMAGE_STORAGE_PATH")
+		if dir == "" {
+			dir = "./default_storage" // Default path relative to the project
+		}
+		return NewLocalStore(dir), nil
+	case "s3":
+		return NewS3Store(S3ConfigFromEnv())
+	default:
+		return nil, fmt.Errorf("unknown BLOB_STORE %q, expected local or s3", kind)
+	}
+}
@@ -32,8 +32,11 @@ func bckCalculateDistance(lat1, lon1, lat2, lon2 float64) float64 {
 	return distance
 }
 
+// EarthRadiusKm is the mean radius of the earth used for great-circle distances.
+const EarthRadiusKm = 6371
+
 func CalculateDistance(lat1, lon1, lat2, lon2 float64) float64 {
-    const earthRadiusKm = 6371 // km
+    const earthRadiusKm = EarthRadiusKm
 
     // Convert latitude and longitude from degrees to radians.
     lat1Rad := lat1 * math.Pi / 180